@@ -1,10 +1,13 @@
 package apps
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/providers"
 	"github.com/ghodss/yaml"
 	"io/ioutil"
+	"strings"
 )
 
 // Application is a structure that contains the info
@@ -14,22 +17,138 @@ type Application struct {
 	ConfigFile string
 }
 
+// Encryption modes of the connection with the SMTP server
+const (
+	// EncryptionAuto uses implicit TLS on port 465, and STARTTLS on any other port when offered
+	EncryptionAuto = ""
+	// EncryptionNone never encrypts the connection
+	EncryptionNone = "none"
+	// EncryptionSTARTTLS requires upgrading the connection via STARTTLS
+	EncryptionSTARTTLS = "starttls"
+	// EncryptionTLS uses implicit TLS (SMTPS)
+	EncryptionTLS = "tls"
+)
+
+// Encryptions contains the valid encryption modes
+var Encryptions = []string{EncryptionNone, EncryptionSTARTTLS, EncryptionTLS}
+
+// Authentication mechanisms supported by the SMTP checks
+const (
+	// AuthNegotiate uses the first mechanism of NegotiatedAuthMechanisms advertised by the server
+	AuthNegotiate = ""
+	// AuthNone sends the mail without authenticating, for relays that accept it
+	AuthNone    = "none"
+	AuthPlain   = "plain"
+	AuthLogin   = "login"
+	AuthCRAMMD5 = "cram-md5"
+	AuthXOAUTH2 = "xoauth2"
+)
+
+// AuthMechanisms contains the valid authentication mechanisms
+var AuthMechanisms = []string{AuthNone, AuthPlain, AuthLogin, AuthCRAMMD5, AuthXOAUTH2}
+
+// NegotiatedAuthMechanisms contains the mechanisms AuthNegotiate chooses from, by
+// preference, as PHPMailer and most mail libraries do
+var NegotiatedAuthMechanisms = []string{AuthPlain, AuthLogin, AuthCRAMMD5}
+
 // SMTPSettings is a structure that contains the SMTP
 // credentials to use on the SMTP checks
 type SMTPSettings struct {
-	Host string `default:"localhost"`
-	Port int    `default:"25"`
-	User string
-	Pass string
+	Host       string `default:"localhost"`
+	Port       int    `default:"25"`
+	User       string
+	Pass       string
+	Encryption string
+	// Auth is the authentication mechanism, negotiated with the server by default
+	Auth string
+	// OAuth2Token is the access token used with the xoauth2 mechanism
+	OAuth2Token string
+	// From and FromName are the sender of the mail, the SMTP user by default
+	From     string
+	FromName string
+	// credentialFlags are the alternative sources of the credentials, when the
+	// settings are created from the command line flags
+	credentialFlags *credentialFlags
+}
+
+// Sender returns the address the mail is sent from
+func (s *SMTPSettings) Sender() string {
+	if s.From != "" {
+		return s.From
+	}
+	return s.User
+}
+
+// ValidateSender checks there is an address to send the mail from, as the
+// settings of relays without authentication may not include any
+func (s *SMTPSettings) ValidateSender() error {
+	if s.Sender() == "" {
+		return fmt.Errorf("from: no sender address configured, set it using '-mail_from' flag")
+	}
+	return nil
+}
+
+// RequiresUser returns whether the authentication mechanism needs a user
+func (s *SMTPSettings) RequiresUser() bool {
+	return s.Auth != AuthNone
+}
+
+// RequiresPassword returns whether the authentication mechanism needs a password
+func (s *SMTPSettings) RequiresPassword() bool {
+	return s.Auth != AuthNone && s.Auth != AuthXOAUTH2
+}
+
+// ValidateAuth checks the authentication mechanism is valid and has the required credentials
+func (s *SMTPSettings) ValidateAuth() error {
+	valid := s.Auth == AuthNegotiate
+	for _, m := range AuthMechanisms {
+		valid = valid || s.Auth == m
+	}
+	if !valid {
+		return fmt.Errorf("auth: %q is not valid (valid values: %s)", s.Auth, strings.Join(AuthMechanisms, ", "))
+	}
+	if s.Auth == AuthXOAUTH2 && s.OAuth2Token == "" {
+		return fmt.Errorf("auth: the xoauth2 mechanism requires an access token")
+	}
+	return nil
+}
+
+// ImplicitTLS returns whether the connection is encrypted with TLS from the start
+func (s *SMTPSettings) ImplicitTLS() bool {
+	return s.Encryption == EncryptionTLS || s.Encryption == EncryptionAuto && s.Port == 465
+}
+
+// ValidateEncryption checks the encryption mode is valid
+func (s *SMTPSettings) ValidateEncryption() error {
+	if s.Encryption == EncryptionAuto {
+		return nil
+	}
+	for _, e := range Encryptions {
+		if s.Encryption == e {
+			return nil
+		}
+	}
+	return fmt.Errorf("encryption: %q is not valid (valid values: %s)", s.Encryption, strings.Join(Encryptions, ", "))
+}
+
+// ValidateProvider checks the host, port, encryption and authentication are
+// accepted by the SMTP provider, when it is a known one
+func (s *SMTPSettings) ValidateProvider() error {
+	return providers.Validate(s.Host, s.Port, s.Encryption, s.Auth, s.User)
 }
 
 // NewSMTPSettingsFromFlags creates a SMTPSettings from the provided command line flags
 func NewSMTPSettingsFromFlags(fs *flag.FlagSet) *SMTPSettings {
 	smtp := SMTPSettings{}
-	flag.StringVar(&smtp.Host, "smtp_host", "localhost", "SMTP Host")
-	flag.IntVar(&smtp.Port, "smtp_port", 25, "SMTP Port")
-	flag.StringVar(&smtp.User, "smtp_user", "", "SMTP User")
-	flag.StringVar(&smtp.Pass, "smtp_password", "", "SMTP Password")
+	fs.StringVar(&smtp.Host, "smtp_host", "localhost", "SMTP Host")
+	fs.IntVar(&smtp.Port, "smtp_port", 25, "SMTP Port")
+	fs.StringVar(&smtp.User, "smtp_user", "", "SMTP User")
+	fs.StringVar(&smtp.Pass, "smtp_password", "", "SMTP Password")
+	fs.StringVar(&smtp.Auth, "smtp_auth", "", fmt.Sprintf("SMTP Authentication mechanism: %s (negotiated by default)", strings.Join(AuthMechanisms, ", ")))
+	fs.StringVar(&smtp.From, "mail_from", "", "Mail Sender address (SMTP User by default)")
+	fs.StringVar(&smtp.FromName, "mail_from_name", "", "Mail Sender name")
+	fs.StringVar(&smtp.Encryption, "smtp_encryption", "", fmt.Sprintf("SMTP Encryption: %s (by default, implicit TLS on port 465 and STARTTLS when offered otherwise)", strings.Join(Encryptions, ", ")))
+	smtp.credentialFlags = registerCredentialFlags(fs)
 	return &smtp
 }
 
@@ -39,6 +158,19 @@ type ApplicationConfig interface {
 	ValidateSMTPSettings() error
 }
 
+// UnmarshalJSONFile reads a JSON config file and unmarshals it into a config struct
+func UnmarshalJSONFile(configFile string, config interface{}) error {
+	source, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %v", err)
+	}
+	fmt.Printf("Reading config file: %q\n", configFile)
+	if err := json.Unmarshal(source, config); err != nil {
+		return fmt.Errorf("error parsing config file: %v", err)
+	}
+	return nil
+}
+
 // UnmarshalYAMLFile reads a config file and unmarshals it into a config struct
 func UnmarshalYAMLFile(configFile string, config interface{}) error {
 	source, err := ioutil.ReadFile(configFile)
@@ -0,0 +1,23 @@
+package apps
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestNewSMTPSettingsFromFlags(t *testing.T) {
+	t.Run("Check flags are registered in the flag set", func(t *testing.T) {
+		fs := flag.NewFlagSet("smtp-checker", flag.ContinueOnError)
+		smtp := NewSMTPSettingsFromFlags(fs)
+		args := []string{"-smtp_host", "smtp.example.com", "-smtp_port", "587", "-smtp_auth", "login", "-mail_from", "wordpress@example.com", "-mail_from_name", "WordPress", "-smtp_encryption", "starttls"}
+		if err := fs.Parse(args); err != nil {
+			t.Fatalf("Error parsing flags: %v", err)
+		}
+		if smtp.Host != "smtp.example.com" || smtp.Port != 587 || smtp.Auth != AuthLogin || smtp.From != "wordpress@example.com" || smtp.FromName != "WordPress" || smtp.Encryption != EncryptionSTARTTLS {
+			t.Errorf("Incorrect SMTP settings: %+v", smtp)
+		}
+		if flag.Lookup("smtp_host") != nil {
+			t.Errorf("Flag smtp_host registered in the command line flags")
+		}
+	})
+}
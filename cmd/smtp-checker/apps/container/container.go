@@ -0,0 +1,230 @@
+// Package container provides functions for obtaining the SMTP settings of the
+// applications from the environment variables of the Bitnami containers (e.g.
+// WORDPRESS_SMTP_HOST), for running the checks inside a container or against an
+// env file dumped from it
+package container
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/redact"
+	"github.com/juju/errors"
+)
+
+// Apps contains the applications whose containers are configured with
+// environment variables prefixed with the application name
+var Apps = []string{"redmine", "wordpress"}
+
+// Variables with the SMTP settings, without the application prefix (e.g.
+// WORDPRESS_). Older images use them without prefix (e.g. SMTP_HOST), and
+// SMTP_PORT instead of SMTP_PORT_NUMBER.
+const (
+	varHost      = "SMTP_HOST"
+	varPort      = "SMTP_PORT_NUMBER"
+	varUser      = "SMTP_USER"
+	varPassword  = "SMTP_PASSWORD"
+	varProtocol  = "SMTP_PROTOCOL"
+	varAuth      = "SMTP_AUTH"
+	varFromEmail = "SMTP_FROM_EMAIL"
+	varFromName  = "SMTP_FROM_NAME"
+	legacyPort   = "SMTP_PORT"
+)
+
+// Environ converts a list of variables with the format KEY=value, as returned
+// by os.Environ, into a map
+func Environ(environ []string) map[string]string {
+	env := map[string]string{}
+	for _, kv := range environ {
+		if i := strings.Index(kv, "="); i > 0 {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+	return env
+}
+
+func prefix(app string) string {
+	return strings.ToUpper(app) + "_"
+}
+
+// lookup returns the value of a variable of the application and the name of the
+// variable found. As in the Bitnami containers, a variable with the _FILE suffix
+// contains the path of a file with the value.
+func lookup(env map[string]string, app string, names ...string) (string, string, error) {
+	var candidates []string
+	for _, name := range names {
+		candidates = append(candidates, prefix(app)+name)
+	}
+	candidates = append(candidates, names...)
+	for _, name := range candidates {
+		if v := env[name]; v != "" {
+			return v, name, nil
+		}
+		if path := env[name+"_FILE"]; path != "" {
+			v, err := ioutil.ReadFile(path)
+			if err != nil {
+				return "", name + "_FILE", fmt.Errorf("%s_FILE: %v", name, err)
+			}
+			return strings.TrimRight(string(v), "\r\n"), name + "_FILE", nil
+		}
+	}
+	return "", prefix(app) + names[0], nil
+}
+
+// Variables returns the SMTP variables of the application found in the
+// environment, with the format KEY=value and sorted. The passwords are masked.
+func Variables(app string, env map[string]string) []string {
+	var res []string
+	for name, value := range env {
+		if !strings.HasPrefix(name, prefix(app)+"SMTP_") && !strings.HasPrefix(name, "SMTP_") {
+			continue
+		}
+		if strings.HasSuffix(name, varPassword) && value != "" {
+			value = redact.Mask
+		}
+		res = append(res, name+"="+value)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Detect returns the application whose SMTP host is set in the environment
+func Detect(env map[string]string) (string, error) {
+	var found []string
+	for _, app := range Apps {
+		if env[prefix(app)+varHost] != "" || env[prefix(app)+varHost+"_FILE"] != "" {
+			found = append(found, app)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", errors.Errorf("no SMTP settings of a supported application found in the environment (%s)", strings.Join(hostVars(), ", "))
+	case 1:
+		return found[0], nil
+	default:
+		return "", errors.Errorf("found SMTP settings of several applications in the environment (%s); use '-application' flag to choose one", strings.Join(found, ", "))
+	}
+}
+
+func hostVars() []string {
+	var res []string
+	for _, app := range Apps {
+		res = append(res, prefix(app)+varHost)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Config contains the SMTP settings of an application container
+type Config struct {
+	App       string
+	Host      string
+	Port      int
+	User      string
+	Password  string
+	Protocol  string
+	Auth      string
+	FromEmail string
+	FromName  string
+	// Vars contains the name of the variable each setting was read from
+	Vars map[string]string
+}
+
+// ParseEnv obtains the SMTP settings of the application from the environment
+// variables of its container
+func ParseEnv(app string, env map[string]string) (apps.ApplicationConfig, error) {
+	c := &Config{App: app, Vars: map[string]string{}}
+	fields := map[string]*string{
+		varHost:      &c.Host,
+		varUser:      &c.User,
+		varPassword:  &c.Password,
+		varProtocol:  &c.Protocol,
+		varAuth:      &c.Auth,
+		varFromEmail: &c.FromEmail,
+		varFromName:  &c.FromName,
+	}
+	for v, field := range fields {
+		value, name, err := lookup(env, app, v)
+		if err != nil {
+			return nil, err
+		}
+		*field, c.Vars[v] = value, name
+	}
+	port, name, err := lookup(env, app, varPort, legacyPort)
+	if err != nil {
+		return nil, err
+	}
+	c.Vars[varPort] = name
+	if port != "" {
+		if c.Port, err = strconv.Atoi(port); err != nil {
+			return nil, fmt.Errorf("%s: invalid port %q", name, port)
+		}
+	}
+	redact.Register(c.Password)
+	fmt.Printf("Reading environment variables: %s*\n", prefix(app)+"SMTP_")
+	return c, nil
+}
+
+// encryption returns the encryption mode of the protocol: ssl uses implicit TLS,
+// and tls requires STARTTLS
+func (c *Config) encryption() string {
+	switch strings.ToLower(c.Protocol) {
+	case "ssl":
+		return apps.EncryptionTLS
+	case "tls":
+		return apps.EncryptionSTARTTLS
+	}
+	return apps.EncryptionAuto
+}
+
+// authMechanism returns the authentication mechanism configured, only available
+// in some images (e.g. REDMINE_SMTP_AUTH)
+func (c *Config) authMechanism() string {
+	if c.User == "" {
+		return apps.AuthNone
+	}
+	switch strings.ToLower(c.Auth) {
+	case "plain":
+		return apps.AuthPlain
+	case "login":
+		return apps.AuthLogin
+	case "cram_md5", "cram-md5":
+		return apps.AuthCRAMMD5
+	}
+	return apps.AuthNegotiate
+}
+
+// GetSMTPSettings returns a SMTPSettings from the environment variables
+func (c *Config) GetSMTPSettings() *apps.SMTPSettings {
+	return &apps.SMTPSettings{
+		Host:       c.Host,
+		Port:       c.Port,
+		User:       c.User,
+		Pass:       c.Password,
+		Encryption: c.encryption(),
+		Auth:       c.authMechanism(),
+		From:       c.FromEmail,
+		FromName:   c.FromName,
+	}
+}
+
+// ValidateSMTPSettings checks the SMTPSettings are correct
+func (c *Config) ValidateSMTPSettings() error {
+	if c.Host == "" {
+		return errors.Errorf("%s: empty string", c.Vars[varHost])
+	}
+	if c.Port == 0 {
+		return errors.Errorf("%s: invalid port", c.Vars[varPort])
+	}
+	if c.User != "" && c.Password == "" {
+		return errors.Errorf("%s: empty string", c.Vars[varPassword])
+	}
+	if p := strings.ToLower(c.Protocol); p != "" && p != "ssl" && p != "tls" {
+		return errors.Errorf("%s: %q is not valid (valid values: ssl, tls)", c.Vars[varProtocol], c.Protocol)
+	}
+	return c.GetSMTPSettings().ValidateProvider()
+}
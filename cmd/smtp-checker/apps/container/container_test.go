@@ -0,0 +1,102 @@
+package container
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/redact"
+)
+
+func TestParseEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "container")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	secret := filepath.Join(dir, "smtp-password")
+	ioutil.WriteFile(secret, []byte("file-pass\n"), 0600)
+
+	testData := []struct {
+		name     string
+		app      string
+		env      []string
+		expected apps.SMTPSettings
+	}{
+		{"WordPress", "wordpress", []string{
+			"WORDPRESS_SMTP_HOST=smtp.example.com", "WORDPRESS_SMTP_PORT_NUMBER=465", "WORDPRESS_SMTP_USER=user@example.com",
+			"WORDPRESS_SMTP_PASSWORD=pass", "WORDPRESS_SMTP_PROTOCOL=ssl", "WORDPRESS_SMTP_FROM_EMAIL=blog@example.com", "WORDPRESS_SMTP_FROM_NAME=Blog",
+		}, apps.SMTPSettings{Host: "smtp.example.com", Port: 465, User: "user@example.com", Pass: "pass", Encryption: apps.EncryptionTLS, From: "blog@example.com", FromName: "Blog"}},
+		{"Redmine", "redmine", []string{
+			"REDMINE_SMTP_HOST=smtp.example.com", "REDMINE_SMTP_PORT_NUMBER=587", "REDMINE_SMTP_USER=user@example.com",
+			"REDMINE_SMTP_PASSWORD_FILE=" + secret, "REDMINE_SMTP_PROTOCOL=TLS", "REDMINE_SMTP_AUTH=login",
+		}, apps.SMTPSettings{Host: "smtp.example.com", Port: 587, User: "user@example.com", Pass: "file-pass", Encryption: apps.EncryptionSTARTTLS, Auth: apps.AuthLogin}},
+		{"legacy variables", "wordpress", []string{"SMTP_HOST=relay.example.com", "SMTP_PORT=25"},
+			apps.SMTPSettings{Host: "relay.example.com", Port: 25, Auth: apps.AuthNone}},
+	}
+	for _, tt := range testData {
+		t.Run("Check settings from "+tt.name, func(t *testing.T) {
+			config, err := ParseEnv(tt.app, Environ(tt.env))
+			if err != nil {
+				t.Fatalf("Error parsing environment: %v", err)
+			}
+			if err := config.ValidateSMTPSettings(); err != nil {
+				t.Errorf("Error validating settings: %v", err)
+			}
+			if s := config.GetSMTPSettings(); *s != tt.expected {
+				t.Errorf("Incorrect settings, expected: %+v, got: %+v", tt.expected, *s)
+			}
+		})
+	}
+
+	t.Run("Check invalid settings", func(t *testing.T) {
+		testData := map[string][]string{
+			"WORDPRESS_SMTP_HOST: empty string":        {"WORDPRESS_SMTP_PORT_NUMBER=25"},
+			"WORDPRESS_SMTP_PORT_NUMBER: invalid port": {"WORDPRESS_SMTP_HOST=smtp.example.com"},
+			"WORDPRESS_SMTP_PASSWORD: empty string":    {"WORDPRESS_SMTP_HOST=smtp.example.com", "WORDPRESS_SMTP_PORT_NUMBER=25", "WORDPRESS_SMTP_USER=user"},
+			"WORDPRESS_SMTP_PROTOCOL: \"starttls\"":    {"WORDPRESS_SMTP_HOST=smtp.example.com", "WORDPRESS_SMTP_PORT_NUMBER=25", "WORDPRESS_SMTP_PROTOCOL=starttls"},
+		}
+		for expected, env := range testData {
+			config, err := ParseEnv("wordpress", Environ(env))
+			if err == nil {
+				err = config.ValidateSMTPSettings()
+			}
+			if err == nil || !strings.Contains(err.Error(), expected) {
+				t.Errorf("Incorrect error, expected: %s, got: %v", expected, err)
+			}
+		}
+		if _, err := ParseEnv("wordpress", Environ([]string{"WORDPRESS_SMTP_PORT_NUMBER=smtp"})); err == nil {
+			t.Errorf("Invalid port accepted")
+		}
+	})
+}
+
+func TestDetect(t *testing.T) {
+	t.Run("Check application is detected", func(t *testing.T) {
+		app, err := Detect(Environ([]string{"PATH=/usr/bin", "REDMINE_SMTP_HOST=smtp.example.com"}))
+		if err != nil || app != "redmine" {
+			t.Errorf("Incorrect application, expected: redmine, got: %q (%v)", app, err)
+		}
+	})
+	t.Run("Check ambiguous environments", func(t *testing.T) {
+		if _, err := Detect(Environ([]string{"REDMINE_SMTP_HOST=a", "WORDPRESS_SMTP_HOST=b"})); err == nil {
+			t.Errorf("Several applications accepted")
+		}
+		if _, err := Detect(Environ([]string{"SMTP_HOST=a"})); err == nil {
+			t.Errorf("Environment without application accepted")
+		}
+	})
+}
+
+func TestVariables(t *testing.T) {
+	t.Run("Check SMTP variables of the application are listed", func(t *testing.T) {
+		env := Environ([]string{"PATH=/usr/bin", "WORDPRESS_SMTP_HOST=smtp.example.com", "WORDPRESS_SMTP_PASSWORD=pass", "REDMINE_SMTP_HOST=other", "SMTP_PORT=587", "WORDPRESS_DATABASE_PASSWORD=db"})
+		expected := "SMTP_PORT=587 WORDPRESS_SMTP_HOST=smtp.example.com WORDPRESS_SMTP_PASSWORD=" + redact.Mask
+		if got := strings.Join(Variables("wordpress", env), " "); got != expected {
+			t.Errorf("Incorrect variables, expected: %q, got: %q", expected, got)
+		}
+	})
+}
@@ -0,0 +1,162 @@
+package apps
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Sources of the SMTP credentials, in order of precedence
+const (
+	SourceFlag    = "command line flag"
+	SourceFile    = "password file"
+	SourceEnv     = "environment variable"
+	SourceEnvFile = "env file"
+	SourcePrompt  = "prompt"
+)
+
+// Environment variables containing the SMTP credentials
+const (
+	EnvUser     = "SMTP_USER"
+	EnvPassword = "SMTP_PASSWORD"
+)
+
+// credentialFlags contains the command line flags with alternative sources of
+// the SMTP credentials
+type credentialFlags struct {
+	passwordFile string
+	environment  bool
+	envFile      string
+	prompt       bool
+}
+
+func registerCredentialFlags(fs *flag.FlagSet) *credentialFlags {
+	cf := &credentialFlags{}
+	fs.StringVar(&cf.passwordFile, "smtp_password_file", "", "File containing the SMTP Password")
+	fs.BoolVar(&cf.environment, "smtp_credentials_env", false, fmt.Sprintf("Read the SMTP credentials from the %s and %s environment variables", EnvUser, EnvPassword))
+	fs.StringVar(&cf.envFile, "smtp_env_file", "", fmt.Sprintf("Env file with the SMTP credentials (%s and %s)", EnvUser, EnvPassword))
+	fs.BoolVar(&cf.prompt, "smtp_password_prompt", false, "Ask for the SMTP Password, without echoing it, or read it from the standard input")
+	return cf
+}
+
+// Credential reports the source a SMTP credential was read from
+type Credential struct {
+	// Name is the credential (user or password)
+	Name   string
+	Source string
+	// Location is the flag, file or environment variable containing the credential
+	Location string
+}
+
+func (c Credential) String() string {
+	if c.Location == "" {
+		return fmt.Sprintf("%s: %s", c.Name, c.Source)
+	}
+	return fmt.Sprintf("%s: %s %s", c.Name, c.Source, c.Location)
+}
+
+// readPassword asks for the password in the terminal without echoing it, or
+// reads it from the standard input when it is not a terminal
+var readPassword = func(prompt string) (string, error) {
+	fi, err := os.Stdin.Stat()
+	if err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprint(os.Stderr, prompt)
+		if err := stty("-echo"); err == nil {
+			defer func() {
+				stty("echo")
+				fmt.Fprintln(os.Stderr)
+			}()
+		}
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("error reading the password: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func stty(arg string) error {
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
+
+// LoadCredentials reads the SMTP user and password not provided with flags from
+// the alternative sources set in the command line, in this order of precedence:
+// the password file, the SMTP_USER and SMTP_PASSWORD environment variables (only
+// with -smtp_credentials_env), the env file and the prompt. set contains the flags provided in the command line.
+// It is updated with the credentials found, so they override the profile and the
+// application settings like flags do. The source of each credential is returned.
+func (s *SMTPSettings) LoadCredentials(set map[string]bool) ([]Credential, error) {
+	cf := s.credentialFlags
+	if cf == nil {
+		cf = &credentialFlags{}
+	}
+	// getenv only reads the process environment when requested, as the variables
+	// may be set for other purposes
+	getenv := func(name string) string {
+		if !cf.environment {
+			return ""
+		}
+		return os.Getenv(name)
+	}
+	env := map[string]string{}
+	if cf.envFile != "" {
+		var err error
+		if env, err = ReadEnvFile(cf.envFile); err != nil {
+			return nil, err
+		}
+	}
+	var res []Credential
+	switch {
+	case set["smtp_user"]:
+		res = append(res, Credential{"user", SourceFlag, "-smtp_user"})
+	case getenv(EnvUser) != "":
+		s.User = getenv(EnvUser)
+		res = append(res, Credential{"user", SourceEnv, EnvUser})
+	case env[EnvUser] != "":
+		s.User = env[EnvUser]
+		res = append(res, Credential{"user", SourceEnvFile, cf.envFile})
+	}
+	if len(res) > 0 {
+		set["smtp_user"] = true
+	}
+
+	switch {
+	case set["smtp_password"]:
+		res = append(res, Credential{"password", SourceFlag, "-smtp_password"})
+		return res, nil
+	case cf.passwordFile != "":
+		pass, err := ioutil.ReadFile(cf.passwordFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading password file: %v", err)
+		}
+		s.Pass = strings.TrimRight(string(pass), "\r\n")
+		if s.Pass == "" {
+			return nil, fmt.Errorf("password file %q is empty", cf.passwordFile)
+		}
+		res = append(res, Credential{"password", SourceFile, cf.passwordFile})
+	case getenv(EnvPassword) != "":
+		s.Pass = getenv(EnvPassword)
+		res = append(res, Credential{"password", SourceEnv, EnvPassword})
+	case env[EnvPassword] != "":
+		s.Pass = env[EnvPassword]
+		res = append(res, Credential{"password", SourceEnvFile, cf.envFile})
+	case cf.prompt:
+		pass, err := readPassword("SMTP password: ")
+		if err != nil {
+			return nil, err
+		}
+		s.Pass = pass
+		res = append(res, Credential{"password", SourcePrompt, ""})
+	default:
+		return res, nil
+	}
+	set["smtp_password"] = true
+	return res, nil
+}
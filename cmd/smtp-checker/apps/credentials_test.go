@@ -0,0 +1,109 @@
+package apps
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadEnvFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "env")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	t.Run("Check env file is parsed", func(t *testing.T) {
+		path := filepath.Join(dir, "smtp.env")
+		content := "# SMTP settings\nexport SMTP_USER=user@example.com\nSMTP_PASSWORD=\"p4ss \\\"word\\\"\"\nSINGLE='a # b'\nPLAIN=value # comment\nEMPTY=\n"
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("error writing file: %v", err)
+		}
+		env, err := ReadEnvFile(path)
+		if err != nil {
+			t.Fatalf("Error reading env file: %v", err)
+		}
+		expected := map[string]string{"SMTP_USER": "user@example.com", "SMTP_PASSWORD": `p4ss "word"`, "SINGLE": "a # b", "PLAIN": "value", "EMPTY": ""}
+		for k, v := range expected {
+			if env[k] != v {
+				t.Errorf("Incorrect value of %s, expected: %q, got: %q", k, v, env[k])
+			}
+		}
+	})
+	t.Run("Check invalid lines are reported", func(t *testing.T) {
+		path := filepath.Join(dir, "invalid.env")
+		if err := ioutil.WriteFile(path, []byte("SMTP_USER=user\nnot a variable\n"), 0600); err != nil {
+			t.Fatalf("error writing file: %v", err)
+		}
+		if _, err := ReadEnvFile(path); err == nil {
+			t.Errorf("Invalid env file accepted")
+		}
+	})
+}
+
+func TestLoadCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	passwordFile := filepath.Join(dir, "password")
+	envFile := filepath.Join(dir, "smtp.env")
+	ioutil.WriteFile(passwordFile, []byte("file-pass\n"), 0600)
+	ioutil.WriteFile(envFile, []byte("SMTP_USER=envfile-user\nSMTP_PASSWORD=envfile-pass\n"), 0600)
+	defer os.Unsetenv(EnvUser)
+	defer os.Unsetenv(EnvPassword)
+	defer func(f func(string) (string, error)) { readPassword = f }(readPassword)
+	readPassword = func(string) (string, error) { return "prompt-pass", nil }
+
+	testData := []struct {
+		name     string
+		set      map[string]bool
+		flags    credentialFlags
+		env      map[string]string
+		user     string
+		pass     string
+		source   string
+		location string
+	}{
+		{"flags", map[string]bool{"smtp_user": true, "smtp_password": true}, credentialFlags{passwordFile: passwordFile, prompt: true}, map[string]string{EnvPassword: "env-pass"}, "flag-user", "flag-pass", SourceFlag, "-smtp_password"},
+		{"password file", map[string]bool{}, credentialFlags{passwordFile: passwordFile, environment: true, envFile: envFile}, map[string]string{EnvUser: "env-user", EnvPassword: "env-pass"}, "env-user", "file-pass", SourceFile, passwordFile},
+		{"environment", map[string]bool{}, credentialFlags{environment: true, envFile: envFile, prompt: true}, map[string]string{EnvPassword: "env-pass"}, "envfile-user", "env-pass", SourceEnv, EnvPassword},
+		{"env file, ignoring the environment", map[string]bool{}, credentialFlags{envFile: envFile}, map[string]string{EnvUser: "env-user", EnvPassword: "env-pass"}, "envfile-user", "envfile-pass", SourceEnvFile, envFile},
+		{"env file", map[string]bool{}, credentialFlags{envFile: envFile, prompt: true}, nil, "envfile-user", "envfile-pass", SourceEnvFile, envFile},
+		{"prompt", map[string]bool{"smtp_user": true}, credentialFlags{prompt: true}, nil, "flag-user", "prompt-pass", SourcePrompt, ""},
+	}
+	for _, tt := range testData {
+		t.Run("Check credentials from "+tt.name, func(t *testing.T) {
+			os.Unsetenv(EnvUser)
+			os.Unsetenv(EnvPassword)
+			for k, v := range tt.env {
+				os.Setenv(k, v)
+			}
+			flags := tt.flags
+			s := &SMTPSettings{User: "flag-user", Pass: "flag-pass", credentialFlags: &flags}
+			credentials, err := s.LoadCredentials(tt.set)
+			if err != nil {
+				t.Fatalf("Error loading credentials: %v", err)
+			}
+			if s.User != tt.user || s.Pass != tt.pass {
+				t.Errorf("Incorrect credentials, expected: %s/%s, got: %s/%s", tt.user, tt.pass, s.User, s.Pass)
+			}
+			last := credentials[len(credentials)-1]
+			if last.Name != "password" || last.Source != tt.source || last.Location != tt.location {
+				t.Errorf("Incorrect source, expected: %s %s, got: %v", tt.source, tt.location, last)
+			}
+			if !tt.set["smtp_user"] || !tt.set["smtp_password"] {
+				t.Errorf("Credentials not marked as set: %v", tt.set)
+			}
+		})
+	}
+	t.Run("Check empty password file", func(t *testing.T) {
+		empty := filepath.Join(dir, "empty")
+		ioutil.WriteFile(empty, []byte("\n"), 0600)
+		s := &SMTPSettings{credentialFlags: &credentialFlags{passwordFile: empty}}
+		if _, err := s.LoadCredentials(map[string]bool{}); err == nil {
+			t.Errorf("Empty password file accepted")
+		}
+	})
+}
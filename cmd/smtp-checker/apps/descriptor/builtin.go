@@ -0,0 +1,59 @@
+package descriptor
+
+// builtin contains the descriptors of the supported applications, by name
+var builtin = map[string]string{
+	"redmine": `
+name: redmine
+config_file: apps/redmine/htdocs/config/configuration.yml
+format: yaml
+settings:
+  host: default.email_delivery.smtp_settings.address
+  port: default.email_delivery.smtp_settings.port
+  user: default.email_delivery.smtp_settings.user_name
+  password: default.email_delivery.smtp_settings.password
+  auth: default.email_delivery.smtp_settings.authentication
+values:
+  auth:
+    plain: plain
+    ":plain": plain
+    login: login
+    ":login": login
+    cram_md5: cram-md5
+    ":cram_md5": cram-md5
+expect:
+  - key: default.email_delivery.delivery_method
+    values: ["smtp", ":smtp"]
+`,
+	"wordpress": `
+name: wordpress
+config_file: apps/wordpress/htdocs/wp-config.php
+format: database
+database:
+  format: php_define
+  host: DB_HOST
+  name: DB_NAME
+  user: DB_USER
+  password: DB_PASSWORD
+  table: wp_options
+  column: option_value
+  key: option_name
+  value: wp_mail_smtp
+  value_format: php_serialize
+settings:
+  host: smtp.host
+  port: smtp.port
+  user: smtp.user
+  password: smtp.pass
+  encryption: smtp.encryption
+  from: mail.from_email
+  from_name: mail.from_name
+values:
+  encryption:
+    ssl: tls
+    tls: starttls
+    none: ""
+expect:
+  - key: mail.mailer
+    values: ["smtp"]
+`,
+}
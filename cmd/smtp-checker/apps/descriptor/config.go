@@ -0,0 +1,163 @@
+package descriptor
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/mysql"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/redact"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/timeout"
+	"github.com/juju/errors"
+)
+
+// defaultDatabasePort is used when the credentials do not include the port
+const defaultDatabasePort = 3306
+
+// Config contains the configuration of an application obtained with a descriptor
+type Config struct {
+	Descriptor *Descriptor
+	doc        document
+}
+
+// value returns the setting with the key as a string, or an empty string if the
+// key is empty or not found
+func (c *Config) value(key string) string {
+	if key == "" {
+		return ""
+	}
+	v, _ := c.doc.lookup(key)
+	return toString(v)
+}
+
+// mapped maps the value of the encryption or auth setting, if the descriptor
+// contains a mapping for it
+func (c *Config) mapped(setting, value string) string {
+	if v, ok := c.Descriptor.Values[setting][value]; ok {
+		return v
+	}
+	return value
+}
+
+// GetSMTPSettings returns a SMTPSettings from the settings found
+func (c *Config) GetSMTPSettings() *apps.SMTPSettings {
+	s := c.Descriptor.Settings
+	port, _ := strconv.Atoi(c.value(s.Port))
+	settings := &apps.SMTPSettings{
+		Host:       c.value(s.Host),
+		Port:       port,
+		User:       c.value(s.User),
+		Pass:       c.value(s.Password),
+		Encryption: c.mapped("encryption", c.value(s.Encryption)),
+		Auth:       c.mapped("auth", c.value(s.Auth)),
+		From:       c.value(s.From),
+		FromName:   c.value(s.FromName),
+	}
+	if settings.User == "" {
+		settings.Auth = apps.AuthNone
+	}
+	return settings
+}
+
+// ValidateSMTPSettings checks the SMTPSettings are correct. Errors refer to the
+// keys of the configuration.
+func (c *Config) ValidateSMTPSettings() error {
+	s := c.Descriptor.Settings
+	if c.value(s.Host) == "" {
+		return errors.Errorf("%s: empty string", s.Host)
+	}
+	if port, err := strconv.Atoi(c.value(s.Port)); err != nil || port <= 0 {
+		return errors.Errorf("%s: invalid port", s.Port)
+	}
+	if s.User != "" && c.value(s.User) != "" && c.value(s.Password) == "" {
+		return errors.Errorf("%s: empty string", s.Password)
+	}
+	for _, e := range c.Descriptor.Expect {
+		if v := c.value(e.Key); !contains(e.Values, v) {
+			return errors.Errorf("%s: %q is not valid (expected: %s)", e.Key, v, strings.Join(e.Values, ", "))
+		}
+	}
+	settings := c.GetSMTPSettings()
+	if err := settings.ValidateEncryption(); err != nil {
+		return errors.Annotate(err, s.Encryption)
+	}
+	if settings.Auth != "" && !contains(apps.AuthMechanisms, settings.Auth) {
+		return errors.Errorf("%s: %q is not a supported authentication mechanism", s.Auth, c.value(s.Auth))
+	}
+	return settings.ValidateProvider()
+}
+
+// database returns the database credentials found in the document
+func (db *Database) database(doc document) (mysql.Database, error) {
+	value := func(key string) string {
+		if key == "" {
+			return ""
+		}
+		v, _ := doc.lookup(key)
+		return toString(v)
+	}
+	res := mysql.Database{
+		Host: value(db.Host),
+		Name: value(db.Name),
+		User: value(db.User),
+		Pass: value(db.Password),
+		Port: defaultDatabasePort,
+	}
+	if host, port, err := net.SplitHostPort(res.Host); err == nil {
+		res.Host = host
+		if res.Port, err = strconv.Atoi(port); err != nil {
+			return res, errors.Errorf("%s: invalid port %q", db.Host, port)
+		}
+	}
+	if p := value(db.Port); p != "" {
+		var err error
+		if res.Port, err = strconv.Atoi(p); err != nil {
+			return res, errors.Errorf("%s: invalid port %q", db.Port, p)
+		}
+	}
+	if res.Host == "" || res.Name == "" || res.User == "" {
+		return res, errors.Errorf("database credentials not found (%s, %s, %s)", db.Host, db.Name, db.User)
+	}
+	return res, nil
+}
+
+// Obtain reads the configuration of the application installed in installDir
+func (d *Descriptor) Obtain(ctx context.Context, installDir string) (apps.ApplicationConfig, error) {
+	path := filepath.Join(installDir, d.ConfigFile)
+	source, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Errorf("error reading config file: %v", err)
+	}
+	fmt.Printf("Reading config file: %q\n", path)
+	format := d.Format
+	if d.Format == FormatDatabase {
+		format = d.Database.Format
+	}
+	doc, err := parse(format, source)
+	if err != nil {
+		return nil, errors.Errorf("error parsing config file: %v", err)
+	}
+	if d.Format == FormatDatabase {
+		database, err := d.Database.database(doc)
+		if err != nil {
+			return nil, errors.Errorf("error parsing config file: %v", err)
+		}
+		redact.Register(database.Pass)
+		query := mysql.Query{Table: d.Database.Table, Column: d.Database.Column, Key: d.Database.Key, Value: d.Database.Value}
+		result, err := database.MySQLQuery(ctx, query)
+		if err != nil {
+			return nil, timeout.Wrap(ctx, fmt.Sprintf("querying the %s settings", d.Name), err)
+		}
+		if doc, err = parse(d.Database.ValueFormat, []byte(result)); err != nil {
+			return nil, errors.Errorf("error parsing the %s settings: %v", d.Name, err)
+		}
+	}
+	c := &Config{Descriptor: d, doc: doc}
+	redact.Register(c.value(d.Settings.Password))
+	return c, nil
+}
@@ -0,0 +1,215 @@
+// Package descriptor provides functions for obtaining the SMTP settings of the
+// applications described by declarative YAML descriptors, which state the
+// configuration file, its format and where each setting is found
+package descriptor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/mmikulicic/multierror"
+)
+
+// Formats of the configuration files
+const (
+	// FormatYAML and FormatJSON find the settings by key path (e.g. production.smtp.host)
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+	// FormatPHPDefine finds the settings by the name of the PHP constant (e.g. SMTP_HOST)
+	FormatPHPDefine = "php_define"
+	// FormatINI finds the settings by section and key (e.g. mail.host)
+	FormatINI = "ini"
+	// FormatDatabase reads the database credentials from the configuration file
+	// and finds the settings in the value returned by a query
+	FormatDatabase = "database"
+	// FormatPHPSerialize is only valid for the values returned by queries
+	FormatPHPSerialize = "php_serialize"
+)
+
+// BuiltinSource is the source of the descriptors shipped with the tool
+const BuiltinSource = "built-in"
+
+// Formats contains the valid formats of the configuration files
+var Formats = []string{FormatYAML, FormatJSON, FormatPHPDefine, FormatINI, FormatDatabase}
+
+// valueFormats contains the valid formats of the values returned by queries
+var valueFormats = []string{FormatYAML, FormatJSON, FormatPHPSerialize}
+
+// Descriptor describes how to obtain the SMTP settings of an application
+type Descriptor struct {
+	// Name identifies the application, as used in the -application flag
+	Name string `json:"name"`
+	// ConfigFile is the configuration file, relative to the installation directory
+	ConfigFile string `json:"config_file"`
+	Format     string `json:"format"`
+	// Database contains the query of the settings, for the database format
+	Database *Database `json:"database"`
+	// Settings contains the key of each setting in the configuration
+	Settings Settings `json:"settings"`
+	// Values maps the values of the encryption and auth settings in the
+	// configuration to the ones of the SMTP checks (e.g. ssl: tls)
+	Values map[string]map[string]string `json:"values"`
+	// Expect contains other settings that must have specific values
+	Expect []Expectation `json:"expect"`
+
+	// Source is the file the descriptor was loaded from, or BuiltinSource
+	Source string `json:"-"`
+}
+
+// Settings contains the key of each SMTP setting in the configuration. Empty
+// keys mean the application does not configure the setting.
+type Settings struct {
+	Host       string `json:"host"`
+	Port       string `json:"port"`
+	User       string `json:"user"`
+	Password   string `json:"password"`
+	Encryption string `json:"encryption"`
+	Auth       string `json:"auth"`
+	From       string `json:"from"`
+	FromName   string `json:"from_name"`
+}
+
+// Database contains the keys of the database credentials in the configuration
+// file and the query returning the SMTP settings
+type Database struct {
+	// Format is the format of the configuration file with the credentials
+	Format string `json:"format"`
+	// Host may include the port (e.g. localhost:3306)
+	Host     string `json:"host"`
+	Port     string `json:"port"`
+	Name     string `json:"name"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+	// The query selects Column from Table where Key is Value
+	Table  string `json:"table"`
+	Column string `json:"column"`
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	// ValueFormat is the format of the value returned by the query
+	ValueFormat string `json:"value_format"`
+}
+
+// Expectation requires a setting to have one of the values
+type Expectation struct {
+	Key    string   `json:"key"`
+	Values []string `json:"values"`
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the descriptor is complete
+func (d *Descriptor) Validate() error {
+	var errs error
+	if d.Name == "" {
+		errs = multierror.Append(errs, fmt.Errorf("name: empty string"))
+	}
+	if d.ConfigFile == "" {
+		errs = multierror.Append(errs, fmt.Errorf("config_file: empty string"))
+	}
+	if !contains(Formats, d.Format) {
+		errs = multierror.Append(errs, fmt.Errorf("format: %q is not valid (valid values: %s)", d.Format, strings.Join(Formats, ", ")))
+	}
+	if d.Format == FormatDatabase {
+		if d.Database == nil {
+			errs = multierror.Append(errs, fmt.Errorf("database: required with the database format"))
+		} else {
+			db := d.Database
+			if !contains(Formats, db.Format) || db.Format == FormatDatabase {
+				errs = multierror.Append(errs, fmt.Errorf("database.format: %q is not valid", db.Format))
+			}
+			if !contains(valueFormats, db.ValueFormat) {
+				errs = multierror.Append(errs, fmt.Errorf("database.value_format: %q is not valid (valid values: %s)", db.ValueFormat, strings.Join(valueFormats, ", ")))
+			}
+			for field, v := range map[string]string{"host": db.Host, "name": db.Name, "user": db.User, "table": db.Table, "column": db.Column, "key": db.Key, "value": db.Value} {
+				if v == "" {
+					errs = multierror.Append(errs, fmt.Errorf("database.%s: empty string", field))
+				}
+			}
+		}
+	}
+	if d.Settings.Host == "" {
+		errs = multierror.Append(errs, fmt.Errorf("settings.host: empty string"))
+	}
+	if d.Settings.Port == "" {
+		errs = multierror.Append(errs, fmt.Errorf("settings.port: empty string"))
+	}
+	for setting := range d.Values {
+		if setting != "encryption" && setting != "auth" {
+			errs = multierror.Append(errs, fmt.Errorf("values.%s: only the encryption and auth values can be mapped", setting))
+		}
+	}
+	for i, e := range d.Expect {
+		if e.Key == "" || len(e.Values) == 0 {
+			errs = multierror.Append(errs, fmt.Errorf("expect[%d]: key and values are required", i))
+		}
+	}
+	return errs
+}
+
+// Parse parses and validates a YAML descriptor
+func Parse(source []byte) (*Descriptor, error) {
+	d := &Descriptor{}
+	if err := yaml.Unmarshal(source, d); err != nil {
+		return nil, fmt.Errorf("error parsing descriptor: %v", err)
+	}
+	if err := d.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid descriptor: %v", err)
+	}
+	return d, nil
+}
+
+// Load reads the descriptors (*.yaml or *.yml files) of a directory
+func Load(dir string) ([]*Descriptor, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading descriptors directory: %v", err)
+	}
+	var res []*Descriptor
+	for _, f := range files {
+		if f.IsDir() || (filepath.Ext(f.Name()) != ".yaml" && filepath.Ext(f.Name()) != ".yml") {
+			continue
+		}
+		path := filepath.Join(dir, f.Name())
+		source, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading descriptor: %v", err)
+		}
+		d, err := Parse(source)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		d.Source = path
+		res = append(res, d)
+	}
+	return res, nil
+}
+
+// Builtin returns the descriptors shipped with the tool, sorted by name
+func Builtin() []*Descriptor {
+	var names []string
+	for name := range builtin {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var res []*Descriptor
+	for _, name := range names {
+		d, err := Parse([]byte(builtin[name]))
+		if err != nil {
+			panic(fmt.Sprintf("built-in descriptor %s: %v", name, err))
+		}
+		d.Source = BuiltinSource
+		res = append(res, d)
+	}
+	return res
+}
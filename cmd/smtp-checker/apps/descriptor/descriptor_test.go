@@ -0,0 +1,166 @@
+package descriptor
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps"
+)
+
+func TestParseFormats(t *testing.T) {
+	testData := []struct {
+		format   string
+		source   string
+		key      string
+		expected string
+	}{
+		{FormatYAML, "production:\n  smtp:\n    host: smtp.example.com\n", "production.smtp.host", "smtp.example.com"},
+		{FormatYAML, "servers:\n  - port: 587\n", "servers.0.port", "587"},
+		{FormatJSON, `{"mail": {"options": {"port": 465, "secure": true}}}`, "mail.options.secure", "true"},
+		{FormatPHPDefine, "<?php\ndefine( 'SMTP_HOST', 'smtp.example.com' );\ndefine('SMTP_PORT', 25);\n", "SMTP_HOST", "smtp.example.com"},
+		{FormatPHPDefine, "<?php\ndefine(\"SMTP_PASS\", \"it's\");\n", "SMTP_PASS", "it's"},
+		{FormatINI, "; comment\nglobal = 1\n[mail]\nhost = \"smtp.example.com\"\n", "mail.host", "smtp.example.com"},
+		{FormatINI, "global = 1\n[mail]\nhost = smtp.example.com\n", "global", "1"},
+		{FormatPHPSerialize, `a:1:{s:4:"smtp";a:1:{s:4:"port";i:587;}}`, "smtp.port", "587"},
+	}
+	for _, tt := range testData {
+		t.Run("Check "+tt.format+" key "+tt.key, func(t *testing.T) {
+			doc, err := parse(tt.format, []byte(tt.source))
+			if err != nil {
+				t.Fatalf("Error parsing source: %v", err)
+			}
+			v, ok := doc.lookup(tt.key)
+			if !ok || toString(v) != tt.expected {
+				t.Errorf("Incorrect value, expected: %q, got: %q", tt.expected, toString(v))
+			}
+		})
+	}
+	t.Run("Check missing keys", func(t *testing.T) {
+		doc, _ := parse(FormatYAML, []byte("smtp:\n  host: a\n"))
+		for _, key := range []string{"smtp.port", "smtp.host.name", "mail"} {
+			if _, ok := doc.lookup(key); ok {
+				t.Errorf("Missing key %q found", key)
+			}
+		}
+	})
+}
+
+func TestParse(t *testing.T) {
+	t.Run("Check built-in descriptors", func(t *testing.T) {
+		names := []string{}
+		for _, d := range Builtin() {
+			names = append(names, d.Name)
+			if d.Source != BuiltinSource {
+				t.Errorf("Incorrect source, expected: %s, got: %s", BuiltinSource, d.Source)
+			}
+		}
+		if got := strings.Join(names, ","); got != "redmine,wordpress" {
+			t.Errorf("Incorrect descriptors, expected: redmine,wordpress, got: %s", got)
+		}
+	})
+	t.Run("Check invalid descriptors", func(t *testing.T) {
+		testData := map[string]string{
+			"name: empty string":           "config_file: a\nformat: yaml\nsettings: {host: h, port: p}",
+			"format: \"xml\" is not valid": "name: a\nconfig_file: a\nformat: xml\nsettings: {host: h, port: p}",
+			"database: required":           "name: a\nconfig_file: a\nformat: database\nsettings: {host: h, port: p}",
+			"database.table: empty string": "name: a\nconfig_file: a\nformat: database\ndatabase: {format: ini, host: h, name: n, user: u, column: c, key: k, value: v, value_format: json}\nsettings: {host: h, port: p}",
+			"settings.port: empty string":  "name: a\nconfig_file: a\nformat: ini\nsettings: {host: h}",
+			"values.user: only the":        "name: a\nconfig_file: a\nformat: ini\nsettings: {host: h, port: p}\nvalues: {user: {a: b}}",
+			"expect[0]: key and values":    "name: a\nconfig_file: a\nformat: ini\nsettings: {host: h, port: p}\nexpect: [{key: k}]",
+			"error parsing descriptor":     "name: [a",
+		}
+		for expected, source := range testData {
+			if _, err := Parse([]byte(source)); err == nil || !strings.Contains(err.Error(), expected) {
+				t.Errorf("Incorrect error, expected: %s, got: %v", expected, err)
+			}
+		}
+	})
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "descriptor")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "myapp.yaml"), []byte("name: myapp\nconfig_file: conf/mail.ini\nformat: ini\nsettings: {host: mail.host, port: mail.port}\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not a descriptor"), 0644)
+
+	t.Run("Check descriptors are loaded", func(t *testing.T) {
+		found, err := Load(dir)
+		if err != nil {
+			t.Fatalf("Error loading descriptors: %v", err)
+		}
+		if len(found) != 1 || found[0].Name != "myapp" || found[0].Source != filepath.Join(dir, "myapp.yaml") {
+			t.Errorf("Incorrect descriptors, expected: myapp, got: %+v", found)
+		}
+	})
+	t.Run("Check invalid descriptors are reported", func(t *testing.T) {
+		ioutil.WriteFile(filepath.Join(dir, "broken.yml"), []byte("name: broken\n"), 0644)
+		if _, err := Load(dir); err == nil || !strings.Contains(err.Error(), "broken.yml") {
+			t.Errorf("Incorrect error, expected: broken.yml, got: %v", err)
+		}
+	})
+}
+
+func TestObtain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "descriptor")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	descriptors := map[string]*Descriptor{}
+	for _, d := range Builtin() {
+		descriptors[d.Name] = d
+	}
+	config := filepath.Join(dir, descriptors["redmine"].ConfigFile)
+	os.MkdirAll(filepath.Dir(config), 0755)
+
+	write := func(method string) {
+		ioutil.WriteFile(config, []byte(`default:
+  email_delivery:
+    delivery_method: `+method+`
+    smtp_settings:
+      address: smtp.example.com
+      port: 587
+      authentication: :login
+      user_name: user@example.com
+      password: pass
+`), 0644)
+	}
+
+	t.Run("Check settings are obtained", func(t *testing.T) {
+		write(":smtp")
+		c, err := descriptors["redmine"].Obtain(context.Background(), dir)
+		if err != nil {
+			t.Fatalf("Error obtaining config: %v", err)
+		}
+		if err := c.ValidateSMTPSettings(); err != nil {
+			t.Errorf("Error validating settings: %v", err)
+		}
+		expected := apps.SMTPSettings{Host: "smtp.example.com", Port: 587, User: "user@example.com", Pass: "pass", Auth: apps.AuthLogin}
+		if s := c.GetSMTPSettings(); *s != expected {
+			t.Errorf("Incorrect settings, expected: %+v, got: %+v", expected, *s)
+		}
+	})
+	t.Run("Check expected values", func(t *testing.T) {
+		write(":sendmail")
+		c, err := descriptors["redmine"].Obtain(context.Background(), dir)
+		if err != nil {
+			t.Fatalf("Error obtaining config: %v", err)
+		}
+		expected := "default.email_delivery.delivery_method"
+		if err := c.ValidateSMTPSettings(); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Incorrect error, expected: %s, got: %v", expected, err)
+		}
+	})
+	t.Run("Check missing config file", func(t *testing.T) {
+		if _, err := descriptors["wordpress"].Obtain(context.Background(), dir); err == nil {
+			t.Errorf("Missing config file accepted")
+		}
+	})
+}
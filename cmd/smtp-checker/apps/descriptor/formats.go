@@ -0,0 +1,178 @@
+package descriptor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/yvasiyarov/php_session_decoder/php_serialize"
+)
+
+// document is a parsed configuration, where the settings are found by key
+type document interface {
+	lookup(key string) (interface{}, bool)
+}
+
+// tree is a configuration with nested values, found by key path (e.g. a.b.0.c)
+type tree struct {
+	root interface{}
+}
+
+func (t tree) lookup(key string) (interface{}, bool) {
+	v := t.root
+	for _, k := range strings.Split(key, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			child, ok := node[k]
+			if !ok {
+				return nil, false
+			}
+			v = child
+		case []interface{}:
+			i, err := strconv.Atoi(k)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// flat is a configuration with the settings found by name
+type flat map[string]interface{}
+
+func (f flat) lookup(key string) (interface{}, bool) {
+	v, ok := f[key]
+	return v, ok
+}
+
+// parse parses a configuration with the format
+func parse(format string, source []byte) (document, error) {
+	switch format {
+	case FormatYAML, FormatJSON:
+		j, err := yaml.YAMLToJSON(source)
+		if err != nil {
+			return nil, err
+		}
+		var root interface{}
+		d := json.NewDecoder(bytes.NewReader(j))
+		d.UseNumber()
+		if err := d.Decode(&root); err != nil {
+			return nil, err
+		}
+		return tree{root}, nil
+	case FormatPHPDefine:
+		return parsePHPDefine(source)
+	case FormatINI:
+		return parseINI(source)
+	case FormatPHPSerialize:
+		v, err := php_serialize.NewUnSerializer(string(source)).Decode()
+		if err != nil {
+			return nil, fmt.Errorf("error while decoding object value: %v", err)
+		}
+		return tree{fromPHP(v)}, nil
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+// fromPHP converts the PHP arrays into maps with string keys
+func fromPHP(v php_serialize.PhpValue) interface{} {
+	array, ok := v.(php_serialize.PhpArray)
+	if !ok {
+		return v
+	}
+	res := map[string]interface{}{}
+	for k, child := range array {
+		res[fmt.Sprint(k)] = fromPHP(child)
+	}
+	return res
+}
+
+// defineRe matches the PHP constants defined with define('NAME', value);
+var defineRe = regexp.MustCompile(`(?m)^\s*define\(\s*['"]([^'"]+)['"]\s*,\s*(.*?)\s*\)\s*;`)
+
+func parsePHPDefine(source []byte) (document, error) {
+	res := flat{}
+	for _, m := range defineRe.FindAllStringSubmatch(string(source), -1) {
+		res[m[1]] = phpLiteral(m[2])
+	}
+	return res, nil
+}
+
+// phpLiteral returns the value of a PHP string, boolean or number literal. Other
+// expressions are returned as is.
+func phpLiteral(s string) interface{} {
+	switch {
+	case len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'':
+		return strings.NewReplacer(`\'`, `'`, `\\`, `\`).Replace(s[1 : len(s)-1])
+	case len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"':
+		if v, err := strconv.Unquote(s); err == nil {
+			return v
+		}
+		return s[1 : len(s)-1]
+	case strings.EqualFold(s, "true"):
+		return true
+	case strings.EqualFold(s, "false"):
+		return false
+	case strings.EqualFold(s, "null"):
+		return nil
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return json.Number(s)
+	}
+	return s
+}
+
+// parseINI parses an INI file. The keys of the sections are prefixed with the
+// section name (e.g. mail.host).
+func parseINI(source []byte) (document, error) {
+	res := flat{}
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(source))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("line %d does not follow the format key = value", n)
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		if section != "" {
+			key = section + "." + key
+		}
+		res[key] = value
+	}
+	return res, scanner.Err()
+}
+
+// toString converts a setting to a string
+func toString(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case bool:
+		return strconv.FormatBool(value)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
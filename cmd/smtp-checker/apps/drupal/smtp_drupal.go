@@ -0,0 +1,221 @@
+package drupal
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps/php"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/mysql"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/redact"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/timeout"
+	"github.com/juju/errors"
+)
+
+const (
+	// ConfigFilePath is the path of the configuration file, relative to the installation directory
+	ConfigFilePath = "apps/drupal/htdocs/sites/default/settings.php"
+	// defaultDatabasePort is used when settings.php does not include the port
+	defaultDatabasePort = 3306
+	// smtpModule is the name of the SMTP Authentication Support module
+	smtpModule = "smtp"
+)
+
+// Config is a structure that contains the settings of the
+// SMTP module (smtp.settings configuration object)
+type Config struct {
+	// Enabled is the "Turn this module on or off" setting
+	Enabled  bool
+	Host     string
+	Port     int
+	Protocol string
+	AutoTLS  bool
+	User     string
+	Pass     string
+	From     string
+	FromName string
+}
+
+// GetSMTPSettings returns a SMTPSettings from Config structure
+func (c Config) GetSMTPSettings() *apps.SMTPSettings {
+	return &apps.SMTPSettings{
+		Host:       c.Host,
+		Port:       c.Port,
+		User:       c.User,
+		Pass:       c.Pass,
+		Encryption: c.encryption(),
+		Auth:       c.authMechanism(),
+		From:       c.From,
+		FromName:   c.FromName,
+	}
+}
+
+// authMechanism returns the authentication mechanism used by the SMTP module,
+// which only authenticates when a username is configured
+func (c Config) authMechanism() string {
+	if c.User == "" {
+		return apps.AuthNone
+	}
+	return ""
+}
+
+// encryption returns the encryption mode used by the SMTP module
+func (c Config) encryption() string {
+	switch c.Protocol {
+	case "ssl":
+		return apps.EncryptionTLS
+	case "tls":
+		return apps.EncryptionSTARTTLS
+	}
+	// The standard protocol upgrades the connection when autotls is enabled
+	if !c.AutoTLS {
+		return apps.EncryptionNone
+	}
+	return apps.EncryptionAuto
+}
+
+// ValidateSMTPSettings checks the SMTPSettings are correct
+func (c *Config) ValidateSMTPSettings() error {
+	if !c.Enabled {
+		return errors.New("smtp_on: the SMTP module is turned off, so Drupal does not send mail via SMTP")
+	}
+	if c.Host == "" {
+		return errors.New("smtp_host: empty string")
+	}
+	if c.Port <= 0 {
+		return errors.New("smtp_port: invalid port")
+	}
+	if c.Protocol != "" && c.Protocol != "standard" && c.Protocol != "ssl" && c.Protocol != "tls" {
+		return errors.Errorf("smtp_protocol: %q is not valid (valid values: standard, ssl, tls)", c.Protocol)
+	}
+	if c.User != "" && c.Pass == "" {
+		return errors.New("smtp_password: empty string")
+	}
+	return c.GetSMTPSettings().ValidateProvider()
+}
+
+// database contains the credentials of the Drupal database and the prefix of
+// its tables
+type database struct {
+	mysql.Database
+	Prefix string
+}
+
+// parseDrupalDatabaseConfig reads the default connection of the $databases
+// array of settings.php
+func parseDrupalDatabaseConfig(configFile string) (database, error) {
+	source, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return database{}, errors.Errorf("error reading config file: %v", err)
+	}
+	connection, ok := php.Lookup(php.Assignments(source), "databases", "default", "default")
+	if !ok {
+		return database{}, errors.New("$databases['default']['default'] not found")
+	}
+	value := func(key string) string {
+		v, _ := php.Lookup(connection, key)
+		return php.String(v)
+	}
+	if driver := value("driver"); driver != "" && driver != "mysql" {
+		return database{}, errors.Errorf("unsupported database driver %q", driver)
+	}
+	db := database{Database: mysql.Database{
+		Host: value("host"),
+		Port: defaultDatabasePort,
+		Name: value("database"),
+		User: value("username"),
+		Pass: value("password"),
+	}}
+	if port := value("port"); port != "" {
+		if db.Port, err = strconv.Atoi(port); err != nil {
+			return database{}, errors.Errorf("invalid database port %q", port)
+		}
+	}
+	// The prefix may be set per table, with the default one in the "default" key
+	if prefix, ok := php.Lookup(connection, "prefix", "default"); ok {
+		db.Prefix = php.String(prefix)
+	} else {
+		db.Prefix = value("prefix")
+	}
+	if db.Host == "" || db.Name == "" || db.User == "" {
+		return database{}, errors.New("incomplete database credentials (host, database and username are required)")
+	}
+	return db, nil
+}
+
+// configObject returns the configuration object with the name, stored
+// serialized in the config table
+func configObject(ctx context.Context, db database, name string) (interface{}, error) {
+	query := mysql.Query{
+		Table:  db.Prefix + "config",
+		Column: "data",
+		Key:    "name",
+		Value:  name,
+	}
+	queryResult, err := db.MySQLQuery(ctx, query)
+	if err != nil {
+		return nil, timeout.Wrap(ctx, "querying the "+name+" configuration", err)
+	}
+	return php.Unserialize(queryResult)
+}
+
+// checkModule checks the SMTP module is installed, according to the
+// core.extension configuration object
+func checkModule(extensions interface{}) error {
+	if _, ok := php.Lookup(extensions, "module", smtpModule); !ok {
+		return errors.New("smtp module not installed")
+	}
+	return nil
+}
+
+// obtainSMTP reads the smtp.settings configuration object
+func obtainSMTP(settings interface{}, config *Config) error {
+	if _, ok := settings.(php.Array); !ok {
+		return errors.Errorf("unable to convert %T to array", settings)
+	}
+	value := func(key string) interface{} {
+		v, _ := php.Lookup(settings, key)
+		return v
+	}
+	config.Enabled = php.Bool(value("smtp_on"))
+	config.Host = php.String(value("smtp_host"))
+	config.Protocol = php.String(value("smtp_protocol"))
+	config.AutoTLS = php.Bool(value("smtp_autotls"))
+	config.User = php.String(value("smtp_username"))
+	config.Pass = php.String(value("smtp_password"))
+	config.From = php.String(value("smtp_from"))
+	config.FromName = php.String(value("smtp_fromname"))
+	if port := php.String(value("smtp_port")); port != "" {
+		var err error
+		if config.Port, err = strconv.Atoi(port); err != nil {
+			return errors.Errorf("smtp_port: invalid port %q", port)
+		}
+	}
+	return nil
+}
+
+// QueryConfig obtains an ApplicationConfig by querying the MySQL database
+func QueryConfig(ctx context.Context, installDir string) (apps.ApplicationConfig, error) {
+	config := Config{}
+	db, err := parseDrupalDatabaseConfig(filepath.Join(installDir, ConfigFilePath))
+	if err != nil {
+		return nil, errors.Errorf("error parsing settings.php file: %v", err)
+	}
+	redact.Register(db.Pass)
+	extensions, err := configObject(ctx, db, "core.extension")
+	if err == nil {
+		err = checkModule(extensions)
+	}
+	if err != nil {
+		return nil, errors.Errorf("error checking smtp module: %v", err)
+	}
+	settings, err := configObject(ctx, db, "smtp.settings")
+	if err != nil {
+		return nil, errors.Errorf("error obtaining smtp module settings: %v", err)
+	}
+	err = obtainSMTP(settings, &config)
+	redact.Register(config.Pass)
+	return &config, err
+}
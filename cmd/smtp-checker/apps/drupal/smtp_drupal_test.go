@@ -0,0 +1,142 @@
+package drupal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps/php"
+)
+
+var testDrupalSettings = `<?php
+
+/**
+ * Database settings:
+ *
+ * $databases['default']['default'] = array (
+ *   'database' => 'databasename',
+ *   'username' => 'sqlusername',
+ *   'password' => 'sqlpassword',
+ *   'host' => 'localhost',
+ * );
+ */
+$databases = [];
+
+$settings['hash_salt'] = 'XXXXXXXX';
+$settings['config_sync_directory'] = $app_root . '/' . $site_path . '/files/config_sync';
+$databases['default']['default'] = array (
+  'database' => 'bitnami_drupal',
+  'username' => 'bn_drupal',
+  'password' => 'XXXXXXXX',
+  'prefix' => 'dr_',
+  'host' => '127.0.0.1',
+  'port' => '3307',
+  'namespace' => 'Drupal\\Core\\Database\\Driver\\mysql',
+  'driver' => 'mysql',
+);
+`
+
+var extensionsData = `a:3:{s:6:"module";a:3:{s:4:"smtp";i:0;s:6:"system";i:0;s:4:"user";i:0;}s:5:"theme";a:1:{s:6:"bartik";i:0;}s:7:"profile";s:8:"standard";}`
+var smtpData = `a:12:{s:7:"smtp_on";b:1;s:9:"smtp_host";s:14:"smtp.gmail.com";s:15:"smtp_hostbackup";s:0:"";s:9:"smtp_port";s:3:"587";s:13:"smtp_protocol";s:8:"standard";s:12:"smtp_autotls";b:1;s:13:"smtp_username";s:9:"smtp-user";s:13:"smtp_password";s:8:"XXXXXXXX";s:9:"smtp_from";s:16:"user@example.com";s:13:"smtp_fromname";s:7:"Drupal!";s:14:"smtp_debugging";b:0;s:14:"smtp_allowhtml";s:0:"";}`
+
+func TestParseDrupalDatabaseConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drupal")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "settings.php")
+
+	t.Run("Check parsed database configuration data", func(t *testing.T) {
+		ioutil.WriteFile(configFile, []byte(testDrupalSettings), 0644)
+		db, err := parseDrupalDatabaseConfig(configFile)
+		if err != nil {
+			t.Fatalf("Error parsing settings.php file: %v", err)
+		}
+		if db.Host != "127.0.0.1" || db.Port != 3307 {
+			t.Errorf("Incorrect database address detected, expected: 127.0.0.1:3307, got: %s:%d", db.Host, db.Port)
+		}
+		if db.Name != "bitnami_drupal" || db.User != "bn_drupal" || db.Pass != "XXXXXXXX" {
+			t.Errorf("Incorrect database credentials detected, expected: bitnami_drupal, bn_drupal, XXXXXXXX, got: %s, %s, %s", db.Name, db.User, db.Pass)
+		}
+		if db.Prefix != "dr_" {
+			t.Errorf("Incorrect table prefix detected, expected: dr_, got: %s", db.Prefix)
+		}
+	})
+	t.Run("Check unsupported databases", func(t *testing.T) {
+		ioutil.WriteFile(configFile, []byte(strings.Replace(testDrupalSettings, "'driver' => 'mysql'", "'driver' => 'pgsql'", 1)), 0644)
+		if _, err := parseDrupalDatabaseConfig(configFile); err == nil || !strings.Contains(err.Error(), "pgsql") {
+			t.Errorf("Incorrect error, expected: unsupported database driver, got: %v", err)
+		}
+		ioutil.WriteFile(configFile, []byte("<?php\n$databases = [];\n"), 0644)
+		if _, err := parseDrupalDatabaseConfig(configFile); err == nil {
+			t.Errorf("Settings without database accepted")
+		}
+	})
+}
+
+func TestCheckModule(t *testing.T) {
+	t.Run("Check installed modules", func(t *testing.T) {
+		extensions, _ := php.Unserialize(extensionsData)
+		if err := checkModule(extensions); err != nil {
+			t.Errorf("Error checking installed modules: %v", err)
+		}
+		extensions, _ = php.Unserialize(strings.Replace(extensionsData, `s:4:"smtp"`, `s:4:"node"`, 1))
+		if err := checkModule(extensions); err == nil {
+			t.Errorf("Missing smtp module accepted")
+		}
+	})
+}
+
+func TestObtainSMTP(t *testing.T) {
+	t.Run("Check obtained SMTP data", func(t *testing.T) {
+		config := Config{}
+		settings, err := php.Unserialize(smtpData)
+		if err != nil {
+			t.Fatalf("Error decoding SMTP data: %v", err)
+		}
+		if err := obtainSMTP(settings, &config); err != nil {
+			t.Fatalf("Error obtaining SMTP data: %v", err)
+		}
+		if err := config.ValidateSMTPSettings(); err != nil {
+			t.Errorf("Error validating SMTP data: %v", err)
+		}
+		expected := apps.SMTPSettings{Host: "smtp.gmail.com", Port: 587, User: "smtp-user", Pass: "XXXXXXXX", From: "user@example.com", FromName: "Drupal!"}
+		if s := config.GetSMTPSettings(); *s != expected {
+			t.Errorf("Incorrect SMTP settings, expected: %+v, got: %+v", expected, *s)
+		}
+	})
+	t.Run("Check SMTP module settings", func(t *testing.T) {
+		testData := map[string]Config{
+			"smtp_on":       {Host: "smtp.example.com", Port: 25},
+			"smtp_host":     {Enabled: true, Port: 25},
+			"smtp_port":     {Enabled: true, Host: "smtp.example.com"},
+			"smtp_protocol": {Enabled: true, Host: "smtp.example.com", Port: 25, Protocol: "starttls"},
+			"smtp_password": {Enabled: true, Host: "smtp.example.com", Port: 25, User: "user"},
+		}
+		for expected, config := range testData {
+			if err := config.ValidateSMTPSettings(); err == nil || !strings.HasPrefix(err.Error(), expected) {
+				t.Errorf("Incorrect error, expected: %s, got: %v", expected, err)
+			}
+		}
+	})
+	t.Run("Check encryption modes", func(t *testing.T) {
+		testData := []struct {
+			config   Config
+			expected string
+		}{
+			{Config{Protocol: "ssl"}, apps.EncryptionTLS},
+			{Config{Protocol: "tls"}, apps.EncryptionSTARTTLS},
+			{Config{Protocol: "standard", AutoTLS: true}, apps.EncryptionAuto},
+			{Config{Protocol: "standard"}, apps.EncryptionNone},
+		}
+		for _, tt := range testData {
+			if got := tt.config.GetSMTPSettings().Encryption; got != tt.expected {
+				t.Errorf("Incorrect encryption for %s, expected: %q, got: %q", tt.config.Protocol, tt.expected, got)
+			}
+		}
+	})
+}
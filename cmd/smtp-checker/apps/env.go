@@ -0,0 +1,66 @@
+package apps
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ReadEnvFile reads a dotenv file with lines with the format KEY=value, such as
+// the ones used by docker --env-file or dumped with env. Empty lines, comments
+// and the export keyword are ignored, and quoted values are unquoted.
+func ReadEnvFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading env file: %v", err)
+	}
+	defer f.Close()
+	env := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		kv := strings.SplitN(line, "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("error parsing env file %q: line %d does not follow the format KEY=value", path, n)
+		}
+		value, err := envValue(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing env file %q: line %d: %v", path, n, err)
+		}
+		env[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading env file: %v", err)
+	}
+	return env, nil
+}
+
+// envValue unquotes a value of a dotenv file. Double quoted values support
+// escape sequences, and comments are removed from unquoted values.
+func envValue(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		end := strings.LastIndex(s, `"`)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated quoted value")
+		}
+		return strconv.Unquote(s[:end+1])
+	case strings.HasPrefix(s, "'"):
+		end := strings.LastIndex(s, "'")
+		if end == 0 {
+			return "", fmt.Errorf("unterminated quoted value")
+		}
+		return s[1:end], nil
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return s, nil
+}
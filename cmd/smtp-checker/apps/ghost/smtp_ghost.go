@@ -0,0 +1,203 @@
+package ghost
+
+import (
+	"context"
+	"encoding/json"
+	"net/mail"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/redact"
+	"github.com/juju/errors"
+)
+
+const (
+	// ConfigFilePath is the path of the configuration file, relative to the installation directory
+	ConfigFilePath = "apps/ghost/htdocs/config.production.json"
+)
+
+// Config is a structure that matches the schema of
+// Ghost config.production.json file
+type Config struct {
+	Mail Mail `json:"mail"`
+}
+
+// Mail is a structure that contains the mail configuration
+// data of Ghost
+type Mail struct {
+	From      string      `json:"from"`
+	Transport string      `json:"transport"`
+	Options   MailOptions `json:"options"`
+}
+
+// MailOptions is a structure that contains the options of the
+// Nodemailer SMTP transport
+type MailOptions struct {
+	// Service is a well-known service (e.g. Mailgun), which sets the host, port
+	// and secure options that are not provided
+	Service    string      `json:"service"`
+	Host       string      `json:"host"`
+	Port       json.Number `json:"port"`
+	Secure     bool        `json:"secure"`
+	RequireTLS bool        `json:"requireTLS"`
+	IgnoreTLS  bool        `json:"ignoreTLS"`
+	AuthMethod string      `json:"authMethod"`
+	Auth       Auth        `json:"auth"`
+}
+
+// Auth is a structure that contains the SMTP credentials
+type Auth struct {
+	User string `json:"user"`
+	Pass string `json:"pass"`
+}
+
+// service contains the settings of a Nodemailer well-known service
+type service struct {
+	host   string
+	port   int
+	secure bool
+}
+
+// services contains the Nodemailer well-known services commonly used with
+// Ghost, by normalized name
+var services = map[string]service{
+	"gmail":      {"smtp.gmail.com", 465, true},
+	"mailgun":    {"smtp.mailgun.org", 465, true},
+	"mailjet":    {"in-v3.mailjet.com", 587, false},
+	"outlook365": {"smtp.office365.com", 587, false},
+	"postmark":   {"smtp.postmarkapp.com", 2525, false},
+	"sendgrid":   {"smtp.sendgrid.net", 587, false},
+	"ses":        {"email-smtp.us-east-1.amazonaws.com", 465, true},
+}
+
+// nonAlnumRe matches the characters ignored in the service names, as in Nodemailer
+var nonAlnumRe = regexp.MustCompile(`[^a-z0-9]`)
+
+// service returns the well-known service configured, if any
+func (o MailOptions) service() (service, bool) {
+	s, ok := services[nonAlnumRe.ReplaceAllString(strings.ToLower(o.Service), "")]
+	return s, ok
+}
+
+// host returns the host configured or the one of the service
+func (o MailOptions) host() string {
+	if s, ok := o.service(); ok && o.Host == "" {
+		return s.host
+	}
+	return o.Host
+}
+
+// secure returns whether the connection uses implicit TLS
+func (o MailOptions) secure() bool {
+	if s, ok := o.service(); ok && o.Host == "" {
+		return o.Secure || s.secure
+	}
+	return o.Secure
+}
+
+// port returns the port configured or the default one of Nodemailer
+func (o MailOptions) port() (int, error) {
+	if o.Port != "" {
+		return strconv.Atoi(o.Port.String())
+	}
+	if s, ok := o.service(); ok && o.Host == "" {
+		return s.port, nil
+	}
+	if o.secure() {
+		return 465, nil
+	}
+	return 587, nil
+}
+
+// GetSMTPSettings returns a SMTPSettings from Config structure
+func (c Config) GetSMTPSettings() *apps.SMTPSettings {
+	port, _ := c.Mail.Options.port()
+	from, fromName := c.sender()
+	return &apps.SMTPSettings{
+		Host:       c.Mail.Options.host(),
+		Port:       port,
+		User:       c.Mail.Options.Auth.User,
+		Pass:       c.Mail.Options.Auth.Pass,
+		Encryption: c.encryption(),
+		Auth:       c.authMechanism(),
+		From:       from,
+		FromName:   fromName,
+	}
+}
+
+// sender returns the address and name of the from setting, which may include
+// the name (e.g. "'My Blog' <noreply@example.com>")
+func (c Config) sender() (string, string) {
+	addr, err := mail.ParseAddress(c.Mail.From)
+	if err != nil {
+		return c.Mail.From, ""
+	}
+	return addr.Address, strings.Trim(addr.Name, `'"`)
+}
+
+// encryption returns the encryption mode used by Nodemailer, which upgrades the
+// connection whenever the server offers STARTTLS unless ignoreTLS is enabled
+func (c Config) encryption() string {
+	switch {
+	case c.Mail.Options.secure():
+		return apps.EncryptionTLS
+	case c.Mail.Options.IgnoreTLS:
+		return apps.EncryptionNone
+	case c.Mail.Options.RequireTLS:
+		return apps.EncryptionSTARTTLS
+	}
+	return apps.EncryptionAuto
+}
+
+// authMechanism returns the authentication mechanism used by Nodemailer: the
+// authMethod option or, if empty, one of the mechanisms listed in the EHLO reply
+func (c Config) authMechanism() string {
+	if c.Mail.Options.Auth.User == "" {
+		return apps.AuthNone
+	}
+	if c.Mail.Options.AuthMethod == "" {
+		return apps.AuthNegotiate
+	}
+	return strings.ToLower(c.Mail.Options.AuthMethod)
+}
+
+// ValidateSMTPSettings checks the SMTPSettings are correct
+func (c *Config) ValidateSMTPSettings() error {
+	if !strings.EqualFold(c.Mail.Transport, "SMTP") {
+		transport := c.Mail.Transport
+		if transport == "" {
+			transport = "Direct"
+		}
+		return errors.Errorf("mail.transport: Ghost is configured to send mail using %q instead of SMTP", transport)
+	}
+	if c.Mail.Options.Service != "" && c.Mail.Options.Host == "" {
+		if _, ok := c.Mail.Options.service(); !ok {
+			return errors.Errorf("mail.options.service: unknown service %q, set mail.options.host instead", c.Mail.Options.Service)
+		}
+	}
+	if c.Mail.Options.host() == "" {
+		return errors.New("mail.options.host: empty string")
+	}
+	if port, err := c.Mail.Options.port(); err != nil || port <= 0 {
+		return errors.New("mail.options.port: invalid port")
+	}
+	if c.Mail.Options.Auth.User != "" && c.Mail.Options.Auth.Pass == "" {
+		return errors.New("mail.options.auth.pass: empty string")
+	}
+	settings := c.GetSMTPSettings()
+	if settings.Auth != "" && settings.Auth != apps.AuthNone && settings.Auth != apps.AuthPlain && settings.Auth != apps.AuthLogin && settings.Auth != apps.AuthCRAMMD5 && settings.Auth != apps.AuthXOAUTH2 {
+		return errors.Errorf("mail.options.authMethod: %q is not a supported authentication mechanism", c.Mail.Options.AuthMethod)
+	}
+	return settings.ValidateProvider()
+}
+
+// ParseConfig obtains an ApplicationConfig from the config.production.json file
+func ParseConfig(_ context.Context, installDir string) (apps.ApplicationConfig, error) {
+	config := Config{}
+	err := apps.UnmarshalJSONFile(filepath.Join(installDir, ConfigFilePath), &config)
+	redact.Register(config.Mail.Options.Auth.Pass)
+	return &config, err
+}
@@ -0,0 +1,122 @@
+package ghost
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/providers"
+)
+
+var testGhostConfig = `{
+  "url": "http://example.com",
+  "server": {
+    "port": 2368,
+    "host": "127.0.0.1"
+  },
+  "database": {
+    "client": "mysql",
+    "connection": {
+      "host": "localhost",
+      "user": "bn_ghost",
+      "password": "XXXXXXXX",
+      "database": "bitnami_ghost"
+    }
+  },
+  "mail": {
+    "from": "'My Blog' <noreply@example.com>",
+    "transport": "SMTP",
+    "options": {
+      "host": "smtp.gmail.com",
+      "port": 587,
+      "secure": false,
+      "auth": {
+        "user": "user@gmail.com",
+        "pass": "XXXXXXXX"
+      }
+    }
+  }
+}
+`
+
+func TestParseConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ghost")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, ConfigFilePath)
+	os.MkdirAll(filepath.Dir(configFile), 0755)
+	ioutil.WriteFile(configFile, []byte(testGhostConfig), 0644)
+
+	t.Run("Check parsed SMTP configuration data", func(t *testing.T) {
+		config, err := ParseConfig(context.Background(), dir)
+		if err != nil {
+			t.Fatalf("Error parsing config.production.json file: %v", err)
+		}
+		if err := config.ValidateSMTPSettings(); err != nil {
+			t.Errorf("Error validating SMTP data: %v", err)
+		}
+		expected := apps.SMTPSettings{Host: "smtp.gmail.com", Port: 587, User: "user@gmail.com", Pass: "XXXXXXXX", From: "noreply@example.com", FromName: "My Blog"}
+		if s := config.GetSMTPSettings(); *s != expected {
+			t.Errorf("Incorrect SMTP settings, expected: %+v, got: %+v", expected, *s)
+		}
+	})
+}
+
+func TestGetSMTPSettings(t *testing.T) {
+	t.Run("Check well-known services", func(t *testing.T) {
+		config := Config{Mail: Mail{Transport: "SMTP", Options: MailOptions{Service: "Mailgun", Auth: Auth{User: "postmaster@example.com", Pass: "pass"}}}}
+		if err := config.ValidateSMTPSettings(); err != nil {
+			t.Errorf("Error validating SMTP data: %v", err)
+		}
+		s := config.GetSMTPSettings()
+		if s.Host != "smtp.mailgun.org" || s.Port != 465 || s.Encryption != apps.EncryptionTLS {
+			t.Errorf("Incorrect SMTP settings, expected: smtp.mailgun.org:465 over TLS, got: %s:%d (%s)", s.Host, s.Port, s.Encryption)
+		}
+	})
+	t.Run("Check well-known services use the current hosts of the providers", func(t *testing.T) {
+		for name, s := range services {
+			if suggestion := providers.Suggest(s.host); suggestion != "" {
+				t.Errorf("Incorrect host for service %s, expected: %s, got: %s", name, suggestion, s.host)
+			}
+		}
+	})
+	t.Run("Check encryption modes", func(t *testing.T) {
+		testData := []struct {
+			options  MailOptions
+			expected string
+		}{
+			{MailOptions{Secure: true}, apps.EncryptionTLS},
+			{MailOptions{RequireTLS: true}, apps.EncryptionSTARTTLS},
+			{MailOptions{IgnoreTLS: true}, apps.EncryptionNone},
+			{MailOptions{}, apps.EncryptionAuto},
+		}
+		for _, tt := range testData {
+			config := Config{Mail: Mail{Options: tt.options}}
+			if got := config.GetSMTPSettings().Encryption; got != tt.expected {
+				t.Errorf("Incorrect encryption for %+v, expected: %q, got: %q", tt.options, tt.expected, got)
+			}
+		}
+	})
+}
+
+func TestValidateSMTPSettings(t *testing.T) {
+	testData := map[string]Mail{
+		`mail.transport: Ghost is configured to send mail using "Direct"`: {},
+		"mail.options.service": {Transport: "SMTP", Options: MailOptions{Service: "Unknown"}},
+		"mail.options.host":    {Transport: "SMTP"},
+		"mail.options.port":    {Transport: "SMTP", Options: MailOptions{Host: "smtp.example.com", Port: "smtp"}},
+		"mail.options.auth":    {Transport: "smtp", Options: MailOptions{Host: "smtp.example.com", Auth: Auth{User: "user"}}},
+	}
+	for expected, m := range testData {
+		config := Config{Mail: m}
+		if err := config.ValidateSMTPSettings(); err == nil || !strings.HasPrefix(err.Error(), expected) {
+			t.Errorf("Incorrect error, expected: %s, got: %v", expected, err)
+		}
+	}
+}
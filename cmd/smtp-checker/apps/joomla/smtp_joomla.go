@@ -0,0 +1,142 @@
+package joomla
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps/php"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/redact"
+	"github.com/juju/errors"
+)
+
+const (
+	// ConfigFilePath is the path of the configuration file, relative to the installation directory
+	ConfigFilePath = "apps/joomla/htdocs/configuration.php"
+	// configClass is the class whose properties contain the configuration
+	configClass = "JConfig"
+)
+
+// Config is a structure that contains the mail settings of
+// the JConfig class of Joomla configuration.php file
+type Config struct {
+	// MailOnline is the "Send Mail" setting
+	MailOnline bool
+	Mailer     string
+	MailFrom   string
+	FromName   string
+	SMTPAuth   bool
+	SMTPSecure string
+	SMTPPort   int
+	SMTPUser   string
+	SMTPPass   string
+	SMTPHost   string
+}
+
+// GetSMTPSettings returns a SMTPSettings from Config structure
+func (c Config) GetSMTPSettings() *apps.SMTPSettings {
+	return &apps.SMTPSettings{
+		Host:       c.SMTPHost,
+		Port:       c.SMTPPort,
+		User:       c.SMTPUser,
+		Pass:       c.SMTPPass,
+		Encryption: c.encryption(),
+		Auth:       c.authMechanism(),
+		From:       c.MailFrom,
+		FromName:   c.FromName,
+	}
+}
+
+// authMechanism returns the authentication mechanism used by Joomla. The global
+// configuration cannot set it, so it is chosen from the EHLO reply.
+func (c Config) authMechanism() string {
+	if !c.SMTPAuth {
+		return apps.AuthNone
+	}
+	return apps.AuthNegotiate
+}
+
+// encryption returns the encryption mode used by Joomla. Without SMTP security,
+// PHPMailer upgrades the connection whenever the server offers STARTTLS.
+func (c Config) encryption() string {
+	switch c.SMTPSecure {
+	case "ssl":
+		return apps.EncryptionTLS
+	case "tls":
+		return apps.EncryptionSTARTTLS
+	}
+	return apps.EncryptionAuto
+}
+
+// ValidateSMTPSettings checks the SMTPSettings are correct
+func (c *Config) ValidateSMTPSettings() error {
+	if !c.MailOnline {
+		return errors.New("mailonline: sending mail is disabled in the global configuration")
+	}
+	if c.Mailer != "smtp" {
+		return errors.Errorf("mailer: Joomla is configured to send mail using %q instead of smtp", c.Mailer)
+	}
+	if c.SMTPHost == "" {
+		return errors.New("smtphost: empty string")
+	}
+	if c.SMTPPort <= 0 {
+		return errors.New("smtpport: invalid port")
+	}
+	if c.SMTPSecure != "" && c.SMTPSecure != "none" && c.SMTPSecure != "ssl" && c.SMTPSecure != "tls" {
+		return errors.Errorf("smtpsecure: %q is not valid (valid values: none, ssl, tls)", c.SMTPSecure)
+	}
+	if c.SMTPAuth && c.SMTPUser == "" {
+		return errors.New("smtpuser: empty string")
+	}
+	if c.SMTPAuth && c.SMTPPass == "" {
+		return errors.New("smtppass: empty string")
+	}
+	return c.GetSMTPSettings().ValidateProvider()
+}
+
+// parseJoomlaConfig reads the properties of the JConfig class, without executing
+// configuration.php
+func parseJoomlaConfig(configFile string) (Config, error) {
+	source, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return Config{}, errors.Errorf("error reading config file: %v", err)
+	}
+	props, err := php.Properties(source, configClass)
+	if err != nil {
+		return Config{}, err
+	}
+	value := func(name string) interface{} {
+		v, _ := php.Lookup(props, name)
+		return v
+	}
+	config := Config{
+		// Sending mail is enabled when the property is missing, as in Joomla
+		MailOnline: value("mailonline") == nil || php.Bool(value("mailonline")),
+		Mailer:     php.String(value("mailer")),
+		MailFrom:   php.String(value("mailfrom")),
+		FromName:   php.String(value("fromname")),
+		SMTPAuth:   php.Bool(value("smtpauth")),
+		SMTPSecure: php.String(value("smtpsecure")),
+		SMTPUser:   php.String(value("smtpuser")),
+		SMTPPass:   php.String(value("smtppass")),
+		SMTPHost:   php.String(value("smtphost")),
+	}
+	if port := php.String(value("smtpport")); port != "" {
+		if config.SMTPPort, err = strconv.Atoi(port); err != nil {
+			return Config{}, errors.Errorf("smtpport: invalid port %q", port)
+		}
+	}
+	return config, nil
+}
+
+// ParseConfig obtains an ApplicationConfig from the configuration.php file
+func ParseConfig(_ context.Context, installDir string) (apps.ApplicationConfig, error) {
+	config, err := parseJoomlaConfig(filepath.Join(installDir, ConfigFilePath))
+	if err != nil {
+		return nil, errors.Errorf("error parsing configuration.php file: %v", err)
+	}
+	redact.Register(config.SMTPPass)
+	return &config, nil
+}
@@ -0,0 +1,102 @@
+package joomla
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps"
+)
+
+var testJoomlaConfig = `<?php
+class JConfig {
+	public $offline = '0';
+	public $sitename = 'Bitnami Joomla!';
+	public $dbtype = 'mysqli';
+	public $host = 'localhost:3306';
+	public $password = 'XXXXXXXX';
+	public $log_path = JPATH_ROOT . '/administrator/logs';
+	public $mailonline = '1';
+	public $mailer = 'smtp';
+	public $mailfrom = 'user@example.com';
+	public $fromname = 'Bitnami Joomla!';
+	public $sendmail = '/usr/sbin/sendmail';
+	public $smtpauth = '1';
+	public $smtpuser = 'smtp-user';
+	public $smtppass = 'it\'s XXXXXXXX';
+	public $smtphost = 'smtp.gmail.com';
+	public $smtpsecure = 'tls';
+	public $smtpport = '587';
+}
+`
+
+func TestParseJoomlaConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "joomla")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "configuration.php")
+
+	t.Run("Check parsed SMTP configuration data", func(t *testing.T) {
+		ioutil.WriteFile(configFile, []byte(testJoomlaConfig), 0644)
+		config, err := parseJoomlaConfig(configFile)
+		if err != nil {
+			t.Fatalf("Error parsing configuration.php file: %v", err)
+		}
+		if err := config.ValidateSMTPSettings(); err != nil {
+			t.Errorf("Error validating SMTP data: %v", err)
+		}
+		expected := apps.SMTPSettings{Host: "smtp.gmail.com", Port: 587, User: "smtp-user", Pass: "it's XXXXXXXX", Encryption: apps.EncryptionSTARTTLS, From: "user@example.com", FromName: "Bitnami Joomla!"}
+		if s := config.GetSMTPSettings(); *s != expected {
+			t.Errorf("Incorrect SMTP settings, expected: %+v, got: %+v", expected, *s)
+		}
+	})
+	t.Run("Check invalid configuration files", func(t *testing.T) {
+		ioutil.WriteFile(configFile, []byte("<?php\nclass Other {\n\tpublic $mailer = 'smtp';\n}\n"), 0644)
+		if _, err := parseJoomlaConfig(configFile); err == nil {
+			t.Errorf("Configuration without JConfig class accepted")
+		}
+		ioutil.WriteFile(configFile, []byte(strings.Replace(testJoomlaConfig, "'587'", "'smtp'", 1)), 0644)
+		if _, err := parseJoomlaConfig(configFile); err == nil {
+			t.Errorf("Invalid port accepted")
+		}
+	})
+}
+
+func TestValidateSMTPSettings(t *testing.T) {
+	valid := Config{MailOnline: true, Mailer: "smtp", SMTPHost: "smtp.example.com", SMTPPort: 25}
+	t.Run("Check mailer", func(t *testing.T) {
+		for _, mailer := range []string{"mail", "sendmail"} {
+			config := valid
+			config.Mailer = mailer
+			if err := config.ValidateSMTPSettings(); err == nil || !strings.Contains(err.Error(), mailer) {
+				t.Errorf("Incorrect error, expected: mailer %s, got: %v", mailer, err)
+			}
+		}
+	})
+	t.Run("Check SMTP settings", func(t *testing.T) {
+		testData := map[string]func(c *Config){
+			"mailonline": func(c *Config) { c.MailOnline = false },
+			"smtphost":   func(c *Config) { c.SMTPHost = "" },
+			"smtpport":   func(c *Config) { c.SMTPPort = 0 },
+			"smtpsecure": func(c *Config) { c.SMTPSecure = "starttls" },
+			"smtpuser":   func(c *Config) { c.SMTPAuth = true },
+			"smtppass":   func(c *Config) { c.SMTPAuth, c.SMTPUser = true, "user" },
+		}
+		for expected, change := range testData {
+			config := valid
+			change(&config)
+			if err := config.ValidateSMTPSettings(); err == nil || !strings.HasPrefix(err.Error(), expected) {
+				t.Errorf("Incorrect error, expected: %s, got: %v", expected, err)
+			}
+		}
+	})
+	t.Run("Check relays without authentication", func(t *testing.T) {
+		if s := valid.GetSMTPSettings(); s.Auth != apps.AuthNone || s.Encryption != apps.EncryptionAuto {
+			t.Errorf("Incorrect settings, expected: auth none and automatic encryption, got: %+v", *s)
+		}
+	})
+}
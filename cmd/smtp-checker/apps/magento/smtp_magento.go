@@ -0,0 +1,381 @@
+package magento
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps/php"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/mysql"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/redact"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/timeout"
+	"github.com/juju/errors"
+)
+
+const (
+	// ConfigFilePath is the path of the configuration file, relative to the installation directory
+	ConfigFilePath = "apps/magento/htdocs/app/etc/env.php"
+	// defaultDatabasePort is used when env.php does not include the port
+	defaultDatabasePort = 3306
+	// disablePath is the "Disable Email Communications" setting
+	disablePath = "system/smtp/disable"
+	// The sender of the mails is the "General Contact" store email address
+	fromPath     = "trans_email/ident_general/email"
+	fromNamePath = "trans_email/ident_general/name"
+)
+
+// Scopes of the settings of core_config_data
+const (
+	ScopeDefault  = "default"
+	ScopeWebsites = "websites"
+	ScopeStores   = "stores"
+)
+
+// extension contains the paths of the settings of an SMTP transport in
+// core_config_data
+type extension struct {
+	name string
+	// enabled is the setting enabling the transport, which is enabled when the
+	// setting has the enabledValue, or is true if enabledValue is empty
+	enabled      string
+	enabledValue string
+	host         string
+	port         string
+	user         string
+	password     string
+	encryption   string
+	auth         string
+}
+
+// extensions contains the SMTP transports supported: the one built in Magento
+// 2.4.7 and later, and the most common extensions
+var extensions = []extension{
+	{
+		name:    "Magento",
+		enabled: "system/smtp/transport", enabledValue: "smtp",
+		host: "system/smtp/host", port: "system/smtp/port",
+		user: "system/smtp/username", password: "system/smtp/password",
+		encryption: "system/smtp/ssl", auth: "system/smtp/auth",
+	},
+	{
+		name:    "Mageplaza SMTP",
+		enabled: "smtp/general/enabled",
+		host:    "smtp/configuration_option/host", port: "smtp/configuration_option/port",
+		user: "smtp/configuration_option/username", password: "smtp/configuration_option/password",
+		encryption: "smtp/configuration_option/protocol", auth: "smtp/configuration_option/authentication",
+	},
+	{
+		name:    "MagePal Gmail SMTP App",
+		enabled: "system/gmailsmtpapp/active",
+		host:    "system/gmailsmtpapp/smtphost", port: "system/gmailsmtpapp/smtpport",
+		user: "system/gmailsmtpapp/username", password: "system/gmailsmtpapp/password",
+		encryption: "system/gmailsmtpapp/ssl", auth: "system/gmailsmtpapp/auth",
+	},
+}
+
+// Setting is the effective value of a setting and the scope it comes from
+type Setting struct {
+	Value string
+	// Scope is the scope of the value (e.g. default, websites 1 or stores 2)
+	Scope string
+}
+
+// Config is a structure that contains the settings of the SMTP
+// transport enabled, as applied to the default store view
+type Config struct {
+	// Extension is the name of the SMTP transport enabled, if any
+	Extension string
+	// Settings contains the effective settings, by path
+	Settings map[string]Setting
+	ext      *extension
+}
+
+// value returns the effective value of the setting with the path
+func (c Config) value(path string) string {
+	return c.Settings[path].Value
+}
+
+// encryptedRe matches the values encrypted with the Magento crypt key
+// (version:cipher:data)
+var encryptedRe = regexp.MustCompile(`^[0-9]+:[0-9]+:`)
+
+// passwordEncrypted returns whether the password is encrypted, so it cannot be
+// used without the crypt key
+func (c Config) passwordEncrypted() bool {
+	return c.ext != nil && encryptedRe.MatchString(c.value(c.ext.password))
+}
+
+// GetSMTPSettings returns a SMTPSettings from Config structure
+func (c Config) GetSMTPSettings() *apps.SMTPSettings {
+	settings := &apps.SMTPSettings{
+		From:     c.value(fromPath),
+		FromName: c.value(fromNamePath),
+	}
+	if c.ext == nil {
+		return settings
+	}
+	settings.Host = c.value(c.ext.host)
+	settings.Port, _ = strconv.Atoi(c.value(c.ext.port))
+	settings.User = c.value(c.ext.user)
+	if !c.passwordEncrypted() {
+		settings.Pass = c.value(c.ext.password)
+	}
+	settings.Encryption = c.encryption()
+	settings.Auth = c.authMechanism()
+	return settings
+}
+
+// encryption returns the encryption mode used by the SMTP transport. The
+// connection is not upgraded unless TLS is configured.
+func (c Config) encryption() string {
+	switch strings.ToLower(c.value(c.ext.encryption)) {
+	case "ssl":
+		return apps.EncryptionTLS
+	case "tls":
+		return apps.EncryptionSTARTTLS
+	}
+	return apps.EncryptionNone
+}
+
+// authMechanism returns the authentication mechanism used by the SMTP transport
+func (c Config) authMechanism() string {
+	if c.value(c.ext.user) == "" {
+		return apps.AuthNone
+	}
+	switch auth := strings.ToLower(c.value(c.ext.auth)); auth {
+	case "", "none":
+		return apps.AuthNone
+	case "crammd5":
+		return apps.AuthCRAMMD5
+	default:
+		return auth
+	}
+}
+
+// ValidateSMTPSettings checks the SMTPSettings are correct
+func (c *Config) ValidateSMTPSettings() error {
+	if php.Bool(c.value(disablePath)) {
+		return errors.Errorf("%s: email communications are disabled (%s scope)", disablePath, c.Settings[disablePath].Scope)
+	}
+	if c.ext == nil {
+		var paths []string
+		for _, e := range extensions {
+			paths = append(paths, e.enabled)
+		}
+		return errors.Errorf("no SMTP transport enabled, Magento sends mail using sendmail (%s)", strings.Join(paths, ", "))
+	}
+	if c.value(c.ext.host) == "" {
+		return errors.Errorf("%s: empty string", c.ext.host)
+	}
+	if port, err := strconv.Atoi(c.value(c.ext.port)); err != nil || port <= 0 {
+		return errors.Errorf("%s: invalid port", c.ext.port)
+	}
+	if c.value(c.ext.user) != "" && c.value(c.ext.password) == "" {
+		return errors.Errorf("%s: empty string", c.ext.password)
+	}
+	settings := c.GetSMTPSettings()
+	if settings.Auth != "" && settings.Auth != apps.AuthNone && settings.Auth != apps.AuthPlain && settings.Auth != apps.AuthLogin && settings.Auth != apps.AuthCRAMMD5 {
+		return errors.Errorf("%s: %q is not a supported authentication mechanism", c.ext.auth, c.value(c.ext.auth))
+	}
+	return settings.ValidateProvider()
+}
+
+// database contains the credentials of the Magento database and the prefix of
+// its tables
+type database struct {
+	mysql.Database
+	Prefix string
+}
+
+// parseMagentoConfig reads the default connection of the database and the
+// system settings of env.php
+func parseMagentoConfig(configFile string) (database, php.Array, error) {
+	source, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return database{}, nil, errors.Errorf("error reading config file: %v", err)
+	}
+	env, err := php.Return(source)
+	if err != nil {
+		return database{}, nil, err
+	}
+	connection, ok := php.Lookup(env, "db", "connection", "default")
+	if !ok {
+		return database{}, nil, errors.New("db.connection.default not found")
+	}
+	value := func(key string) string {
+		v, _ := php.Lookup(connection, key)
+		return php.String(v)
+	}
+	db := database{Database: mysql.Database{
+		Host: value("host"),
+		Port: defaultDatabasePort,
+		Name: value("dbname"),
+		User: value("username"),
+		Pass: value("password"),
+	}}
+	if strings.HasPrefix(db.Host, "/") {
+		return database{}, nil, errors.Errorf("unsupported database socket %q", db.Host)
+	}
+	if host, port, err := net.SplitHostPort(db.Host); err == nil {
+		db.Host = host
+		if db.Port, err = strconv.Atoi(port); err != nil {
+			return database{}, nil, errors.Errorf("invalid database port %q", port)
+		}
+	}
+	if prefix, ok := php.Lookup(env, "db", "table_prefix"); ok {
+		db.Prefix = php.String(prefix)
+	}
+	if db.Host == "" || db.Name == "" || db.User == "" {
+		return database{}, nil, errors.New("incomplete database credentials (host, dbname and username are required)")
+	}
+	system, _ := php.Lookup(env, "system")
+	systemSettings, _ := system.(php.Array)
+	return db, systemSettings, nil
+}
+
+// paths returns the paths of the settings read from core_config_data
+func paths() []string {
+	res := []string{disablePath, fromPath, fromNamePath}
+	for _, e := range extensions {
+		res = append(res, e.enabled, e.host, e.port, e.user, e.password, e.encryption, e.auth)
+	}
+	return res
+}
+
+// store identifies the store view whose settings are applied, and its website
+type store struct {
+	ID        string
+	WebsiteID string
+}
+
+// defaultStore returns the default store view of the default website
+func defaultStore(ctx context.Context, db database) (store, error) {
+	query := fmt.Sprintf(`SELECT s."store_id", s."website_id" FROM %q w JOIN %q g ON g."group_id" = w."default_group_id" JOIN %q s ON s."store_id" = g."default_store_id" WHERE w."is_default" = 1`,
+		db.Prefix+"store_website", db.Prefix+"store_group", db.Prefix+"store")
+	rows, err := db.MySQLRows(ctx, query)
+	if err != nil {
+		return store{}, timeout.Wrap(ctx, "querying the default store view", err)
+	}
+	if len(rows) == 0 {
+		return store{}, errors.New("default store view not found")
+	}
+	return store{ID: rows[0][0], WebsiteID: rows[0][1]}, nil
+}
+
+// configData returns the rows (scope, scope_id, path and value) of the settings
+// in core_config_data
+func configData(ctx context.Context, db database) ([][]string, error) {
+	p := paths()
+	query := fmt.Sprintf(`SELECT "scope", "scope_id", "path", "value" FROM %q WHERE "path" IN (?%s)`,
+		db.Prefix+"core_config_data", strings.Repeat(", ?", len(p)-1))
+	args := make([]interface{}, len(p))
+	for i, path := range p {
+		args[i] = path
+	}
+	rows, err := db.MySQLRows(ctx, query, args...)
+	if err != nil {
+		return nil, timeout.Wrap(ctx, "querying core_config_data", err)
+	}
+	return rows, nil
+}
+
+// resolve returns the effective settings for the store view. The store view
+// settings override the website ones, which override the default ones. The
+// default settings of the system section of env.php override the database.
+func resolve(rows [][]string, s store, system php.Array) map[string]Setting {
+	rank := map[string]int{}
+	res := map[string]Setting{}
+	for _, row := range rows {
+		scope, id, path, value := row[0], row[1], row[2], row[3]
+		r := 0
+		switch {
+		case scope == ScopeDefault:
+			r = 1
+		case scope == ScopeWebsites && id == s.WebsiteID:
+			r = 2
+		case scope == ScopeStores && id == s.ID:
+			r = 3
+		default:
+			continue
+		}
+		if r > rank[path] {
+			rank[path] = r
+			if scope != ScopeDefault {
+				scope += " " + id
+			}
+			res[path] = Setting{Value: value, Scope: scope}
+		}
+	}
+	for _, path := range paths() {
+		keys := append([]string{ScopeDefault}, strings.Split(path, "/")...)
+		if v, ok := php.Lookup(system, keys...); ok && rank[path] <= 1 {
+			res[path] = Setting{Value: php.String(v), Scope: ScopeDefault + " (env.php)"}
+		}
+	}
+	return res
+}
+
+// newConfig returns the configuration of the first SMTP transport enabled
+func newConfig(settings map[string]Setting) Config {
+	config := Config{Settings: settings}
+	for i, e := range extensions {
+		v := settings[e.enabled].Value
+		if (e.enabledValue != "" && v == e.enabledValue) || (e.enabledValue == "" && php.Bool(v)) {
+			config.Extension = e.name
+			config.ext = &extensions[i]
+			break
+		}
+	}
+	return config
+}
+
+// printScopes prints the scope each setting of the transport comes from
+func printScopes(config Config) {
+	if config.ext == nil {
+		return
+	}
+	fmt.Printf("Magento SMTP settings (%s):\n", config.Extension)
+	var found []string
+	for _, path := range []string{config.ext.enabled, config.ext.host, config.ext.port, config.ext.user, config.ext.password, config.ext.encryption, config.ext.auth, fromPath, fromNamePath} {
+		if _, ok := config.Settings[path]; ok {
+			found = append(found, path)
+		}
+	}
+	sort.Strings(found)
+	for _, path := range found {
+		fmt.Printf("  - %s: %s scope\n", path, config.Settings[path].Scope)
+	}
+	if config.passwordEncrypted() {
+		fmt.Printf("The password in %s is encrypted with the crypt key; provide it with -smtp_password or the other credential sources\n", config.ext.password)
+	}
+}
+
+// QueryConfig obtains an ApplicationConfig by querying the MySQL database
+func QueryConfig(ctx context.Context, installDir string) (apps.ApplicationConfig, error) {
+	db, system, err := parseMagentoConfig(filepath.Join(installDir, ConfigFilePath))
+	if err != nil {
+		return nil, errors.Errorf("error parsing env.php file: %v", err)
+	}
+	redact.Register(db.Pass)
+	s, err := defaultStore(ctx, db)
+	if err != nil {
+		return nil, errors.Errorf("error obtaining the default store view: %v", err)
+	}
+	rows, err := configData(ctx, db)
+	if err != nil {
+		return nil, errors.Errorf("error obtaining the SMTP settings: %v", err)
+	}
+	config := newConfig(resolve(rows, s, system))
+	if config.ext != nil {
+		redact.Register(config.value(config.ext.password))
+	}
+	printScopes(config)
+	return &config, nil
+}
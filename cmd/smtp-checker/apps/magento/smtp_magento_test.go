@@ -0,0 +1,164 @@
+package magento
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps/php"
+)
+
+var testMagentoEnv = `<?php
+return [
+    'backend' => [
+        'frontName' => 'admin'
+    ],
+    'crypt' => [
+        'key' => 'XXXXXXXX'
+    ],
+    'db' => [
+        'table_prefix' => 'mg_',
+        'connection' => [
+            'default' => [
+                'host' => 'localhost:3307',
+                'dbname' => 'bitnami_magento',
+                'username' => 'bn_magento',
+                'password' => 'XXXXXXXX',
+                'model' => 'mysql4',
+                'engine' => 'innodb',
+                'initStatements' => 'SET NAMES utf8;',
+                'active' => '1',
+                'driver_options' => [
+                    1014 => false
+                ]
+            ]
+        ]
+    ],
+    'system' => [
+        'default' => [
+            'smtp' => [
+                'configuration_option' => [
+                    'port' => '2525'
+                ]
+            ]
+        ]
+    ]
+];
+`
+
+func TestParseMagentoConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "magento")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "env.php")
+
+	t.Run("Check parsed database configuration data", func(t *testing.T) {
+		ioutil.WriteFile(configFile, []byte(testMagentoEnv), 0644)
+		db, system, err := parseMagentoConfig(configFile)
+		if err != nil {
+			t.Fatalf("Error parsing env.php file: %v", err)
+		}
+		if db.Host != "localhost" || db.Port != 3307 {
+			t.Errorf("Incorrect database address detected, expected: localhost:3307, got: %s:%d", db.Host, db.Port)
+		}
+		if db.Name != "bitnami_magento" || db.User != "bn_magento" || db.Pass != "XXXXXXXX" {
+			t.Errorf("Incorrect database credentials detected, expected: bitnami_magento, bn_magento, XXXXXXXX, got: %s, %s, %s", db.Name, db.User, db.Pass)
+		}
+		if db.Prefix != "mg_" {
+			t.Errorf("Incorrect table prefix detected, expected: mg_, got: %s", db.Prefix)
+		}
+		if port, _ := php.Lookup(system, "default", "smtp", "configuration_option", "port"); port != "2525" {
+			t.Errorf("Incorrect system settings detected, expected port 2525, got: %v", system)
+		}
+	})
+	t.Run("Check invalid configuration files", func(t *testing.T) {
+		ioutil.WriteFile(configFile, []byte(strings.Replace(testMagentoEnv, "'localhost:3307'", "'/tmp/mysql.sock'", 1)), 0644)
+		if _, _, err := parseMagentoConfig(configFile); err == nil || !strings.Contains(err.Error(), "socket") {
+			t.Errorf("Incorrect error, expected: unsupported database socket, got: %v", err)
+		}
+		ioutil.WriteFile(configFile, []byte("<?php\nreturn ['db' => []];\n"), 0644)
+		if _, _, err := parseMagentoConfig(configFile); err == nil {
+			t.Errorf("Configuration without database accepted")
+		}
+	})
+}
+
+func TestResolve(t *testing.T) {
+	rows := [][]string{
+		{"default", "0", "smtp/general/enabled", "1"},
+		{"default", "0", "smtp/configuration_option/host", "smtp.example.com"},
+		{"websites", "1", "smtp/configuration_option/host", "smtp.website.example.com"},
+		{"websites", "2", "smtp/configuration_option/host", "smtp.other.example.com"},
+		{"stores", "1", "smtp/configuration_option/username", "store-user"},
+		{"default", "0", "smtp/configuration_option/username", "default-user"},
+		{"default", "0", "smtp/configuration_option/password", "pass"},
+		{"default", "0", "smtp/configuration_option/port", "25"},
+		{"default", "0", "smtp/configuration_option/protocol", "tls"},
+		{"default", "0", "smtp/configuration_option/authentication", "login"},
+		{"default", "0", "trans_email/ident_general/email", "owner@example.com"},
+	}
+	env := php.Array{"default": php.Array{"smtp": php.Array{"configuration_option": php.Array{"port": "587", "username": "env-user"}}}}
+	config := newConfig(resolve(rows, store{ID: "1", WebsiteID: "1"}, env))
+
+	t.Run("Check effective settings and scopes", func(t *testing.T) {
+		expected := map[string]Setting{
+			"smtp/configuration_option/host":     {"smtp.website.example.com", "websites 1"},
+			"smtp/configuration_option/username": {"store-user", "stores 1"},
+			"smtp/configuration_option/port":     {"587", "default (env.php)"},
+			"smtp/configuration_option/password": {"pass", "default"},
+		}
+		for path, setting := range expected {
+			if got := config.Settings[path]; got != setting {
+				t.Errorf("Incorrect setting %s, expected: %+v, got: %+v", path, setting, got)
+			}
+		}
+	})
+	t.Run("Check obtained SMTP data", func(t *testing.T) {
+		if config.Extension != "Mageplaza SMTP" {
+			t.Errorf("Incorrect extension, expected: Mageplaza SMTP, got: %q", config.Extension)
+		}
+		if err := config.ValidateSMTPSettings(); err != nil {
+			t.Errorf("Error validating SMTP data: %v", err)
+		}
+		expected := apps.SMTPSettings{Host: "smtp.website.example.com", Port: 587, User: "store-user", Pass: "pass", Encryption: apps.EncryptionSTARTTLS, Auth: apps.AuthLogin, From: "owner@example.com"}
+		if s := config.GetSMTPSettings(); *s != expected {
+			t.Errorf("Incorrect SMTP settings, expected: %+v, got: %+v", expected, *s)
+		}
+	})
+	t.Run("Check encrypted passwords", func(t *testing.T) {
+		encrypted := newConfig(resolve(append(rows, []string{"stores", "1", "smtp/configuration_option/password", "0:3:XXXXXXXX"}), store{ID: "1", WebsiteID: "1"}, nil))
+		if err := encrypted.ValidateSMTPSettings(); err != nil {
+			t.Errorf("Error validating SMTP data: %v", err)
+		}
+		if s := encrypted.GetSMTPSettings(); s.Pass != "" {
+			t.Errorf("Incorrect password, expected the encrypted value to be ignored, got: %q", s.Pass)
+		}
+	})
+}
+
+func TestValidateSMTPSettings(t *testing.T) {
+	testData := map[string][][]string{
+		"no SMTP transport enabled": {{"default", "0", "system/smtp/transport", "sendmail"}},
+		"system/smtp/disable":       {{"default", "0", "system/smtp/transport", "smtp"}, {"default", "0", "system/smtp/disable", "1"}},
+		"system/smtp/host":          {{"default", "0", "system/smtp/transport", "smtp"}},
+		"system/smtp/port":          {{"default", "0", "system/smtp/transport", "smtp"}, {"default", "0", "system/smtp/host", "smtp.example.com"}},
+		"system/gmailsmtpapp/auth": {
+			{"default", "0", "system/gmailsmtpapp/active", "1"}, {"default", "0", "system/gmailsmtpapp/smtphost", "smtp.example.com"},
+			{"default", "0", "system/gmailsmtpapp/smtpport", "587"}, {"default", "0", "system/gmailsmtpapp/username", "user"},
+			{"default", "0", "system/gmailsmtpapp/password", "pass"}, {"default", "0", "system/gmailsmtpapp/auth", "ntlm"},
+		},
+	}
+	for expected, rows := range testData {
+		t.Run("Check "+expected, func(t *testing.T) {
+			config := newConfig(resolve(rows, store{ID: "1", WebsiteID: "1"}, nil))
+			if err := config.ValidateSMTPSettings(); err == nil || !strings.HasPrefix(err.Error(), expected) {
+				t.Errorf("Incorrect error, expected: %s, got: %v", expected, err)
+			}
+		})
+	}
+}
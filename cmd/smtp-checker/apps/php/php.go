@@ -0,0 +1,452 @@
+// Package php provides functions for reading the literal values (strings,
+// numbers, booleans and arrays) of PHP configuration files without executing them
+package php
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/yvasiyarov/php_session_decoder/php_serialize"
+)
+
+// Array is a PHP array. The keys of the elements are converted to strings, so
+// lists are indexed by "0", "1"...
+type Array map[string]interface{}
+
+// stripComments replaces the comments of the source with spaces, so the
+// examples commented out are not read as code
+func stripComments(source string) string {
+	b := []byte(source)
+	var quote byte
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '#' || (c == '/' && i+1 < len(b) && b[i+1] == '/'):
+			for ; i < len(b) && b[i] != '\n'; i++ {
+				b[i] = ' '
+			}
+		case c == '/' && i+1 < len(b) && b[i+1] == '*':
+			end := strings.Index(string(b[i+2:]), "*/")
+			if end < 0 {
+				end = len(b)
+			} else {
+				end += i + 4
+			}
+			for ; i < end; i++ {
+				if b[i] != '\n' {
+					b[i] = ' '
+				}
+			}
+			i--
+		}
+	}
+	return string(b)
+}
+
+// parser reads literal values from the source, starting at pos
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) skip() {
+	for p.pos < len(p.s) && strings.IndexByte(" \t\r\n", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	line := strings.Count(p.s[:p.pos], "\n") + 1
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// consume skips the token if it is next in the source
+func (p *parser) consume(token string) bool {
+	p.skip()
+	if strings.HasPrefix(p.s[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+// identRe matches the constants and keywords (e.g. true, array)
+var identRe = regexp.MustCompile(`^[A-Za-z_\\][A-Za-z0-9_\\]*`)
+
+// numberRe matches the integer and decimal numbers
+var numberRe = regexp.MustCompile(`^[-+]?(0x[0-9A-Fa-f]+|[0-9]*\.?[0-9]+([eE][-+]?[0-9]+)?)`)
+
+// value reads a literal value
+func (p *parser) value() (interface{}, error) {
+	p.skip()
+	if p.pos >= len(p.s) {
+		return nil, p.errorf("unexpected end of file")
+	}
+	switch c := p.s[p.pos]; {
+	case c == '\'':
+		return p.singleQuoted()
+	case c == '"':
+		return p.doubleQuoted()
+	case c == '[':
+		p.pos++
+		return p.array(']')
+	case numberRe.MatchString(p.s[p.pos:]):
+		n := numberRe.FindString(p.s[p.pos:])
+		p.pos += len(n)
+		if i, err := strconv.ParseInt(n, 0, 64); err == nil {
+			return int(i), nil
+		}
+		f, err := strconv.ParseFloat(n, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", n)
+		}
+		return f, nil
+	}
+	ident := identRe.FindString(p.s[p.pos:])
+	switch strings.ToLower(ident) {
+	case "true":
+		p.pos += len(ident)
+		return true, nil
+	case "false":
+		p.pos += len(ident)
+		return false, nil
+	case "null":
+		p.pos += len(ident)
+		return nil, nil
+	case "array":
+		p.pos += len(ident)
+		if !p.consume("(") {
+			return nil, p.errorf("expected ( after array")
+		}
+		return p.array(')')
+	}
+	return nil, p.errorf("unsupported expression %q", firstLine(p.s[p.pos:]))
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+func (p *parser) singleQuoted() (string, error) {
+	var b bytes.Buffer
+	for i := p.pos + 1; i < len(p.s); i++ {
+		switch c := p.s[i]; {
+		case c == '\\' && i+1 < len(p.s) && (p.s[i+1] == '\'' || p.s[i+1] == '\\'):
+			i++
+			b.WriteByte(p.s[i])
+		case c == '\'':
+			p.pos = i + 1
+			return b.String(), nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// escapes contains the escape sequences of the double quoted strings
+var escapes = map[byte]string{'n': "\n", 't': "\t", 'r': "\r", 'v': "\v", 'f': "\f", 'e': "\x1b", '0': "\x00", '\\': "\\", '$': "$", '"': "\""}
+
+func (p *parser) doubleQuoted() (string, error) {
+	var b bytes.Buffer
+	for i := p.pos + 1; i < len(p.s); i++ {
+		switch c := p.s[i]; c {
+		case '\\':
+			if i+1 < len(p.s) {
+				if e, ok := escapes[p.s[i+1]]; ok {
+					b.WriteString(e)
+					i++
+					continue
+				}
+			}
+			b.WriteByte(c)
+		case '$':
+			// Interpolated variables cannot be evaluated
+			return "", p.errorf("unsupported interpolation in string")
+		case '"':
+			p.pos = i + 1
+			return b.String(), nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// array reads the elements of an array until the end character. The elements
+// with other expressions are ignored.
+func (p *parser) array(end byte) (Array, error) {
+	res := Array{}
+	next := 0
+	for {
+		if p.consume(string(end)) {
+			return res, nil
+		}
+		start := p.pos
+		key, v, err := p.element(next)
+		if err == nil {
+			p.skip()
+			if p.pos >= len(p.s) || (p.s[p.pos] != ',' && p.s[p.pos] != end) {
+				err = p.errorf("unsupported expression")
+			}
+		}
+		if err != nil {
+			p.pos = start
+			if err := p.skipElement(end); err != nil {
+				return nil, err
+			}
+		} else {
+			if i, err := strconv.Atoi(key); err == nil && i >= next {
+				next = i + 1
+			}
+			res[key] = v
+		}
+		if !p.consume(",") {
+			if !p.consume(string(end)) {
+				return nil, p.errorf("expected , or %c in array", end)
+			}
+			return res, nil
+		}
+	}
+}
+
+// element reads an element of an array, with or without key
+func (p *parser) element(next int) (string, interface{}, error) {
+	v, err := p.value()
+	if err != nil {
+		return "", nil, err
+	}
+	if !p.consume("=>") {
+		return strconv.Itoa(next), v, nil
+	}
+	var key string
+	switch k := v.(type) {
+	case string:
+		key = k
+	case int:
+		key = strconv.Itoa(k)
+	case bool:
+		key = map[bool]string{false: "0", true: "1"}[k]
+	default:
+		return "", nil, p.errorf("unsupported array key %v", v)
+	}
+	v, err = p.value()
+	return key, v, err
+}
+
+// skipElement skips an element of an array, up to the next comma or the end
+// character out of nested strings and brackets
+func (p *parser) skipElement(end byte) error {
+	depth := 0
+	for ; p.pos < len(p.s); p.pos++ {
+		switch c := p.s[p.pos]; {
+		case c == '\'' || c == '"':
+			for p.pos++; p.pos < len(p.s) && p.s[p.pos] != c; p.pos++ {
+				if p.s[p.pos] == '\\' {
+					p.pos++
+				}
+			}
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case depth == 0 && (c == ',' || c == end):
+			return nil
+		case c == ')' || c == ']' || c == '}':
+			depth--
+		}
+	}
+	return p.errorf("unexpected end of file")
+}
+
+// statement reads a literal value followed by the end of the statement
+func (p *parser) statement() (interface{}, error) {
+	v, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	if !p.consume(";") {
+		return nil, p.errorf("unsupported expression %q", firstLine(p.s[p.pos:]))
+	}
+	return v, nil
+}
+
+// assignmentRe matches the assignments to variables and array elements, such
+// as $databases['default']['default'] =
+var assignmentRe = regexp.MustCompile(`(?m)^[ \t]*\$([A-Za-z_][A-Za-z0-9_]*)((?:[ \t]*\[[ \t]*(?:'[^']*'|"[^"]*"|[0-9]+)[ \t]*\])*)[ \t]*=[^=>]`)
+
+// keyRe matches the keys of the array elements in an assignment
+var keyRe = regexp.MustCompile(`'([^']*)'|"([^"]*)"|([0-9]+)`)
+
+// Assignments returns the literal values assigned to the variables of a PHP
+// file, by name. The assignments to array elements are merged into nested
+// arrays, and the assignments of other expressions are ignored.
+func Assignments(source []byte) Array {
+	s := stripComments(string(source))
+	res := Array{}
+	for _, m := range assignmentRe.FindAllStringSubmatchIndex(s, -1) {
+		p := &parser{s: s, pos: m[1] - 1}
+		v, err := p.statement()
+		if err != nil {
+			continue
+		}
+		keys := []string{s[m[2]:m[3]]}
+		for _, k := range keyRe.FindAllStringSubmatch(s[m[4]:m[5]], -1) {
+			keys = append(keys, k[1]+k[2]+k[3])
+		}
+		res.set(keys, v)
+	}
+	return res
+}
+
+// set sets the element with the keys, creating the intermediate arrays
+func (a Array) set(keys []string, v interface{}) {
+	for _, k := range keys[:len(keys)-1] {
+		child, ok := a[k].(Array)
+		if !ok {
+			child = Array{}
+			a[k] = child
+		}
+		a = child
+	}
+	a[keys[len(keys)-1]] = v
+}
+
+// returnRe matches the return statement of the configuration files that return
+// an array, such as return [
+var returnRe = regexp.MustCompile(`(?m)^[ \t]*return\b`)
+
+// Return returns the literal value returned by a PHP file
+func Return(source []byte) (interface{}, error) {
+	s := stripComments(string(source))
+	m := returnRe.FindStringIndex(s)
+	if m == nil {
+		return nil, fmt.Errorf("return statement not found")
+	}
+	p := &parser{s: s, pos: m[1]}
+	return p.statement()
+}
+
+// propertyRe matches the declarations of properties with values, such as
+// public $host =
+var propertyRe = regexp.MustCompile(`(?m)^[ \t]*(?:(?:public|protected|private|static|var)[ \t]+)+\$([A-Za-z_][A-Za-z0-9_]*)[ \t]*=`)
+
+// classRe matches the declaration of a class
+var classRe = regexp.MustCompile(`(?m)^[ \t]*(?:(?:abstract|final)[ \t]+)?class[ \t]+([A-Za-z_][A-Za-z0-9_]*)[^{]*\{`)
+
+// Properties returns the literal values of the properties declared in a class
+// of a PHP file, by name. The properties initialized with other expressions are
+// ignored.
+func Properties(source []byte, class string) (Array, error) {
+	s := stripComments(string(source))
+	start := -1
+	for _, m := range classRe.FindAllStringSubmatchIndex(s, -1) {
+		if s[m[2]:m[3]] == class {
+			start = m[1]
+			break
+		}
+	}
+	if start < 0 {
+		return nil, fmt.Errorf("class %s not found", class)
+	}
+	// The body ends with the brace closing the class
+	end := start
+	for depth := 1; end < len(s) && depth > 0; end++ {
+		switch s[end] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		}
+	}
+	body := s[start:end]
+	res := Array{}
+	for _, m := range propertyRe.FindAllStringSubmatchIndex(body, -1) {
+		p := &parser{s: body, pos: m[1]}
+		if v, err := p.statement(); err == nil {
+			res[body[m[2]:m[3]]] = v
+		}
+	}
+	return res, nil
+}
+
+// Lookup returns the element of nested arrays found with the keys
+func Lookup(v interface{}, keys ...string) (interface{}, bool) {
+	for _, k := range keys {
+		a, ok := v.(Array)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = a[k]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// String returns the string of a scalar value, as converted by PHP
+func String(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case bool:
+		if value {
+			return "1"
+		}
+		return ""
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// Bool returns the boolean of a scalar value, as converted by PHP
+func Bool(v interface{}) bool {
+	switch value := v.(type) {
+	case string:
+		return value != "" && value != "0"
+	case bool:
+		return value
+	case int:
+		return value != 0
+	case float64:
+		return value != 0
+	}
+	return false
+}
+
+// Unserialize decodes a value serialized with the PHP serialize function
+func Unserialize(source string) (interface{}, error) {
+	v, err := php_serialize.NewUnSerializer(source).Decode()
+	if err != nil {
+		return nil, fmt.Errorf("error while decoding object value: %v", err)
+	}
+	return fromSerialized(v), nil
+}
+
+// fromSerialized converts the decoded PHP arrays into Arrays
+func fromSerialized(v php_serialize.PhpValue) interface{} {
+	array, ok := v.(php_serialize.PhpArray)
+	if !ok {
+		return v
+	}
+	res := Array{}
+	for k, child := range array {
+		res[fmt.Sprint(k)] = fromSerialized(child)
+	}
+	return res
+}
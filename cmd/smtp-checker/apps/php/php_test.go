@@ -0,0 +1,132 @@
+package php
+
+import (
+	"reflect"
+	"testing"
+)
+
+var testSettings = `<?php
+/**
+ * Example commented out:
+ * $databases['default']['default'] = array(
+ *   'database' => 'example',
+ * );
+ */
+$databases = [];
+$databases['default']['default'] = array (
+  'database' => 'bitnami_drupal', // database name
+  'username' => "bn_drupal",
+  'password' => 'it\'s # secret',
+  'port' => 3306,
+  'prefix' => '',
+  'pdo' => [PDO::ATTR_TIMEOUT => 5],
+  'path' => $app_root . '/db',
+  'init_commands' => ['isolation' => "SET SESSION tx_isolation='READ-COMMITTED'"],
+);
+# Not literals
+$settings['file_public_path'] = $app_root . '/files';
+$settings['hash_salt'] = 'salt' . 'pepper';
+$config['system.logging']['error_level'] = 'hide';
+$settings['flags'] = [true, false, null, 1.5, -2];
+`
+
+func TestAssignments(t *testing.T) {
+	vars := Assignments([]byte(testSettings))
+	testData := []struct {
+		keys     []string
+		expected interface{}
+	}{
+		{[]string{"databases", "default", "default", "database"}, "bitnami_drupal"},
+		{[]string{"databases", "default", "default", "username"}, "bn_drupal"},
+		{[]string{"databases", "default", "default", "password"}, "it's # secret"},
+		{[]string{"databases", "default", "default", "port"}, 3306},
+		{[]string{"config", "system.logging", "error_level"}, "hide"},
+		{[]string{"settings", "flags"}, Array{"0": true, "1": false, "2": nil, "3": 1.5, "4": -2}},
+	}
+	for _, tt := range testData {
+		t.Run("Check value of "+tt.keys[len(tt.keys)-1], func(t *testing.T) {
+			v, ok := Lookup(vars, tt.keys...)
+			if !ok || !reflect.DeepEqual(v, tt.expected) {
+				t.Errorf("Incorrect value, expected: %#v, got: %#v", tt.expected, v)
+			}
+		})
+	}
+	t.Run("Check other expressions are ignored", func(t *testing.T) {
+		for _, key := range []string{"file_public_path", "hash_salt"} {
+			if v, ok := Lookup(vars, "settings", key); ok {
+				t.Errorf("Incorrect value of %s, expected none, got: %#v", key, v)
+			}
+		}
+		if v, _ := Lookup(vars, "databases", "default", "default", "pdo"); !reflect.DeepEqual(v, Array{}) {
+			t.Errorf("Incorrect value of pdo, expected empty array, got: %#v", v)
+		}
+		if v, ok := Lookup(vars, "databases", "default", "default", "path"); ok {
+			t.Errorf("Incorrect value of path, expected none, got: %#v", v)
+		}
+	})
+}
+
+func TestReturn(t *testing.T) {
+	v, err := Return([]byte(`<?php
+return [
+    'db' => [
+        'table_prefix' => 'mg_',
+        'connection' => [
+            'default' => [
+                'host' => "localhost\t",
+                'active' => '1',
+            ],
+        ],
+    ],
+];
+`))
+	if err != nil {
+		t.Fatalf("Error parsing returned value: %v", err)
+	}
+	if host, _ := Lookup(v, "db", "connection", "default", "host"); host != "localhost\t" {
+		t.Errorf("Incorrect host, expected: %q, got: %#v", "localhost\t", host)
+	}
+	if _, err := Return([]byte("<?php\n$a = 1;\n")); err == nil {
+		t.Errorf("File without return statement accepted")
+	}
+}
+
+func TestProperties(t *testing.T) {
+	source := []byte(`<?php
+class Other {
+	public $smtphost = 'other.example.com';
+}
+class JConfig {
+	public $mailer = 'smtp';
+	public $smtpport = '587';
+	var $smtpauth = 1;
+	public $log_path = JPATH_ROOT . '/logs';
+	public function helper() { return 'x'; }
+	public $smtphost = 'smtp.example.com';
+}`)
+	props, err := Properties(source, "JConfig")
+	if err != nil {
+		t.Fatalf("Error parsing properties: %v", err)
+	}
+	expected := Array{"mailer": "smtp", "smtpport": "587", "smtpauth": 1, "smtphost": "smtp.example.com"}
+	if !reflect.DeepEqual(props, expected) {
+		t.Errorf("Incorrect properties, expected: %v, got: %v", expected, props)
+	}
+	if _, err := Properties(source, "Missing"); err == nil {
+		t.Errorf("Missing class accepted")
+	}
+}
+
+func TestUnserialize(t *testing.T) {
+	v, err := Unserialize(`a:2:{s:6:"module";a:2:{s:4:"smtp";i:0;s:6:"system";i:0;}s:7:"profile";s:8:"standard";}`)
+	if err != nil {
+		t.Fatalf("Error decoding value: %v", err)
+	}
+	expected := Array{"module": Array{"smtp": 0, "system": 0}, "profile": "standard"}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("Incorrect value, expected: %v, got: %v", expected, v)
+	}
+	if _, err := Unserialize("a:1:{"); err == nil {
+		t.Errorf("Invalid value accepted")
+	}
+}
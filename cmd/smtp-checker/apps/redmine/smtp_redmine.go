@@ -1,13 +1,17 @@
 package redmine
 
 import (
+	"context"
 	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/redact"
 	"github.com/juju/errors"
 	"path/filepath"
+	"strings"
 )
 
 const (
-	configFilePath = "apps/redmine/htdocs/config/configuration.yml"
+	// ConfigFilePath is the path of the configuration file, relative to the installation directory
+	ConfigFilePath = "apps/redmine/htdocs/config/configuration.yml"
 )
 
 // Config is a structure that matches the schema of
@@ -34,19 +38,57 @@ type SMTPSettings struct {
 	Password       string `json:"password"`
 	Domain         string `json:"domain"`
 	Authentication string `json:"authentication"`
-	AutoStartTLS   bool   `json:"enable_starttls_auto"`
+	// AutoStartTLS is enabled by default, as in Action Mailer
+	AutoStartTLS *bool `json:"enable_starttls_auto"`
+	SSL          bool  `json:"ssl"`
+	TLS          bool  `json:"tls"`
 }
 
 // GetSMTPSettings returns a SMTPSettings from Config structure
 func (c Config) GetSMTPSettings() *apps.SMTPSettings {
 	return &apps.SMTPSettings{
-		Host: c.Default.EmailDelivery.SMTPSettings.Domain,
-		Port: c.Default.EmailDelivery.SMTPSettings.Port,
-		User: c.Default.EmailDelivery.SMTPSettings.Username,
-		Pass: c.Default.EmailDelivery.SMTPSettings.Password,
+		Host:       c.Default.EmailDelivery.SMTPSettings.Domain,
+		Port:       c.Default.EmailDelivery.SMTPSettings.Port,
+		User:       c.Default.EmailDelivery.SMTPSettings.Username,
+		Pass:       c.Default.EmailDelivery.SMTPSettings.Password,
+		Auth:       c.authMechanism(),
+		Encryption: c.encryption(),
 	}
 }
 
+// autoStartTLS returns whether the connection is upgraded when the server offers STARTTLS
+func (c Config) autoStartTLS() bool {
+	return c.Default.EmailDelivery.SMTPSettings.AutoStartTLS == nil || *c.Default.EmailDelivery.SMTPSettings.AutoStartTLS
+}
+
+// encryption returns the encryption mode configured
+func (c Config) encryption() string {
+	if c.Default.EmailDelivery.SMTPSettings.SSL || c.Default.EmailDelivery.SMTPSettings.TLS {
+		return apps.EncryptionTLS
+	}
+	if !c.autoStartTLS() {
+		return apps.EncryptionNone
+	}
+	return apps.EncryptionAuto
+}
+
+// authMechanism returns the authentication mechanism configured. Redmine accepts
+// both strings and Ruby symbols (e.g. :login).
+func (c Config) authMechanism() string {
+	if c.Default.EmailDelivery.SMTPSettings.Username == "" {
+		return apps.AuthNone
+	}
+	switch strings.TrimPrefix(c.Default.EmailDelivery.SMTPSettings.Authentication, ":") {
+	case "plain":
+		return apps.AuthPlain
+	case "login":
+		return apps.AuthLogin
+	case "cram_md5":
+		return apps.AuthCRAMMD5
+	}
+	return apps.AuthNegotiate
+}
+
 // ValidateSMTPSettings checks the SMTPSettings are correct
 func (c *Config) ValidateSMTPSettings() error {
 	if c.Default.EmailDelivery.SMTPSettings.Address == "" {
@@ -58,23 +100,19 @@ func (c *Config) ValidateSMTPSettings() error {
 	if c.Default.EmailDelivery.SMTPSettings.Port == 0 {
 		return errors.New("port: invalid port")
 	}
-	if c.Default.EmailDelivery.SMTPSettings.Username == "" {
-		return errors.New("user_name: empty string")
-	}
-	if c.Default.EmailDelivery.SMTPSettings.Password == "" {
+	if c.Default.EmailDelivery.SMTPSettings.Username != "" && c.Default.EmailDelivery.SMTPSettings.Password == "" {
 		return errors.New("password: empty string")
 	}
 	if c.Default.EmailDelivery.SMTPSettings.Domain != c.Default.EmailDelivery.SMTPSettings.Address {
 		return errors.Errorf("address %s does not match domain %s on smtp_settings", c.Default.EmailDelivery.SMTPSettings.Address, c.Default.EmailDelivery.SMTPSettings.Domain)
 	}
-	if c.Default.EmailDelivery.SMTPSettings.Domain == "smtp.gmail.com" && !c.Default.EmailDelivery.SMTPSettings.AutoStartTLS {
-		return errors.New("use enable_starttls_auto when using smtp.gmail.com as domain")
-	}
-	return nil
+	return c.GetSMTPSettings().ValidateProvider()
 }
 
 // ParseConfig obtains an ApplicationConfig from by parsing a config file
-func ParseConfig(installDir string) (apps.ApplicationConfig, error) {
+func ParseConfig(_ context.Context, installDir string) (apps.ApplicationConfig, error) {
 	config := Config{}
-	return &config, apps.UnmarshalYAMLFile(filepath.Join(installDir, configFilePath), &config)
+	err := apps.UnmarshalYAMLFile(filepath.Join(installDir, ConfigFilePath), &config)
+	redact.Register(config.Default.EmailDelivery.SMTPSettings.Password)
+	return &config, err
 }
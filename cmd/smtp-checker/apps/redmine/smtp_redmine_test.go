@@ -41,6 +41,45 @@ func TestParseConfig(t *testing.T) {
 		if err != nil {
 			t.Errorf("Error validating SMTP data: %v", err)
 		}
+		if auth := config.GetSMTPSettings().Auth; auth != apps.AuthPlain {
+			t.Errorf("Incorrect authentication detected, expected: plain, got: %s", auth)
+		}
+	})
+}
+
+func TestGetSMTPSettings(t *testing.T) {
+	t.Run("Check relay without authentication", func(t *testing.T) {
+		config := Config{}
+		config.Default.EmailDelivery.SMTPSettings = SMTPSettings{Address: "relay.example.com", Domain: "relay.example.com", Port: 25}
+		if err := config.ValidateSMTPSettings(); err != nil {
+			t.Errorf("Error validating SMTP data: %v", err)
+		}
+		smtp := config.GetSMTPSettings()
+		if smtp.Auth != apps.AuthNone {
+			t.Errorf("Incorrect authentication detected, expected: none, got: %s", smtp.Auth)
+		}
+		if smtp.Encryption != apps.EncryptionAuto {
+			t.Errorf("Incorrect encryption detected, expected: auto, got: %s", smtp.Encryption)
+		}
+	})
+	t.Run("Check encryption", func(t *testing.T) {
+		disabled := false
+		config := Config{}
+		config.Default.EmailDelivery.SMTPSettings = SMTPSettings{AutoStartTLS: &disabled}
+		if e := config.GetSMTPSettings().Encryption; e != apps.EncryptionNone {
+			t.Errorf("Incorrect encryption detected, expected: none, got: %s", e)
+		}
+		config.Default.EmailDelivery.SMTPSettings.SSL = true
+		if e := config.GetSMTPSettings().Encryption; e != apps.EncryptionTLS {
+			t.Errorf("Incorrect encryption detected, expected: tls, got: %s", e)
+		}
+	})
+	t.Run("Check provider settings", func(t *testing.T) {
+		config := Config{}
+		config.Default.EmailDelivery.SMTPSettings = SMTPSettings{Address: "smtp.gmail.com", Domain: "smtp.gmail.com", Port: 587, SSL: true, Username: "user@gmail.com", Password: "pass"}
+		if err := config.ValidateSMTPSettings(); err == nil {
+			t.Errorf("Implicit TLS on port 587 of smtp.gmail.com not detected")
+		}
 	})
 }
 
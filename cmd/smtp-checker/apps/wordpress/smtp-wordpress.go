@@ -1,9 +1,12 @@
 package wordpress
 
 import (
+	"context"
 	"fmt"
 	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps"
 	"github.com/bitnami-labs/healthcheck-tools/pkg/mysql"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/redact"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/timeout"
 	"github.com/juju/errors"
 	"github.com/yvasiyarov/php_session_decoder/php_serialize"
 	"io/ioutil"
@@ -18,7 +21,8 @@ var (
 )
 
 const (
-	configFilePath = "apps/wordpress/htdocs/wp-config.php"
+	// ConfigFilePath is the path of the configuration file, relative to the installation directory
+	ConfigFilePath = "apps/wordpress/htdocs/wp-config.php"
 )
 
 // Config is a structure that contains the Mail/SMTP
@@ -51,13 +55,43 @@ type SMTPSettings struct {
 // GetSMTPSettings returns a SMTPSettings from Config structure
 func (c Config) GetSMTPSettings() *apps.SMTPSettings {
 	return &apps.SMTPSettings{
-		Host: c.SMTPSettings.Host,
-		Port: c.SMTPSettings.Port,
-		User: c.SMTPSettings.User,
-		Pass: c.SMTPSettings.Pass,
+		Host:       c.SMTPSettings.Host,
+		Port:       c.SMTPSettings.Port,
+		User:       c.SMTPSettings.User,
+		Pass:       c.SMTPSettings.Pass,
+		Encryption: c.encryption(),
+		Auth:       c.authMechanism(),
+		From:       c.Mail.FromMail,
+		FromName:   c.Mail.FromName,
 	}
 }
 
+// authMechanism returns the authentication mechanism used by the wp-mail-smtp
+// plugin, which only has an authentication switch and lets PHPMailer pick a
+// mechanism advertised by the server
+func (c Config) authMechanism() string {
+	if !c.SMTPSettings.Auth {
+		return apps.AuthNone
+	}
+	return apps.AuthNegotiate
+}
+
+// encryption returns the encryption mode used by the wp-mail-smtp plugin
+func (c Config) encryption() string {
+	switch c.SMTPSettings.Encrypt {
+	case "ssl":
+		return apps.EncryptionTLS
+	case "tls":
+		return apps.EncryptionSTARTTLS
+	case "none":
+		// autotls upgrades the connection whenever the server offers STARTTLS
+		if !c.SMTPSettings.AutoTLS {
+			return apps.EncryptionNone
+		}
+	}
+	return apps.EncryptionAuto
+}
+
 // ValidateSMTPSettings checks the SMTPSettings are correct
 func (c *Config) ValidateSMTPSettings() error {
 	if c.SMTPSettings.Host == "" {
@@ -66,16 +100,16 @@ func (c *Config) ValidateSMTPSettings() error {
 	if c.SMTPSettings.Port == 0 {
 		return errors.New("port: invalid port")
 	}
-	if c.SMTPSettings.User == "" {
+	if c.Mail.Mailer != "" && c.Mail.Mailer != "smtp" {
+		return errors.Errorf("mailer: wp-mail-smtp is configured to send mail using %q instead of smtp", c.Mail.Mailer)
+	}
+	if c.SMTPSettings.Auth && c.SMTPSettings.User == "" {
 		return errors.New("user: empty string")
 	}
-	if c.SMTPSettings.Pass == "" {
+	if c.SMTPSettings.Auth && c.SMTPSettings.Pass == "" {
 		return errors.New("password: empty string")
 	}
-	if c.SMTPSettings.Host == "smtp.gmail.com" && !c.SMTPSettings.AutoTLS {
-		return errors.New("set autotls to true when using smtp.gmail.com as domain")
-	}
-	return nil
+	return c.GetSMTPSettings().ValidateProvider()
 }
 
 func getProperty(buffer []byte, property string) string {
@@ -105,12 +139,12 @@ func checkPlugin(pluginsInfo string) error {
 	}
 	plugins, ok := val.(php_serialize.PhpArray)
 	if !ok {
-		return errors.Errorf("unable to convert %v to PhpArray", val)
+		return errors.Errorf("unable to convert %T to PhpArray", val)
 	}
 	for _, v := range plugins {
 		plugin, ok := v.(string)
 		if !ok {
-			return errors.Errorf("unable to convert %v to string", v)
+			return errors.Errorf("unable to convert %T to string", v)
 		}
 		if plugin == "wp-mail-smtp/wp_mail_smtp.php" {
 			return nil
@@ -119,16 +153,16 @@ func checkPlugin(pluginsInfo string) error {
 	return errors.New("wp-mail-smtp plugin not installed")
 }
 
-func checkPluginOnDatabase(database mysql.Database) error {
+func checkPluginOnDatabase(ctx context.Context, database mysql.Database) error {
 	query := mysql.Query{
 		Table:  "wp_options",
 		Column: "option_value",
 		Key:    "option_name",
 		Value:  "active_plugins",
 	}
-	queryResult, err := database.MySQLQuery(query)
+	queryResult, err := database.MySQLQuery(ctx, query)
 	if err != nil {
-		return err
+		return timeout.Wrap(ctx, "querying the active plugins", err)
 	}
 	return checkPlugin(queryResult)
 }
@@ -140,75 +174,75 @@ func obtainSMTP(smtpInfo string, config *Config) error {
 	}
 	arrays, ok := val.(php_serialize.PhpArray)
 	if !ok {
-		return errors.Errorf("unable to convert %v to PhpArray", val)
+		return errors.Errorf("unable to convert %T to PhpArray", val)
 	}
 	for key, array := range arrays {
 		switch key {
 		case "smtp":
 			settings, ok := array.(php_serialize.PhpArray)
 			if !ok {
-				return errors.Errorf("unable to convert %v to PhpArray", array)
+				return errors.Errorf("unable to convert the %v settings (%T) to PhpArray", key, array)
 			}
 			for s, v := range settings {
 				switch s {
 				case "host":
 					config.SMTPSettings.Host, ok = v.(string)
 					if !ok {
-						return errors.Errorf("unable to convert %v to string", v)
+						return errors.Errorf("unable to convert the %v setting (%T) to string", s, v)
 					}
 				case "port":
 					config.SMTPSettings.Port, ok = v.(int)
 					if !ok {
-						return errors.Errorf("unable to convert %v to int", v)
+						return errors.Errorf("unable to convert the %v setting (%T) to int", s, v)
 					}
-				case "encyrption":
+				case "encryption":
 					config.SMTPSettings.Encrypt, ok = v.(string)
 					if !ok {
-						return errors.Errorf("unable to convert %v to string", v)
+						return errors.Errorf("unable to convert the %v setting (%T) to string", s, v)
 					}
 				case "user":
 					config.SMTPSettings.User, ok = v.(string)
 					if !ok {
-						return errors.Errorf("unable to convert %v to string", v)
+						return errors.Errorf("unable to convert the %v setting (%T) to string", s, v)
 					}
 				case "pass":
 					config.SMTPSettings.Pass, ok = v.(string)
 					if !ok {
-						return errors.Errorf("unable to convert %v to string", v)
+						return errors.Errorf("unable to convert the %v setting (%T) to string", s, v)
 					}
 				case "auth":
 					config.SMTPSettings.Auth, ok = v.(bool)
 					if !ok {
-						return errors.Errorf("unable to convert %v to bool", v)
+						return errors.Errorf("unable to convert the %v setting (%T) to bool", s, v)
 					}
 				case "autotls":
 					config.SMTPSettings.AutoTLS, ok = v.(bool)
 					if !ok {
-						return errors.Errorf("unable to convert %v to bool", v)
+						return errors.Errorf("unable to convert the %v setting (%T) to bool", s, v)
 					}
 				}
 			}
 		case "mail":
 			settings, ok := array.(php_serialize.PhpArray)
 			if !ok {
-				return errors.Errorf("unable to convert %v to PhpArray", array)
+				return errors.Errorf("unable to convert the %v settings (%T) to PhpArray", key, array)
 			}
 			for s, v := range settings {
 				switch s {
 				case "from_email":
 					config.Mail.FromMail, ok = v.(string)
 					if !ok {
-						return errors.Errorf("unable to convert %v to string", v)
+						return errors.Errorf("unable to convert the %v setting (%T) to string", s, v)
 					}
 				case "from_name":
 					config.Mail.FromName, ok = v.(string)
 					if !ok {
-						return errors.Errorf("unable to convert %v to string", v)
+						return errors.Errorf("unable to convert the %v setting (%T) to string", s, v)
 					}
 				case "mailer":
 					config.Mail.Mailer, ok = v.(string)
 					if !ok {
-						return errors.Errorf("unable to convert %v to string", v)
+						return errors.Errorf("unable to convert the %v setting (%T) to string", s, v)
 					}
 				}
 			}
@@ -217,30 +251,33 @@ func obtainSMTP(smtpInfo string, config *Config) error {
 	return nil
 }
 
-func obtainSMTPFromDatabase(database mysql.Database, config *Config) error {
+func obtainSMTPFromDatabase(ctx context.Context, database mysql.Database, config *Config) error {
 	query := mysql.Query{
 		Table:  "wp_options",
 		Column: "option_value",
 		Key:    "option_name",
 		Value:  "wp_mail_smtp",
 	}
-	queryResult, err := database.MySQLQuery(query)
+	queryResult, err := database.MySQLQuery(ctx, query)
 	if err != nil {
-		return err
+		return timeout.Wrap(ctx, "querying the wp-mail-smtp settings", err)
 	}
 	return obtainSMTP(queryResult, config)
 }
 
 // QueryConfig obtains an ApplicationConfig from by querying the MySQL database
-func QueryConfig(installDir string) (apps.ApplicationConfig, error) {
+func QueryConfig(ctx context.Context, installDir string) (apps.ApplicationConfig, error) {
 	config := Config{}
-	database, err := parseWPDatabaseConfig(filepath.Join(installDir, configFilePath))
+	database, err := parseWPDatabaseConfig(filepath.Join(installDir, ConfigFilePath))
 	if err != nil {
 		return nil, errors.Errorf("error parsing wp-config.php file: %v", err)
 	}
-	err = checkPluginOnDatabase(database)
+	redact.Register(database.Pass)
+	err = checkPluginOnDatabase(ctx, database)
 	if err != nil {
 		return nil, errors.Errorf("error checking wp-mail-smtp plugin: %v", err)
 	}
-	return &config, obtainSMTPFromDatabase(database, &config)
+	err = obtainSMTPFromDatabase(ctx, database, &config)
+	redact.Register(config.SMTPSettings.Pass)
+	return &config, err
 }
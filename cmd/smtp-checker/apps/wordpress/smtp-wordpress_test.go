@@ -1,9 +1,11 @@
 package wordpress
 
 import (
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps"
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -95,6 +97,25 @@ func TestObtainSMTP(t *testing.T) {
 		if smtp.User != "smtp-user" {
 			t.Errorf("Incorrect SMTP user detected, expected: smtp-user, got: %s", smtp.User)
 		}
+		if smtp.Encryption != apps.EncryptionAuto {
+			t.Errorf("Incorrect SMTP encryption detected, expected: auto, got: %s", smtp.Encryption)
+		}
+		if smtp.Sender() != "user@example.com" || smtp.FromName != "user\\'s Blog!" {
+			t.Errorf("Incorrect sender detected, expected: user\\'s Blog! <user@example.com>, got: %s <%s>", smtp.FromName, smtp.Sender())
+		}
+		if smtp.Auth != apps.AuthNegotiate {
+			t.Errorf("Incorrect SMTP authentication detected, expected: negotiated, got: %s", smtp.Auth)
+		}
+	})
+}
+
+func TestObtainSMTPErrors(t *testing.T) {
+	t.Run("Check errors do not include setting values", func(t *testing.T) {
+		config := Config{}
+		err := obtainSMTP(`a:1:{s:4:"smtp";a:1:{s:4:"port";s:10:"s3cr3t-val";}}`, &config)
+		if err == nil || strings.Contains(err.Error(), "s3cr3t-val") {
+			t.Errorf("Incorrect error obtaining SMTP data, got: %v", err)
+		}
 	})
 }
 
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/smtp"
+	"strings"
+
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/juju/errors"
+)
+
+// isLocalhost reports whether the server runs in the same host, the only case in
+// which credentials are sent over an unencrypted connection, as smtp.PlainAuth does
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
+
+// loginAuth implements the LOGIN authentication mechanism
+type loginAuth struct {
+	username, password, host string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	}
+	return nil, errors.Errorf("unexpected LOGIN challenge: %q", fromServer)
+}
+
+// xoauth2Auth implements the XOAUTH2 authentication mechanism used by Gmail and Office 365
+type xoauth2Auth struct {
+	username, token, host string
+}
+
+func (a *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "XOAUTH2", []byte("user=" + a.username + "\x01auth=Bearer " + a.token + "\x01\x01"), nil
+}
+
+func (a *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		// The server sends the details of the failure as a challenge
+		return nil, errors.Errorf("XOAUTH2 token rejected: %s", fromServer)
+	}
+	return nil, nil
+}
+
+// newAuth returns the smtp.Auth of the authentication mechanism
+func newAuth(settings *apps.SMTPSettings, mechanism string) smtp.Auth {
+	switch mechanism {
+	case apps.AuthLogin:
+		return &loginAuth{settings.User, settings.Pass, settings.Host}
+	case apps.AuthCRAMMD5:
+		return smtp.CRAMMD5Auth(settings.User, settings.Pass)
+	case apps.AuthXOAUTH2:
+		return &xoauth2Auth{settings.User, settings.OAuth2Token, settings.Host}
+	}
+	return smtp.PlainAuth("", settings.User, settings.Pass, settings.Host)
+}
+
+// advertisesAuth checks the server advertises the mechanism among the ones in
+// the parameter of the AUTH extension
+func advertisesAuth(mechanisms, mechanism string) bool {
+	for _, m := range strings.Fields(mechanisms) {
+		if strings.EqualFold(m, mechanism) {
+			return true
+		}
+	}
+	return false
+}
+
+// chooseAuth returns the authentication mechanism configured or, when it is
+// negotiated, the preferred one among the mechanisms advertised by the server
+func chooseAuth(settings *apps.SMTPSettings, mechanisms string) (string, error) {
+	if settings.Auth != apps.AuthNegotiate {
+		if !advertisesAuth(mechanisms, settings.Auth) {
+			return "", errors.Errorf("%s:%d does not advertise the %s authentication mechanism (advertised: %s)", settings.Host, settings.Port, strings.ToUpper(settings.Auth), mechanisms)
+		}
+		return settings.Auth, nil
+	}
+	for _, m := range apps.NegotiatedAuthMechanisms {
+		if advertisesAuth(mechanisms, m) {
+			return m, nil
+		}
+	}
+	return "", errors.Errorf("%s:%d does not advertise any of the %s authentication mechanisms (advertised: %s)", settings.Host, settings.Port, strings.ToUpper(strings.Join(apps.NegotiatedAuthMechanisms, ", ")), mechanisms)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps/container"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/bundle"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/discovery"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/redact"
+)
+
+const defaultBundleOutput = "smtp-checker-bundle.tar.gz"
+
+// bundleSettings is a structure that contains the settings used
+// for the checks, as stored in the support bundle
+type bundleSettings struct {
+	InstallDir  string   `json:"install_dir"`
+	Application string   `json:"application,omitempty"`
+	Host        string   `json:"smtp_host"`
+	Port        int      `json:"smtp_port"`
+	User        string   `json:"smtp_user"`
+	Pass        string   `json:"smtp_password"`
+	Encryption  string   `json:"smtp_encryption,omitempty"`
+	Auth        string   `json:"smtp_auth,omitempty"`
+	Sender      string   `json:"mail_from"`
+	Recipients  []string `json:"mail_recipients"`
+}
+
+// WriteBundle writes a support bundle with the results of the checks, the settings
+// used and the configuration files of the application, or its container variables
+// if env is not nil. Secrets are redacted.
+func WriteBundle(output, installDir, app string, env map[string]string, smtp *apps.SMTPSettings, recipients []string, results []bundle.Result) error {
+	redact.Register(smtp.Pass)
+	b, err := bundle.Create(output, redact.Default)
+	if err != nil {
+		return err
+	}
+	err = writeBundleFiles(b, installDir, app, env, smtp, recipients, results)
+	if cerr := b.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func writeBundleFiles(b *bundle.Bundle, installDir, app string, env map[string]string, smtp *apps.SMTPSettings, recipients []string, results []bundle.Result) error {
+	if err := b.AddJSON("versions.json", bundle.NewVersions("smtp-checker", VERSION)); err != nil {
+		return err
+	}
+	if err := b.AddJSON("results.json", results); err != nil {
+		return err
+	}
+	settings := bundleSettings{installDir, app, smtp.Host, smtp.Port, smtp.User, "", smtp.Encryption, smtp.Auth, smtp.Sender(), recipients}
+	if smtp.Pass != "" {
+		settings.Pass = redact.Mask
+	}
+	if err := b.AddJSON("settings.json", settings); err != nil {
+		return err
+	}
+	if stack, err := discovery.Inspect(installDir); err == nil {
+		if err := b.AddJSON("stack.json", stack); err != nil {
+			return err
+		}
+	}
+	if env != nil {
+		vars := container.Variables(app, env)
+		return b.AddFile("config/container.env", []byte(strings.Join(vars, "\n")+"\n"))
+	}
+	for _, configFile := range configFiles(app) {
+		content, err := ioutil.ReadFile(filepath.Join(installDir, configFile))
+		if err != nil {
+			continue
+		}
+		if err := b.AddFile(path.Join("config", filepath.ToSlash(configFile)), content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
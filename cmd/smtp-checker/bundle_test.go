@@ -0,0 +1,259 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps/descriptor"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps/ghost"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps/mattermost"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps/redmine"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/bundle"
+)
+
+var testRedmineConfig = `
+default:
+  email_delivery:
+    delivery_method: :smtp
+    smtp_settings:
+      address: "smtp.example.com"
+      port: 587
+      user_name: "user@example.com"
+      password: "redmine-smtp-pass"
+`
+
+func TestWriteBundle(t *testing.T) {
+	installDir, err := ioutil.TempDir("", "bitnami")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(installDir)
+	configFile := filepath.Join(installDir, redmine.ConfigFilePath)
+	os.MkdirAll(filepath.Dir(configFile), 0755)
+	if err := ioutil.WriteFile(configFile, []byte(testRedmineConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(installDir, "bundle.tar.gz")
+
+	t.Run("Check support bundle content", func(t *testing.T) {
+		smtp := apps.SMTPSettings{Host: "smtp.example.com", Port: 587, User: "user@example.com", Pass: "redmine-smtp-pass"}
+		results := []bundle.Result{{Check: "sendmail", Status: bundle.Failed, Error: "535 bad password redmine-smtp-pass"}}
+		if err := WriteBundle(output, installDir, "redmine", nil, &smtp, []string{"test@example.com"}, results); err != nil {
+			t.Fatalf("error writing bundle: %v", err)
+		}
+		f, err := os.Open(output)
+		if err != nil {
+			t.Fatalf("error opening bundle: %v", err)
+		}
+		defer f.Close()
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("error decompressing bundle: %v", err)
+		}
+		tr := tar.NewReader(gz)
+		var names []string
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				break
+			}
+			names = append(names, hdr.Name)
+			content, _ := ioutil.ReadAll(tr)
+			if strings.Contains(string(content), "redmine-smtp-pass") {
+				t.Errorf("password not redacted in %s: %s", hdr.Name, content)
+			}
+		}
+		expected := []string{"results.json", "versions.json", "settings.json", "config/" + redmine.ConfigFilePath}
+		for _, e := range expected {
+			found := false
+			for _, n := range names {
+				if n == "bundle/"+e {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("file %s not found in bundle, got: %v", e, names)
+			}
+		}
+	})
+}
+
+var testJSONConfigs = map[string]struct {
+	configFile string
+	content    string
+	secrets    []string
+}{
+	"ghost": {ghost.ConfigFilePath, `{
+  "database": {
+    "client": "mysql",
+    "connection": {"host": "localhost", "user": "bn_ghost", "password": "ghost-db-pass", "database": "bitnami_ghost"}
+  },
+  "mail": {
+    "transport": "SMTP",
+    "options": {"host": "smtp.example.com", "port": 587, "auth": {"user": "user@example.com", "pass": "ghost-smtp-pass"}}
+  }
+}
+`, []string{"ghost-db-pass", "ghost-smtp-pass"}},
+	"mattermost": {mattermost.ConfigFilePath, `{
+  "SqlSettings": {
+    "DriverName": "mysql",
+    "DataSource": "mmuser:mm-db-pass@tcp(localhost:3306)/mattermost?charset=utf8mb4,utf8",
+    "DataSourceReplicas": ["mmuser:mm-replica-pass@tcp(replica:3306)/mattermost"],
+    "AtRestEncryptKey": "mm-at-rest-key"
+  },
+  "FileSettings": {"PublicLinkSalt": "mm-link-salt"},
+  "EmailSettings": {"SMTPUsername": "user@example.com", "SMTPPassword": "mm-smtp-pass", "SMTPServer": "smtp.example.com"}
+}
+`, []string{"mm-db-pass", "mm-replica-pass", "mm-at-rest-key", "mm-link-salt", "mm-smtp-pass"}},
+}
+
+func TestWriteBundleJSONConfig(t *testing.T) {
+	for app, tt := range testJSONConfigs {
+		t.Run("Check secrets of the "+app+" configuration are redacted", func(t *testing.T) {
+			installDir, err := ioutil.TempDir("", "bitnami")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(installDir)
+			configFile := filepath.Join(installDir, tt.configFile)
+			os.MkdirAll(filepath.Dir(configFile), 0755)
+			if err := ioutil.WriteFile(configFile, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			output := filepath.Join(installDir, "bundle.tar.gz")
+			smtp := apps.SMTPSettings{Host: "smtp.example.com", Port: 587, User: "user@example.com"}
+			if err := WriteBundle(output, installDir, app, nil, &smtp, []string{"test@example.com"}, nil); err != nil {
+				t.Fatalf("error writing bundle: %v", err)
+			}
+			f, err := os.Open(output)
+			if err != nil {
+				t.Fatalf("error opening bundle: %v", err)
+			}
+			defer f.Close()
+			gz, err := gzip.NewReader(f)
+			if err != nil {
+				t.Fatalf("error decompressing bundle: %v", err)
+			}
+			tr := tar.NewReader(gz)
+			found := false
+			for {
+				hdr, err := tr.Next()
+				if err != nil {
+					break
+				}
+				content, _ := ioutil.ReadAll(tr)
+				if hdr.Name != "bundle/config/"+tt.configFile {
+					continue
+				}
+				found = true
+				for _, secret := range tt.secrets {
+					if strings.Contains(string(content), secret) {
+						t.Errorf("secret %q not redacted in %s: %s", secret, hdr.Name, content)
+					}
+				}
+				if !strings.Contains(string(content), "smtp.example.com") {
+					t.Errorf("unexpected redaction of the SMTP host in %s: %s", hdr.Name, content)
+				}
+			}
+			if !found {
+				t.Errorf("file config/%s not found in bundle", tt.configFile)
+			}
+		})
+	}
+}
+
+func TestWriteBundleDescriptorConfig(t *testing.T) {
+	installDir, err := ioutil.TempDir("", "bitnami")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(installDir)
+	configPath := "apps/discourse/conf/discourse.conf"
+	configFile := filepath.Join(installDir, configPath)
+	os.MkdirAll(filepath.Dir(configFile), 0755)
+	if err := ioutil.WriteFile(configFile, []byte("smtp_address = smtp.example.com\nsmtp_password = discourse-smtp-pass\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	descriptors["discourse"] = &descriptor.Descriptor{Name: "discourse", ConfigFile: configPath, Source: "discourse.yml"}
+	defer delete(descriptors, "discourse")
+	output := filepath.Join(installDir, "bundle.tar.gz")
+
+	t.Run("Check the configuration file of the descriptor is included", func(t *testing.T) {
+		smtp := apps.SMTPSettings{Host: "smtp.example.com", Port: 587, User: "user@example.com", Pass: "discourse-smtp-pass"}
+		if err := WriteBundle(output, installDir, "discourse", nil, &smtp, []string{"test@example.com"}, nil); err != nil {
+			t.Fatalf("error writing bundle: %v", err)
+		}
+		f, err := os.Open(output)
+		if err != nil {
+			t.Fatalf("error opening bundle: %v", err)
+		}
+		defer f.Close()
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("error decompressing bundle: %v", err)
+		}
+		tr := tar.NewReader(gz)
+		found := false
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				break
+			}
+			content, _ := ioutil.ReadAll(tr)
+			if strings.Contains(string(content), "discourse-smtp-pass") {
+				t.Errorf("password not redacted in %s: %s", hdr.Name, content)
+			}
+			found = found || hdr.Name == "bundle/config/"+configPath
+		}
+		if !found {
+			t.Errorf("file config/%s not found in bundle", configPath)
+		}
+	})
+}
+
+func TestWriteBundleContainerEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitnami")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "bundle.tar.gz")
+	env := map[string]string{"WORDPRESS_SMTP_HOST": "smtp.example.com", "WORDPRESS_SMTP_PASSWORD": "container-smtp-pass", "HOME": "/root"}
+
+	t.Run("Check the container variables are included", func(t *testing.T) {
+		smtp := apps.SMTPSettings{Host: "smtp.example.com", Port: 587, User: "user@example.com", Pass: "container-smtp-pass"}
+		if err := WriteBundle(output, dir, "wordpress", env, &smtp, []string{"test@example.com"}, nil); err != nil {
+			t.Fatalf("error writing bundle: %v", err)
+		}
+		f, err := os.Open(output)
+		if err != nil {
+			t.Fatalf("error opening bundle: %v", err)
+		}
+		defer f.Close()
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("error decompressing bundle: %v", err)
+		}
+		tr := tar.NewReader(gz)
+		var content string
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				break
+			}
+			c, _ := ioutil.ReadAll(tr)
+			if hdr.Name == "bundle/config/container.env" {
+				content = string(c)
+			}
+		}
+		if !strings.Contains(content, "WORDPRESS_SMTP_HOST=smtp.example.com") || strings.Contains(content, "container-smtp-pass") || strings.Contains(content, "HOME") {
+			t.Errorf("Incorrect container variables in bundle: %q", content)
+		}
+	})
+}
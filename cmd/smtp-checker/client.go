@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+
+	"github.com/bitnami-labs/healthcheck-tools/pkg/redact"
+)
+
+// smtpClient is a SMTP client equivalent to smtp.Client that records the dialogue
+// with the server in a transcript. Unlike smtp.Client, the commands sent after
+// STARTTLS are recorded in clear.
+type smtpClient struct {
+	conn       net.Conn
+	text       *textproto.Conn
+	serverName string
+	ext        map[string]string
+	auth       []string
+	tls        bool
+	trace      *transcript
+}
+
+// newSMTPClient reads the server greeting from conn. The transcript may be nil.
+func newSMTPClient(conn net.Conn, host string, tr *transcript) (*smtpClient, error) {
+	_, isTLS := conn.(*tls.Conn)
+	c := &smtpClient{conn: conn, text: textproto.NewConn(conn), serverName: host, tls: isTLS, trace: tr}
+	if _, _, err := c.readResponse(220); err != nil {
+		c.text.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// readResponse reads the reply of the server and records it
+func (c *smtpClient) readResponse(expectCode int) (int, string, error) {
+	code, msg, err := c.text.ReadResponse(expectCode)
+	if code != 0 {
+		c.trace.server(code, msg)
+	}
+	return code, msg, err
+}
+
+// send sends a command, recording traced instead of the command itself, and
+// reads the reply
+func (c *smtpClient) send(line, traced string, expectCode int) (int, string, error) {
+	c.trace.client(traced)
+	id, err := c.text.Cmd("%s", line)
+	if err != nil {
+		return 0, "", err
+	}
+	c.text.StartResponse(id)
+	defer c.text.EndResponse(id)
+	return c.readResponse(expectCode)
+}
+
+func (c *smtpClient) cmd(expectCode int, format string, args ...interface{}) (int, string, error) {
+	line := fmt.Sprintf(format, args...)
+	return c.send(line, line, expectCode)
+}
+
+// Hello sends EHLO, falling back to HELO for servers without ESMTP
+func (c *smtpClient) Hello(localName string) error {
+	_, msg, err := c.cmd(250, "EHLO %s", localName)
+	if err != nil {
+		_, _, err = c.cmd(250, "HELO %s", localName)
+		return err
+	}
+	c.ext = map[string]string{}
+	lines := strings.Split(msg, "\n")
+	for _, line := range lines[1:] {
+		kv := strings.SplitN(line, " ", 2)
+		if len(kv) == 1 {
+			kv = append(kv, "")
+		}
+		c.ext[strings.ToUpper(kv[0])] = kv[1]
+	}
+	if mechs, ok := c.ext["AUTH"]; ok {
+		c.auth = strings.Fields(mechs)
+	}
+	return nil
+}
+
+// Extension reports whether the server supports an extension, and its parameter
+func (c *smtpClient) Extension(ext string) (bool, string) {
+	param, ok := c.ext[strings.ToUpper(ext)]
+	return ok, param
+}
+
+// StartTLS upgrades the connection and sends EHLO again
+func (c *smtpClient) StartTLS(config *tls.Config) error {
+	if _, _, err := c.cmd(220, "STARTTLS"); err != nil {
+		return err
+	}
+	tlsConn := tls.Client(c.conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		c.trace.note("TLS handshake failed: %v", err)
+		return err
+	}
+	c.trace.note("%s established", tlsVersionName(tlsConn.ConnectionState().Version))
+	c.conn = tlsConn
+	c.text = textproto.NewConn(tlsConn)
+	c.tls = true
+	return c.Hello("localhost")
+}
+
+// TLSConnectionState returns the state of the TLS connection, if any
+func (c *smtpClient) TLSConnectionState() (tls.ConnectionState, bool) {
+	tc, ok := c.conn.(*tls.Conn)
+	if !ok {
+		return tls.ConnectionState{}, false
+	}
+	return tc.ConnectionState(), true
+}
+
+// Auth authenticates with the mechanism of a, as smtp.Client does. The
+// credentials are masked in the transcript.
+func (c *smtpClient) Auth(a smtp.Auth) error {
+	encoding := base64.StdEncoding
+	mech, resp, err := a.Start(&smtp.ServerInfo{Name: c.serverName, TLS: c.tls, Auth: c.auth})
+	if err != nil {
+		c.Quit()
+		return err
+	}
+	line, traced := "AUTH "+mech, "AUTH "+mech
+	if resp != nil {
+		line += " " + encoding.EncodeToString(resp)
+		traced += " " + redact.Mask
+	}
+	code, msg64, err := c.send(line, traced, 0)
+	for err == nil {
+		var msg []byte
+		switch code {
+		case 334:
+			msg, err = encoding.DecodeString(msg64)
+		case 235:
+			// the last message isn't base64 because it isn't a challenge
+			msg = []byte(msg64)
+		default:
+			err = &textproto.Error{Code: code, Msg: msg64}
+		}
+		if err == nil {
+			resp, err = a.Next(msg, code == 334)
+		}
+		if err != nil {
+			// abort the AUTH
+			c.send("*", "*", 501)
+			c.Quit()
+			break
+		}
+		if resp == nil {
+			break
+		}
+		code, msg64, err = c.send(encoding.EncodeToString(resp), redact.Mask, 0)
+	}
+	return err
+}
+
+// Mail sends MAIL FROM
+func (c *smtpClient) Mail(from string) error {
+	line := fmt.Sprintf("MAIL FROM:<%s>", from)
+	if ok, _ := c.Extension("8BITMIME"); ok {
+		line += " BODY=8BITMIME"
+	}
+	_, _, err := c.send(line, line, 250)
+	return err
+}
+
+// Rcpt sends RCPT TO
+func (c *smtpClient) Rcpt(to string) error {
+	_, _, err := c.cmd(25, "RCPT TO:<%s>", to)
+	return err
+}
+
+type dataCloser struct {
+	c *smtpClient
+	io.WriteCloser
+	n int
+}
+
+func (d *dataCloser) Write(p []byte) (int, error) {
+	n, err := d.WriteCloser.Write(p)
+	d.n += n
+	return n, err
+}
+
+func (d *dataCloser) Close() error {
+	if err := d.WriteCloser.Close(); err != nil {
+		return err
+	}
+	d.c.trace.client(fmt.Sprintf("[message of %d bytes]", d.n))
+	d.c.trace.client(".")
+	_, _, err := d.c.readResponse(250)
+	return err
+}
+
+// Data sends DATA and returns a writer for the message, which is sent when closed
+func (c *smtpClient) Data() (io.WriteCloser, error) {
+	if _, _, err := c.cmd(354, "DATA"); err != nil {
+		return nil, err
+	}
+	return &dataCloser{c: c, WriteCloser: c.text.DotWriter()}, nil
+}
+
+// Quit sends QUIT and closes the connection
+func (c *smtpClient) Quit() error {
+	if _, _, err := c.cmd(221, "QUIT"); err != nil {
+		c.text.Close()
+		return err
+	}
+	return c.text.Close()
+}
+
+// Close closes the connection
+func (c *smtpClient) Close() error {
+	return c.text.Close()
+}
@@ -0,0 +1,196 @@
+// Package diagnosis provides functions for classifying the replies of SMTP
+// servers into known failure categories, with hints to fix them
+package diagnosis
+
+import (
+	"fmt"
+	"net/textproto"
+	"regexp"
+	"strings"
+
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/providers"
+	"github.com/juju/errors"
+)
+
+// Failure categories
+const (
+	BadCredentials      = "bad credentials"
+	AuthRequired        = "authentication required"
+	AppPasswordRequired = "app password required"
+	RelayDenied         = "relay denied"
+	SenderNotAllowed    = "sender not allowed"
+	TLSRequired         = "TLS required"
+	RateLimited         = "rate limited"
+	Greylisted          = "greylisted"
+)
+
+// Providers with specific hints. They match the names of the provider presets.
+const (
+	Gmail     = "gmail"
+	Office365 = "office365"
+	SES       = "ses"
+	SendGrid  = "sendgrid"
+	Mailgun   = "mailgun"
+)
+
+// enhancedCodeRe matches the enhanced status code (RFC 3463) at the start of a reply
+var enhancedCodeRe = regexp.MustCompile(`^([245]\.\d{1,3}\.\d{1,3})\b`)
+
+// rule classifies the replies with one of the enhanced codes, or containing one
+// of the texts (in lowercase)
+type rule struct {
+	category string
+	codes    []string
+	texts    []string
+}
+
+// rules are evaluated in order, the first one matching wins
+var rules = []rule{
+	{AppPasswordRequired, []string{"5.7.9", "5.7.139"}, []string{"application-specific password", "app password", "please log in via your web browser", "basic authentication is disabled", "smtpclientauthentication is disabled"}},
+	{TLSRequired, []string{"5.7.11"}, []string{"starttls", "must issue a starttls", "tls required", "encryption required", "must use tls", "secure connection"}},
+	{AuthRequired, nil, []string{"authentication required", "authentication is required", "unauthenticated", "must authenticate", "auth first"}},
+	{RateLimited, []string{"5.4.5", "4.7.28", "5.2.252"}, []string{"rate limit", "rate exceeded", "sending rate", "quota", "too many", "limit exceeded", "throttl"}},
+	{Greylisted, nil, []string{"greylist", "graylist", "temporarily deferred"}},
+	{SenderNotAllowed, []string{"5.7.60", "5.1.7", "5.1.8"}, []string{"sender address rejected", "not verified", "verified sender identity", "sendasdenied", "not owned by", "not allowed to send as", "from address", "sender domain"}},
+	{RelayDenied, []string{"5.7.64"}, []string{"relay", "relaying"}},
+	{BadCredentials, []string{"5.7.8", "5.7.3", "5.7.57"}, []string{"authentication failed", "authentication unsuccessful", "not accepted", "invalid credentials", "authentication credentials invalid", "not authenticated"}},
+}
+
+// Reply is a reply of the SMTP server
+type Reply struct {
+	Code         int
+	EnhancedCode string
+	Message      string
+}
+
+// ParseReply extracts the enhanced status code from the message of a reply
+func ParseReply(code int, msg string) Reply {
+	r := Reply{Code: code, Message: msg}
+	if m := enhancedCodeRe.FindStringSubmatch(msg); m != nil {
+		r.EnhancedCode = m[1]
+	}
+	return r
+}
+
+// Classify returns the failure category of a reply, or an empty string if unknown
+func Classify(r Reply) string {
+	text := strings.ToLower(r.Message)
+	for _, rule := range rules {
+		for _, code := range rule.codes {
+			if r.EnhancedCode == code {
+				return rule.category
+			}
+		}
+		for _, t := range rule.texts {
+			if strings.Contains(text, t) {
+				return rule.category
+			}
+		}
+	}
+	// Fall back to the reply codes
+	switch {
+	case r.Code == 535 || r.Code == 534:
+		return BadCredentials
+	case r.Code == 538:
+		return TLSRequired
+	case r.Code == 530:
+		return AuthRequired
+	case r.Code == 450 || r.Code == 451:
+		return Greylisted
+	}
+	return ""
+}
+
+// Provider returns the provider of a SMTP server, or an empty string if unknown
+func Provider(host string) string {
+	if p := providers.Lookup(host); p != nil {
+		return p.Name
+	}
+	return ""
+}
+
+// hints contains the hint of each category, by provider. The empty provider
+// contains the generic hints.
+var hints = map[string]map[string]string{
+	BadCredentials: {
+		"":        "check the SMTP user and password configured in the application",
+		Gmail:     "use the full Gmail address as user; with 2-Step Verification enabled, the account password is not accepted and an app password is required",
+		Office365: "use the full mailbox address as user, and check SMTP AUTH is enabled for the mailbox in the Microsoft 365 admin center",
+		SES:       "SES requires SMTP credentials created in the SES console (or derived from an IAM secret key for the region), not the AWS access keys",
+		SendGrid:  "the user must be the literal string \"apikey\" and the password a SendGrid API key with the Mail Send permission",
+		Mailgun:   "use the SMTP credentials of the sending domain (e.g. postmaster@mg.example.com) shown in the Mailgun dashboard",
+	},
+	AuthRequired: {
+		"":        "the server only accepts mail from authenticated clients; configure the SMTP user and password in the application",
+		Office365: "Office 365 requires SMTP AUTH on smtp.office365.com; configure the mailbox address and password in the application, or use OAuth2 (-smtp_auth xoauth2)",
+	},
+	AppPasswordRequired: {
+		"":        "the provider does not accept the account password for SMTP, generate an app password or use OAuth2 (-smtp_auth xoauth2)",
+		Gmail:     "Google does not accept the account password from applications; enable 2-Step Verification, generate an app password at https://myaccount.google.com/apppasswords and use it as password, or use OAuth2 (-smtp_auth xoauth2)",
+		Office365: "basic authentication (SMTP AUTH) is disabled for the tenant or the mailbox; enable Authenticated SMTP for the mailbox or use OAuth2 (-smtp_auth xoauth2)",
+	},
+	RelayDenied: {
+		"":        "the server does not relay mail for this client; authenticate with the SMTP user or allow the IP address of this server in the relay",
+		Gmail:     "the Gmail SMTP relay (smtp-relay.gmail.com) only accepts the IP addresses allowed in the Google Workspace admin console, or authenticated users",
+		Office365: "direct send and connectors only accept mail for the tenant domains; use smtp.office365.com with SMTP AUTH or add the IP address of this server to an inbound connector",
+	},
+	SenderNotAllowed: {
+		"":        "the SMTP user is not allowed to send mail with this sender address; use the address of the SMTP user or one of the addresses verified in the provider",
+		Gmail:     "Gmail rewrites or rejects senders other than the account address and its verified aliases (\"Send mail as\" in the Gmail settings)",
+		Office365: "the mailbox needs the Send As permission on the sender address, or the sender must be the mailbox address",
+		SES:       "verify the sender address or domain in SES for this region; while in the sandbox, the recipients must be verified too",
+		SendGrid:  "the sender must match a verified Sender Identity (single sender or authenticated domain) in SendGrid",
+		Mailgun:   "the sender must belong to a domain added and verified in Mailgun",
+	},
+	TLSRequired: {
+		"":        "the server requires an encrypted connection; use -smtp_encryption starttls (port 587) or tls (port 465)",
+		Gmail:     "use port 587 with STARTTLS or port 465 with implicit TLS",
+		Office365: "use port 587 with STARTTLS; Office 365 does not offer implicit TLS on port 465",
+	},
+	RateLimited: {
+		"":        "the server limits the number of mails; wait before retrying and check the sending limits of the account",
+		Gmail:     "Gmail limits the number of mails per day (about 500 for personal accounts, 2000 for Google Workspace), wait 24 hours or use a transactional mail provider",
+		Office365: "Office 365 limits each mailbox to 30 mails per minute and 10000 recipients per day",
+		SES:       "the maximum sending rate or the daily quota of the SES account was exceeded; request a quota increase in the SES console",
+		SendGrid:  "the plan limits were exceeded, check the usage in the SendGrid dashboard",
+		Mailgun:   "the sending limits of the domain were exceeded, check the Mailgun dashboard",
+	},
+	Greylisted: {
+		"": "the server temporarily deferred the mail, as greylisting servers do with unknown senders; the mail is usually accepted when retried after a few minutes",
+	},
+}
+
+// Hint returns the hint for a failure category, specific to the provider if possible
+func Hint(category, provider string) string {
+	if hint, ok := hints[category][provider]; ok {
+		return hint
+	}
+	return hints[category][""]
+}
+
+// Error is a SMTP error with its failure category and a hint to fix it
+type Error struct {
+	Err      error
+	Reply    Reply
+	Category string
+	Hint     string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v (%s)", e.Category, e.Err, e.Hint)
+}
+
+// Diagnose classifies err if it is caused by a reply of the SMTP server at host,
+// returning an *Error. Other errors are returned as is.
+func Diagnose(err error, host string) error {
+	tpErr, ok := errors.Cause(err).(*textproto.Error)
+	if !ok {
+		return err
+	}
+	r := ParseReply(tpErr.Code, tpErr.Msg)
+	category := Classify(r)
+	if category == "" {
+		return err
+	}
+	return &Error{Err: err, Reply: r, Category: category, Hint: Hint(category, Provider(host))}
+}
@@ -0,0 +1,97 @@
+package diagnosis
+
+import (
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/juju/errors"
+)
+
+func TestClassify(t *testing.T) {
+	testData := []struct {
+		code     int
+		msg      string
+		category string
+	}{
+		{535, "5.7.8 Username and Password not accepted. Learn more at https://support.google.com/mail/?p=BadCredentials", BadCredentials},
+		{534, "5.7.9 Application-specific password required. Learn more at https://support.google.com/mail/?p=InvalidSecondFactor", AppPasswordRequired},
+		{535, "5.7.139 Authentication unsuccessful, SmtpClientAuthentication is disabled for the Tenant.", AppPasswordRequired},
+		{530, "5.7.0 Must issue a STARTTLS command first.", TLSRequired},
+		{530, "5.7.0 Authentication Required. Learn more at https://support.google.com/mail/?p=WantAuthError", AuthRequired},
+		{530, "Authentication required", AuthRequired},
+		{550, "5.7.1 Unauthenticated senders not allowed", AuthRequired},
+		{550, "5.7.1 Relaying denied", RelayDenied},
+		{554, "5.7.1 <test@example.com>: Relay access denied", RelayDenied},
+		{554, "Message rejected: Email address is not verified. The following identities failed the check in region US-EAST-1: wordpress@example.com", SenderNotAllowed},
+		{550, "The from address does not match a verified Sender Identity.", SenderNotAllowed},
+		{550, "5.7.60 SMTP; Client does not have permissions to send as this sender", SenderNotAllowed},
+		{454, "Throttling failure: Maximum sending rate exceeded.", RateLimited},
+		{550, "5.4.5 Daily user sending quota exceeded.", RateLimited},
+		{451, "4.7.1 Greylisted, please try again in 300 seconds", Greylisted},
+		{451, "4.7.1 Please try again later (rate limit exceeded)", RateLimited},
+		{451, "4.3.0 Temporary local problem, please try again later", Greylisted},
+		{421, "4.3.2 Service not available, closing transmission channel", ""},
+		{535, "Error: authentication failed", BadCredentials},
+		{550, "5.1.1 User unknown", ""},
+	}
+	t.Run("Check SMTP replies are classified", func(t *testing.T) {
+		for _, tt := range testData {
+			if category := Classify(ParseReply(tt.code, tt.msg)); category != tt.category {
+				t.Errorf("Incorrect category for %d %s, expected: %q, got: %q", tt.code, tt.msg, tt.category, category)
+			}
+		}
+	})
+	t.Run("Check enhanced status codes are parsed", func(t *testing.T) {
+		if r := ParseReply(535, "5.7.8 Authentication credentials invalid"); r.EnhancedCode != "5.7.8" {
+			t.Errorf("Incorrect enhanced code, expected: 5.7.8, got: %q", r.EnhancedCode)
+		}
+	})
+}
+
+func TestDiagnose(t *testing.T) {
+	t.Run("Check provider specific hints", func(t *testing.T) {
+		cause := &textproto.Error{Code: 535, Msg: "5.7.8 Username and Password not accepted"}
+		err := Diagnose(errors.Annotate(cause, "authenticating"), "smtp.gmail.com")
+		dErr, ok := err.(*Error)
+		if !ok {
+			t.Fatalf("Incorrect error type, expected: *Error, got: %T", err)
+		}
+		if dErr.Category != BadCredentials || !strings.Contains(dErr.Hint, "app password") {
+			t.Errorf("Incorrect diagnosis, got: %v", dErr)
+		}
+		if !strings.Contains(err.Error(), "authenticating: 535") {
+			t.Errorf("Original error not included, got: %v", err)
+		}
+	})
+	t.Run("Check generic hints", func(t *testing.T) {
+		err := Diagnose(&textproto.Error{Code: 550, Msg: "5.7.1 Relaying denied"}, "mail.example.com")
+		if dErr, ok := err.(*Error); !ok || dErr.Hint != Hint(RelayDenied, "") {
+			t.Errorf("Incorrect diagnosis, got: %v", err)
+		}
+	})
+	t.Run("Check other errors are not modified", func(t *testing.T) {
+		cause := errors.New("connection refused")
+		if err := Diagnose(cause, "smtp.gmail.com"); err != cause {
+			t.Errorf("Incorrect error, expected: %v, got: %v", cause, err)
+		}
+	})
+}
+
+func TestProvider(t *testing.T) {
+	testData := map[string]string{
+		"smtp.gmail.com":                     Gmail,
+		"smtp.office365.com":                 Office365,
+		"email-smtp.eu-west-1.amazonaws.com": SES,
+		"smtp.sendgrid.net":                  SendGrid,
+		"smtp.eu.mailgun.org":                Mailgun,
+		"mail.example.com":                   "",
+	}
+	t.Run("Check providers are detected", func(t *testing.T) {
+		for host, provider := range testData {
+			if got := Provider(host); got != provider {
+				t.Errorf("Incorrect provider for %s, expected: %q, got: %q", host, provider, got)
+			}
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package mailauth
+
+import (
+	"context"
+	"net"
+	"strings"
+)
+
+// DefaultDKIMSelectors contains the selectors used by the most common providers
+// and mail servers. A DKIM selector cannot be discovered from the DNS, so these
+// are tried unless the selectors are provided.
+var DefaultDKIMSelectors = []string{
+	"default", "dkim", "mail", "smtp", "k1", "k2", "s1", "s2",
+	"selector1", "selector2", "google", "mandrill", "mxvault", "zoho", "amazonses",
+}
+
+// DKIMKey is a DKIM public key published in the DNS
+type DKIMKey struct {
+	Selector string
+	Record   string
+	KeyType  string
+	Revoked  bool
+}
+
+// LookupDKIM returns the DKIM keys found for the selectors in <selector>._domainkey.<domain>
+func LookupDKIM(ctx context.Context, r *net.Resolver, domain string, selectors []string) ([]DKIMKey, error) {
+	var keys []DKIMKey
+	for _, selector := range selectors {
+		txts, err := lookupTXT(ctx, r, selector+"._domainkey."+domain)
+		if err != nil {
+			return keys, err
+		}
+		// Long keys are split in several strings, which LookupTXT already joins
+		record := strings.Join(txts, "")
+		t := tags(record)
+		if _, ok := t["p"]; !ok {
+			continue
+		}
+		key := DKIMKey{Selector: selector, Record: record, KeyType: t["k"], Revoked: t["p"] == ""}
+		if key.KeyType == "" {
+			key.KeyType = "rsa"
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
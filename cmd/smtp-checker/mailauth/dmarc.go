@@ -0,0 +1,71 @@
+package mailauth
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// DMARC is a DMARC policy, as defined in RFC 7489
+type DMARC struct {
+	Domain          string
+	Record          string
+	Policy          string
+	SubdomainPolicy string
+	ADKIM           string
+	ASPF            string
+	Reports         string
+}
+
+// LookupDMARC returns the DMARC policy of domain, falling back to the one of its
+// organizational domain. It returns nil if there is none.
+func LookupDMARC(ctx context.Context, r *net.Resolver, domain string) (*DMARC, error) {
+	names := []string{domain}
+	if org := OrganizationalDomain(domain); org != domain {
+		names = append(names, org)
+	}
+	for _, name := range names {
+		txts, err := lookupTXT(ctx, r, "_dmarc."+name)
+		if err != nil {
+			return nil, err
+		}
+		for _, txt := range txts {
+			if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(txt)), "V=DMARC1") {
+				continue
+			}
+			t := tags(txt)
+			d := &DMARC{
+				Domain:          name,
+				Record:          txt,
+				Policy:          strings.ToLower(t["p"]),
+				SubdomainPolicy: strings.ToLower(t["sp"]),
+				ADKIM:           strings.ToLower(t["adkim"]),
+				ASPF:            strings.ToLower(t["aspf"]),
+				Reports:         t["rua"],
+			}
+			switch d.Policy {
+			case "none", "quarantine", "reject":
+			default:
+				return d, errors.Errorf("invalid DMARC policy %q in _dmarc.%s", t["p"], name)
+			}
+			if d.ADKIM == "" {
+				d.ADKIM = "r"
+			}
+			if d.ASPF == "" {
+				d.ASPF = "r"
+			}
+			return d, nil
+		}
+	}
+	return nil, nil
+}
+
+// Effective returns the policy applied to mails from domain
+func (d *DMARC) Effective(domain string) string {
+	if d.SubdomainPolicy != "" && !strings.EqualFold(domain, d.Domain) {
+		return d.SubdomainPolicy
+	}
+	return d.Policy
+}
@@ -0,0 +1,88 @@
+// Package mailauth provides functions for checking the SPF, DKIM and DMARC
+// records that allow receivers to authenticate the mails of a domain
+package mailauth
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+)
+
+// NewResolver returns a resolver that sends the DNS queries to addr (host:port).
+// An empty addr means the resolver configured in the system.
+func NewResolver(addr string) *net.Resolver {
+	if addr == "" {
+		return net.DefaultResolver
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "53")
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			d := net.Dialer{Timeout: 5 * time.Second}
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// notFound returns whether err means the DNS name or record does not exist
+func notFound(err error) bool {
+	dnsErr, ok := err.(*net.DNSError)
+	return ok && !dnsErr.Temporary() && !dnsErr.Timeout()
+}
+
+// lookupTXT returns the TXT records of name, or none if it does not exist
+func lookupTXT(ctx context.Context, r *net.Resolver, name string) ([]string, error) {
+	txts, err := r.LookupTXT(ctx, name)
+	if err != nil && notFound(err) {
+		return nil, nil
+	}
+	return txts, err
+}
+
+// tags parses a "k=v; k=v" record, such as DKIM and DMARC ones
+func tags(record string) map[string]string {
+	res := map[string]string{}
+	for _, tag := range strings.Split(record, ";") {
+		kv := strings.SplitN(tag, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		res[strings.ToLower(strings.TrimSpace(kv[0]))] = strings.TrimSpace(kv[1])
+	}
+	return res
+}
+
+// Domain returns the domain of a mail address
+func Domain(address string) string {
+	return strings.ToLower(address[strings.LastIndex(address, "@")+1:])
+}
+
+// OrganizationalDomain returns an approximation of the organizational domain
+// used in the DMARC relaxed alignment: the last two labels, or three when the
+// second-level one is a generic one such as co.uk or com.au
+func OrganizationalDomain(domain string) string {
+	labels := strings.Split(strings.TrimSuffix(strings.ToLower(domain), "."), ".")
+	n := 2
+	if len(labels) > 2 && len(labels[len(labels)-1]) == 2 {
+		switch labels[len(labels)-2] {
+		case "co", "com", "net", "org", "gov", "edu", "ac":
+			n = 3
+		}
+	}
+	if len(labels) <= n {
+		return strings.Join(labels, ".")
+	}
+	return strings.Join(labels[len(labels)-n:], ".")
+}
+
+// Aligned returns whether two domains are aligned in strict ("s") or relaxed mode
+func Aligned(a, b, mode string) bool {
+	a, b = strings.ToLower(strings.TrimSuffix(a, ".")), strings.ToLower(strings.TrimSuffix(b, "."))
+	if mode == "s" {
+		return a == b
+	}
+	return OrganizationalDomain(a) == OrganizationalDomain(b)
+}
@@ -0,0 +1,243 @@
+package mailauth
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// DNS record types served by the fake DNS server
+const (
+	typeA    = 1
+	typeMX   = 15
+	typeTXT  = 16
+	typeAAAA = 28
+)
+
+// zone maps "name/type" to the records returned by the fake DNS server. A and
+// AAAA records are IP addresses, MX records are host names.
+type zone map[string][]string
+
+// fakeDNS starts a minimal DNS server over UDP answering with the records of a
+// zone. It returns its address and a function to stop it.
+func fakeDNS(t *testing.T, z zone) (string, func()) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error starting the DNS server: %v", err)
+	}
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if resp := z.answer(buf[:n]); resp != nil {
+				conn.WriteTo(resp, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String(), func() { conn.Close() }
+}
+
+func encodeName(name string) []byte {
+	var b []byte
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+func (z zone) answer(query []byte) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+	// Question: labels, type and class
+	var labels []string
+	i := 12
+	for i < len(query) && query[i] != 0 {
+		l := int(query[i])
+		if i+1+l > len(query) {
+			return nil
+		}
+		labels = append(labels, string(query[i+1:i+1+l]))
+		i += 1 + l
+	}
+	if i+5 > len(query) {
+		return nil
+	}
+	question := query[12 : i+5]
+	qtype := binary.BigEndian.Uint16(query[i+1:])
+	name := strings.ToLower(strings.Join(labels, "."))
+
+	var answers [][]byte
+	for _, value := range z[name+"/"+map[uint16]string{typeA: "A", typeAAAA: "AAAA", typeMX: "MX", typeTXT: "TXT"}[qtype]] {
+		var rdata []byte
+		switch qtype {
+		case typeA:
+			rdata = net.ParseIP(value).To4()
+		case typeAAAA:
+			rdata = net.ParseIP(value).To16()
+		case typeMX:
+			rdata = append([]byte{0, 10}, encodeName(value)...)
+		case typeTXT:
+			for len(value) > 255 {
+				rdata = append(append(rdata, 255), value[:255]...)
+				value = value[255:]
+			}
+			rdata = append(append(rdata, byte(len(value))), value...)
+		}
+		rr := []byte{0xc0, 12, 0, byte(qtype), 0, 1, 0, 0, 0, 60, byte(len(rdata) >> 8), byte(len(rdata))}
+		answers = append(answers, append(rr, rdata...))
+	}
+	rcode := byte(0)
+	if !z.exists(name) {
+		rcode = 3
+	}
+	resp := []byte{query[0], query[1], 0x81, 0x80 | rcode, 0, 1, 0, byte(len(answers)), 0, 0, 0, 0}
+	resp = append(resp, question...)
+	for _, a := range answers {
+		resp = append(resp, a...)
+	}
+	return resp
+}
+
+func (z zone) exists(name string) bool {
+	for key := range z {
+		if strings.HasPrefix(key, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+var testZone = zone{
+	"example.test/TXT":                      {"v=spf1 ip4:192.0.2.0/24 include:_spf.provider.test a:relay.example.test mx -all", "google-site-verification=abc"},
+	"example.test/MX":                       {"mx.example.test"},
+	"mx.example.test/A":                     {"203.0.113.25"},
+	"relay.example.test/A":                  {"203.0.113.5"},
+	"_spf.provider.test/TXT":                {"v=spf1 ip4:198.51.100.0/24 ip6:2001:db8::/32 ~all"},
+	"soft.test/TXT":                         {"v=spf1 ip4:192.0.2.1 ~all"},
+	"netblocks.test/TXT":                    {"v=spf1 ip6:2001:db8:4000::/36 ip6:2001:db8:ff00::/48 a:relay.example.test/24 -all"},
+	"invalid.test/TXT":                      {"v=spf1 ip4:2001:db8::1 -all"},
+	"redirect.test/TXT":                     {"v=spf1 redirect=_spf.provider.test"},
+	"loop.test/TXT":                         {"v=spf1 include:loop.test -all"},
+	"double.test/TXT":                       {"v=spf1 -all", "v=spf1 +all"},
+	"selector1._domainkey.example.test/TXT": {"v=DKIM1; k=rsa; p=" + strings.Repeat("A", 300)},
+	"old._domainkey.example.test/TXT":       {"v=DKIM1; p="},
+	"_dmarc.example.test/TXT":               {"v=DMARC1; p=reject; sp=quarantine; adkim=s; rua=mailto:dmarc@example.test"},
+}
+
+func TestCheckSPF(t *testing.T) {
+	addr, stop := fakeDNS(t, testZone)
+	defer stop()
+	r := NewResolver(addr)
+	testData := []struct {
+		domain string
+		ip     string
+		result string
+	}{
+		{"example.test", "192.0.2.10", SPFPass},
+		{"example.test", "198.51.100.7", SPFPass},
+		{"example.test", "2001:db8::1", SPFPass},
+		{"example.test", "203.0.113.5", SPFPass},
+		{"example.test", "203.0.113.25", SPFPass},
+		{"example.test", "203.0.113.99", SPFFail},
+		{"soft.test", "203.0.113.99", SPFSoftFail},
+		{"netblocks.test", "2001:db8:4abc::1", SPFPass},
+		{"netblocks.test", "2001:db8:ff00::25", SPFPass},
+		{"netblocks.test", "2001:db8:ff01::25", SPFFail},
+		{"netblocks.test", "203.0.113.99", SPFPass},
+		{"invalid.test", "203.0.113.99", SPFPermError},
+		{"redirect.test", "198.51.100.1", SPFPass},
+		{"redirect.test", "203.0.113.99", SPFSoftFail},
+		{"loop.test", "203.0.113.99", SPFPermError},
+		{"double.test", "203.0.113.99", SPFPermError},
+		{"missing.test", "203.0.113.99", SPFNone},
+	}
+	t.Run("Check SPF evaluation", func(t *testing.T) {
+		for _, tt := range testData {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			result, err := CheckSPF(ctx, r, net.ParseIP(tt.ip), tt.domain)
+			cancel()
+			if result != tt.result {
+				t.Errorf("Incorrect SPF result for %s in %s, expected: %s, got: %s (%v)", tt.ip, tt.domain, tt.result, result, err)
+			}
+		}
+	})
+}
+
+func TestLookupDKIM(t *testing.T) {
+	addr, stop := fakeDNS(t, testZone)
+	defer stop()
+	r := NewResolver(addr)
+	t.Run("Check DKIM keys are found", func(t *testing.T) {
+		keys, err := LookupDKIM(context.Background(), r, "example.test", []string{"default", "selector1", "old"})
+		if err != nil {
+			t.Fatalf("Error looking up DKIM keys: %v", err)
+		}
+		if len(keys) != 2 {
+			t.Fatalf("Incorrect number of keys, expected: 2, got: %d", len(keys))
+		}
+		if keys[0].Selector != "selector1" || keys[0].KeyType != "rsa" || keys[0].Revoked {
+			t.Errorf("Incorrect key, got: %+v", keys[0])
+		}
+		if !keys[1].Revoked {
+			t.Errorf("Key with an empty p= not reported as revoked: %+v", keys[1])
+		}
+	})
+}
+
+func TestLookupDMARC(t *testing.T) {
+	addr, stop := fakeDNS(t, testZone)
+	defer stop()
+	r := NewResolver(addr)
+	t.Run("Check DMARC policy is parsed", func(t *testing.T) {
+		d, err := LookupDMARC(context.Background(), r, "example.test")
+		if err != nil || d == nil {
+			t.Fatalf("Error looking up DMARC policy: %v", err)
+		}
+		if d.Policy != "reject" || d.ADKIM != "s" || d.ASPF != "r" || d.Reports != "mailto:dmarc@example.test" {
+			t.Errorf("Incorrect DMARC policy, got: %+v", d)
+		}
+	})
+	t.Run("Check subdomains fall back to the organizational domain", func(t *testing.T) {
+		d, err := LookupDMARC(context.Background(), r, "news.example.test")
+		if err != nil || d == nil {
+			t.Fatalf("Error looking up DMARC policy: %v", err)
+		}
+		if d.Effective("news.example.test") != "quarantine" {
+			t.Errorf("Incorrect subdomain policy, expected: quarantine, got: %s", d.Effective("news.example.test"))
+		}
+	})
+	t.Run("Check missing DMARC policy", func(t *testing.T) {
+		d, err := LookupDMARC(context.Background(), r, "missing.test")
+		if err != nil || d != nil {
+			t.Errorf("Incorrect DMARC policy, expected: nil, got: %+v (%v)", d, err)
+		}
+	})
+}
+
+func TestAligned(t *testing.T) {
+	testData := []struct {
+		a, b, mode string
+		aligned    bool
+	}{
+		{"mail.example.com", "example.com", "r", true},
+		{"mail.example.com", "example.com", "s", false},
+		{"example.co.uk", "shop.example.co.uk", "r", true},
+		{"other.co.uk", "example.co.uk", "r", false},
+		{"sendgrid.net", "example.com", "r", false},
+	}
+	t.Run("Check domain alignment", func(t *testing.T) {
+		for _, tt := range testData {
+			if got := Aligned(tt.a, tt.b, tt.mode); got != tt.aligned {
+				t.Errorf("Incorrect alignment of %s and %s (%s), expected: %v, got: %v", tt.a, tt.b, tt.mode, tt.aligned, got)
+			}
+		}
+	})
+}
@@ -0,0 +1,268 @@
+package mailauth
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// SPF results, as defined in RFC 7208
+const (
+	SPFNone      = "none"
+	SPFNeutral   = "neutral"
+	SPFPass      = "pass"
+	SPFFail      = "fail"
+	SPFSoftFail  = "softfail"
+	SPFTempError = "temperror"
+	SPFPermError = "permerror"
+)
+
+// maxSPFLookups is the maximum number of terms causing DNS queries in a SPF evaluation
+const maxSPFLookups = 10
+
+var spfQualifiers = map[byte]string{'+': SPFPass, '-': SPFFail, '~': SPFSoftFail, '?': SPFNeutral}
+
+// spfEvaluation contains the state of the evaluation of a SPF policy
+type spfEvaluation struct {
+	r       *net.Resolver
+	ip      net.IP
+	lookups int
+}
+
+// SPFRecord returns the SPF record of the domain, or an empty string if it has none
+func SPFRecord(ctx context.Context, r *net.Resolver, domain string) (string, error) {
+	txts, err := lookupTXT(ctx, r, domain)
+	if err != nil {
+		return "", err
+	}
+	var records []string
+	for _, txt := range txts {
+		if strings.EqualFold(txt, "v=spf1") || strings.HasPrefix(strings.ToLower(txt), "v=spf1 ") {
+			records = append(records, txt)
+		}
+	}
+	if len(records) > 1 {
+		return "", errors.Errorf("%s has %d SPF records", domain, len(records))
+	}
+	if len(records) == 0 {
+		return "", nil
+	}
+	return records[0], nil
+}
+
+// CheckSPF evaluates the SPF policy of domain for a mail sent from ip
+func CheckSPF(ctx context.Context, r *net.Resolver, ip net.IP, domain string) (string, error) {
+	e := &spfEvaluation{r: r, ip: ip}
+	return e.check(ctx, domain)
+}
+
+func (e *spfEvaluation) lookup() error {
+	e.lookups++
+	if e.lookups > maxSPFLookups {
+		return errors.Errorf("more than %d DNS lookups", maxSPFLookups)
+	}
+	return nil
+}
+
+func (e *spfEvaluation) check(ctx context.Context, domain string) (string, error) {
+	record, err := SPFRecord(ctx, e.r, domain)
+	if err != nil {
+		if _, ok := err.(*net.DNSError); ok {
+			return SPFTempError, err
+		}
+		return SPFPermError, err
+	}
+	if record == "" {
+		return SPFNone, nil
+	}
+	redirect := ""
+	for _, term := range strings.Fields(record)[1:] {
+		lower := strings.ToLower(term)
+		if strings.HasPrefix(lower, "redirect=") {
+			redirect = term[len("redirect="):]
+			continue
+		}
+		if strings.Contains(lower, "=") && !strings.ContainsAny(lower[:strings.Index(lower, "=")], ":/") {
+			// exp= and unknown modifiers do not affect the result
+			continue
+		}
+		result := SPFPass
+		if q, ok := spfQualifiers[term[0]]; ok {
+			result = q
+			term = term[1:]
+		}
+		match, err := e.match(ctx, domain, term)
+		if err != nil {
+			if _, ok := err.(*net.DNSError); ok {
+				return SPFTempError, err
+			}
+			return SPFPermError, err
+		}
+		if match {
+			return result, nil
+		}
+	}
+	if redirect != "" {
+		if err := e.lookup(); err != nil {
+			return SPFPermError, err
+		}
+		result, err := e.check(ctx, redirect)
+		if result == SPFNone {
+			return SPFPermError, errors.Errorf("redirect to %s, which has no SPF record", redirect)
+		}
+		return result, err
+	}
+	return SPFNeutral, nil
+}
+
+// match returns whether the mechanism matches the IP
+func (e *spfEvaluation) match(ctx context.Context, domain, mechanism string) (bool, error) {
+	name, value := mechanism, ""
+	if i := strings.IndexAny(mechanism, ":/"); i >= 0 {
+		name, value = mechanism[:i], mechanism[i:]
+	}
+	switch strings.ToLower(name) {
+	case "all":
+		return true, nil
+	case "ip4", "ip6":
+		n, err := parseNetwork(name, value)
+		if err != nil {
+			return false, errors.Errorf("invalid mechanism %q", mechanism)
+		}
+		return n.Contains(e.ip), nil
+	}
+	target, cidr4, cidr6 := domain, 32, 128
+	if strings.HasPrefix(value, ":") {
+		target = value[1:]
+		if i := strings.Index(target, "/"); i >= 0 {
+			target, value = target[:i], target[i:]
+		} else {
+			value = ""
+		}
+	}
+	if strings.Contains(target, "%") {
+		return false, errors.Errorf("macros are not supported: %s", mechanism)
+	}
+	if value != "" {
+		var err error
+		if cidr4, cidr6, err = parseDualCIDR(value); err != nil {
+			return false, errors.Errorf("invalid mechanism %q: %v", mechanism, err)
+		}
+	}
+	switch strings.ToLower(name) {
+	case "a":
+		if err := e.lookup(); err != nil {
+			return false, err
+		}
+		return e.matchHost(ctx, target, cidr4, cidr6)
+	case "mx":
+		if err := e.lookup(); err != nil {
+			return false, err
+		}
+		mxs, err := e.r.LookupMX(ctx, target)
+		if err != nil && !notFound(err) {
+			return false, err
+		}
+		for i, mx := range mxs {
+			if i >= maxSPFLookups {
+				return false, errors.Errorf("%s has more than %d MX records", target, maxSPFLookups)
+			}
+			if ok, err := e.matchHost(ctx, strings.TrimSuffix(mx.Host, "."), cidr4, cidr6); ok || err != nil {
+				return ok, err
+			}
+		}
+		return false, nil
+	case "include":
+		if err := e.lookup(); err != nil {
+			return false, err
+		}
+		result, err := e.check(ctx, target)
+		switch result {
+		case SPFPass:
+			return true, nil
+		case SPFNone:
+			return false, errors.Errorf("include of %s, which has no SPF record", target)
+		case SPFTempError, SPFPermError:
+			return false, err
+		}
+		return false, nil
+	case "exists":
+		if err := e.lookup(); err != nil {
+			return false, err
+		}
+		addrs, err := e.r.LookupIPAddr(ctx, target)
+		if err != nil && !notFound(err) {
+			return false, err
+		}
+		return len(addrs) > 0, nil
+	case "ptr":
+		// ptr is deprecated and never matches here
+		return false, e.lookup()
+	}
+	return false, errors.Errorf("unknown mechanism %q", mechanism)
+}
+
+func (e *spfEvaluation) matchHost(ctx context.Context, host string, cidr4, cidr6 int) (bool, error) {
+	addrs, err := e.r.LookupIPAddr(ctx, host)
+	if err != nil && !notFound(err) {
+		return false, err
+	}
+	for _, addr := range addrs {
+		bits, ones := 128, cidr6
+		if addr.IP.To4() != nil {
+			bits, ones = 32, cidr4
+		}
+		n := net.IPNet{IP: addr.IP, Mask: net.CIDRMask(ones, bits)}
+		if n.Contains(e.ip) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// parseNetwork parses the ":192.0.2.0/24" or ":2001:db8::/32" value of the ip4
+// and ip6 mechanisms, whose prefix length is optional
+func parseNetwork(name, value string) (*net.IPNet, error) {
+	if !strings.HasPrefix(value, ":") {
+		return nil, errors.New("missing network")
+	}
+	network, bits := value[1:], 32
+	if strings.EqualFold(name, "ip6") {
+		bits = 128
+	}
+	if !strings.Contains(network, "/") {
+		network += "/" + strconv.Itoa(bits)
+	}
+	ip, n, err := net.ParseCIDR(network)
+	if err != nil {
+		return nil, err
+	}
+	if (ip.To4() != nil) != (bits == 32) {
+		return nil, errors.Errorf("%s is not an %s network", network, name)
+	}
+	return n, nil
+}
+
+// parseDualCIDR parses the "/24//64" suffix of the a and mx mechanisms
+func parseDualCIDR(s string) (int, int, error) {
+	cidr4, cidr6 := 32, 128
+	parts := strings.SplitN(s, "//", 2)
+	if parts[0] != "" {
+		n, err := strconv.Atoi(strings.TrimPrefix(parts[0], "/"))
+		if err != nil || n < 0 || n > 32 {
+			return 0, 0, errors.Errorf("invalid prefix length %q", parts[0])
+		}
+		cidr4 = n
+	}
+	if len(parts) == 2 {
+		n, err := strconv.Atoi(parts[1])
+		if err != nil || n < 0 || n > 128 {
+			return 0, 0, errors.Errorf("invalid prefix length %q", parts[1])
+		}
+		cidr6 = n
+	}
+	return cidr4, cidr6, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/mailauth"
+	"github.com/juju/errors"
+	"github.com/mmikulicic/multierror"
+)
+
+// RunMailAuthChecks checks the SPF, DKIM and DMARC records of the sender domain,
+// querying the DNS server in resolverAddr (the system one when empty)
+func RunMailAuthChecks(ctx context.Context, settings *apps.SMTPSettings, resolverAddr string, selectors []string) error {
+	sender := settings.Sender()
+	if !strings.Contains(sender, "@") {
+		return errors.Errorf("the sender %q is not a mail address", sender)
+	}
+	domain := mailauth.Domain(sender)
+	r := mailauth.NewResolver(resolverAddr)
+	fmt.Printf("Sender domain: %s\n", domain)
+
+	var errs error
+	addrs, err := r.LookupIPAddr(ctx, settings.Host)
+	if err != nil {
+		return errors.Annotatef(err, "resolving %s", settings.Host)
+	}
+	spfPass := false
+	record, err := mailauth.SPFRecord(ctx, r, domain)
+	switch {
+	case err != nil:
+		errs = multierror.Append(errs, errors.Annotate(err, "looking up the SPF record"))
+	case record == "":
+		fmt.Printf("Warning: %s has no SPF record, receivers cannot verify the relay is allowed to send its mails\n", domain)
+	default:
+		fmt.Printf("SPF record: %s\n", record)
+		for _, addr := range addrs {
+			result, err := mailauth.CheckSPF(ctx, r, addr.IP, domain)
+			fmt.Printf("  - SPF result for %s (%s): %s\n", settings.Host, addr.IP, result)
+			switch result {
+			case mailauth.SPFPass:
+				spfPass = true
+			case mailauth.SPFNeutral:
+				fmt.Printf("Warning: the SPF record of %s neither allows nor denies %s\n", domain, addr.IP)
+			case mailauth.SPFFail, mailauth.SPFSoftFail:
+				errs = multierror.Append(errs, errors.Errorf("the SPF record of %s does not allow %s (%s), add it to the record (e.g. with an include: of the provider)", domain, settings.Host, addr.IP))
+			default:
+				errs = multierror.Append(errs, errors.Errorf("evaluating the SPF record of %s: %s: %v", domain, result, err))
+			}
+		}
+	}
+
+	keys, err := mailauth.LookupDKIM(ctx, r, domain, selectors)
+	if err != nil {
+		errs = multierror.Append(errs, errors.Annotate(err, "looking up the DKIM keys"))
+	}
+	dkim := false
+	for _, key := range keys {
+		if key.Revoked {
+			fmt.Printf("  - DKIM selector %q: revoked key\n", key.Selector)
+			continue
+		}
+		fmt.Printf("  - DKIM selector %q: %s key\n", key.Selector, key.KeyType)
+		dkim = true
+	}
+	if !dkim {
+		fmt.Printf("Warning: no DKIM key found for %s with the selectors %s, the mails may be signed with the domain of the relay instead\n", domain, strings.Join(selectors, ", "))
+	}
+
+	dmarc, err := mailauth.LookupDMARC(ctx, r, domain)
+	switch {
+	case err != nil:
+		errs = multierror.Append(errs, errors.Annotate(err, "looking up the DMARC policy"))
+	case dmarc == nil:
+		fmt.Printf("Warning: %s has no DMARC policy, many receivers (e.g. Gmail, Yahoo) require one for bulk senders\n", domain)
+	default:
+		policy := dmarc.Effective(domain)
+		fmt.Printf("DMARC policy (_dmarc.%s): %s\n", dmarc.Domain, dmarc.Record)
+		if user := settings.User; strings.Contains(user, "@") && !mailauth.Aligned(mailauth.Domain(user), domain, dmarc.ASPF) {
+			fmt.Printf("Warning: the SMTP user belongs to %s, if the relay uses it as envelope sender SPF is not aligned with %s\n", mailauth.Domain(user), domain)
+		}
+		if policy != "none" && !spfPass && !dkim {
+			errs = multierror.Append(errs, errors.Errorf("the DMARC policy of %s is %q but neither SPF nor DKIM authenticate the mails sent via %s, so they will be rejected or flagged as spam", domain, policy, settings.Host))
+		}
+	}
+	if errs != nil {
+		return errs
+	}
+	fmt.Println("Mail authentication records checked!")
+	return nil
+}
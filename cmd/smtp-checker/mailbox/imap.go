@@ -0,0 +1,188 @@
+package mailbox
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bitnami-labs/healthcheck-tools/pkg/timeout"
+	"github.com/juju/errors"
+)
+
+// literalRe matches the size of a literal at the end of a response line
+var literalRe = regexp.MustCompile(`\{(\d+)\}$`)
+
+// imapConn is a minimal IMAP client
+type imapConn struct {
+	tp  *textproto.Conn
+	tag int
+}
+
+// readLine reads a response line, replacing the literals it contains by quoted strings
+func (c *imapConn) readLine() (string, error) {
+	line, err := c.tp.ReadLine()
+	for err == nil {
+		m := literalRe.FindStringSubmatchIndex(line)
+		if m == nil {
+			break
+		}
+		size, _ := strconv.Atoi(line[m[2]:m[3]])
+		literal := make([]byte, size)
+		if _, err = io.ReadFull(c.tp.R, literal); err != nil {
+			break
+		}
+		var rest string
+		rest, err = c.tp.ReadLine()
+		line = line[:m[0]] + imapQuote(string(literal)) + rest
+	}
+	return line, err
+}
+
+// command sends a command and returns its untagged responses
+func (c *imapConn) command(format string, args ...interface{}) ([]string, error) {
+	c.tag++
+	tag := fmt.Sprintf("a%d", c.tag)
+	if err := c.tp.PrintfLine("%s %s", tag, fmt.Sprintf(format, args...)); err != nil {
+		return nil, err
+	}
+	var untagged []string
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, tag+" ") {
+			untagged = append(untagged, line)
+			continue
+		}
+		status := strings.TrimPrefix(line, tag+" ")
+		if !strings.HasPrefix(strings.ToUpper(status), "OK") {
+			return untagged, errors.New(status)
+		}
+		return untagged, nil
+	}
+}
+
+// imapQuote returns s as an IMAP quoted string
+func imapQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// imapTokens splits a response in atoms, quoted strings and parenthesized lists
+func imapTokens(s string) []string {
+	var tokens []string
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		end := 0
+		switch s[0] {
+		case '"':
+			var b strings.Builder
+			for end = 1; end < len(s) && s[end] != '"'; end++ {
+				if s[end] == '\\' && end+1 < len(s) {
+					end++
+				}
+				b.WriteByte(s[end])
+			}
+			tokens = append(tokens, b.String())
+			end++
+		case '(':
+			end = strings.IndexByte(s, ')') + 1
+			if end == 0 {
+				end = len(s)
+			}
+			tokens = append(tokens, s[:end])
+		default:
+			end = strings.IndexAny(s, " (")
+			if end < 0 {
+				end = len(s)
+			}
+			tokens = append(tokens, s[:end])
+		}
+		if end > len(s) {
+			end = len(s)
+		}
+		s = s[end:]
+	}
+	return tokens
+}
+
+// parseList returns the attributes and the name of the folder in a LIST response
+func parseList(line string) (string, string, bool) {
+	tokens := imapTokens(strings.TrimPrefix(line, "* LIST "))
+	if !strings.HasPrefix(line, "* LIST ") || len(tokens) != 3 {
+		return "", "", false
+	}
+	return tokens[0], tokens[2], true
+}
+
+// findIMAP searches the message in the inbox and the spam folders
+func (m *Mailbox) findIMAP(ctx context.Context, conn net.Conn, token string) (string, bool, error) {
+	c := &imapConn{tp: textproto.NewConn(conn)}
+	greeting, err := c.readLine()
+	if err != nil {
+		return "", false, timeout.Wrap(ctx, "waiting for the IMAP greeting", err)
+	}
+	if !strings.HasPrefix(greeting, "* OK") && !strings.HasPrefix(greeting, "* PREAUTH") {
+		return "", false, errors.Errorf("unexpected IMAP greeting: %s", greeting)
+	}
+	encrypted := m.TLS
+	if !m.TLS {
+		caps, err := c.command("CAPABILITY")
+		if err != nil {
+			return "", false, timeout.Wrap(ctx, "sending CAPABILITY", err)
+		}
+		if strings.Contains(strings.ToUpper(strings.Join(caps, " ")), "STARTTLS") {
+			if _, err := c.command("STARTTLS"); err != nil {
+				return "", false, timeout.Wrap(ctx, "sending STARTTLS", err)
+			}
+			tlsConn, tp, err := m.upgrade(conn)
+			if err != nil {
+				return "", false, timeout.Wrap(ctx, "negotiating STARTTLS", err)
+			}
+			defer tlsConn.Close()
+			c.tp = tp
+			encrypted = true
+		}
+	}
+	if !strings.HasPrefix(greeting, "* PREAUTH") {
+		if err := m.checkEncrypted(encrypted, "STARTTLS"); err != nil {
+			c.command("LOGOUT")
+			return "", false, err
+		}
+		if _, err := c.command("LOGIN %s %s", imapQuote(m.User), imapQuote(m.Pass)); err != nil {
+			return "", false, timeout.Wrap(ctx, "logging in", errors.Annotate(err, "IMAP login failed"))
+		}
+	}
+	list, err := c.command(`LIST "" "*"`)
+	if err != nil {
+		return "", false, timeout.Wrap(ctx, "listing the folders", err)
+	}
+	folders := []string{"INBOX"}
+	for _, line := range list {
+		attrs, name, ok := parseList(line)
+		if ok && (strings.Contains(attrs, `\Junk`) || IsSpamFolder(name)) {
+			folders = append(folders, name)
+		}
+	}
+	for i, folder := range folders {
+		if _, err := c.command("EXAMINE %s", imapQuote(folder)); err != nil {
+			continue
+		}
+		res, err := c.command("SEARCH SUBJECT %s", imapQuote(token))
+		if err != nil {
+			return "", false, timeout.Wrap(ctx, fmt.Sprintf("searching %s", folder), err)
+		}
+		for _, line := range res {
+			if strings.HasPrefix(line, "* SEARCH ") && strings.TrimSpace(strings.TrimPrefix(line, "* SEARCH ")) != "" {
+				c.command("LOGOUT")
+				return folder, i > 0, nil
+			}
+		}
+	}
+	c.command("LOGOUT")
+	return "", false, nil
+}
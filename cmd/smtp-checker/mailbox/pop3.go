@@ -0,0 +1,101 @@
+package mailbox
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/bitnami-labs/healthcheck-tools/pkg/timeout"
+	"github.com/juju/errors"
+)
+
+// maxPOP3Messages is the number of recent messages inspected in POP3 mailboxes
+const maxPOP3Messages = 50
+
+// pop3Command sends a command and checks the server replies +OK
+func pop3Command(tp *textproto.Conn, format string, args ...interface{}) (string, error) {
+	if err := tp.PrintfLine(format, args...); err != nil {
+		return "", err
+	}
+	line, err := tp.ReadLine()
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(line, "+OK") {
+		return "", errors.New(line)
+	}
+	return strings.TrimSpace(strings.TrimPrefix(line, "+OK")), nil
+}
+
+// findPOP3 searches the message among the most recent ones. POP3 only gives
+// access to the inbox, so spam folders cannot be inspected.
+func (m *Mailbox) findPOP3(ctx context.Context, conn net.Conn, token string) (string, bool, error) {
+	tp := textproto.NewConn(conn)
+	greeting, err := tp.ReadLine()
+	if err != nil {
+		return "", false, timeout.Wrap(ctx, "waiting for the POP3 greeting", err)
+	}
+	if !strings.HasPrefix(greeting, "+OK") {
+		return "", false, errors.Errorf("unexpected POP3 greeting: %s", greeting)
+	}
+	encrypted := m.TLS
+	if !m.TLS {
+		if _, err := pop3Command(tp, "CAPA"); err == nil {
+			caps, err := tp.ReadDotLines()
+			if err != nil {
+				return "", false, timeout.Wrap(ctx, "sending CAPA", err)
+			}
+			for _, c := range caps {
+				if strings.ToUpper(strings.TrimSpace(c)) != "STLS" {
+					continue
+				}
+				if _, err := pop3Command(tp, "STLS"); err != nil {
+					return "", false, timeout.Wrap(ctx, "sending STLS", err)
+				}
+				tlsConn, tlsTP, err := m.upgrade(conn)
+				if err != nil {
+					return "", false, timeout.Wrap(ctx, "negotiating STLS", err)
+				}
+				defer tlsConn.Close()
+				tp = tlsTP
+				encrypted = true
+				break
+			}
+		}
+	}
+	if err := m.checkEncrypted(encrypted, "STLS"); err != nil {
+		pop3Command(tp, "QUIT")
+		return "", false, err
+	}
+	if _, err := pop3Command(tp, "USER %s", m.User); err != nil {
+		return "", false, timeout.Wrap(ctx, "logging in", errors.Annotate(err, "POP3 login failed"))
+	}
+	if _, err := pop3Command(tp, "PASS %s", m.Pass); err != nil {
+		return "", false, timeout.Wrap(ctx, "logging in", errors.Annotate(err, "POP3 login failed"))
+	}
+	stat, err := pop3Command(tp, "STAT")
+	if err != nil {
+		return "", false, timeout.Wrap(ctx, "sending STAT", err)
+	}
+	count, _ := strconv.Atoi(strings.SplitN(stat+" ", " ", 2)[0])
+	for i := count; i > 0 && i > count-maxPOP3Messages; i-- {
+		if _, err := pop3Command(tp, "TOP %d 0", i); err != nil {
+			return "", false, timeout.Wrap(ctx, fmt.Sprintf("retrieving message %d", i), err)
+		}
+		headers, err := tp.ReadDotLines()
+		if err != nil {
+			return "", false, timeout.Wrap(ctx, fmt.Sprintf("retrieving message %d", i), err)
+		}
+		for _, h := range headers {
+			if strings.HasPrefix(strings.ToLower(h), "subject:") && strings.Contains(h, token) {
+				pop3Command(tp, "QUIT")
+				return "INBOX", false, nil
+			}
+		}
+	}
+	pop3Command(tp, "QUIT")
+	return "", false, nil
+}
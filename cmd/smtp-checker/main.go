@@ -1,12 +1,28 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net/mail"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps/container"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/mailauth"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/mailbox"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/message"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/providers"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/timesync"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/bundle"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/discovery"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/profile"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/redact"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/timeout"
 	"github.com/mmikulicic/multierror"
 )
 
@@ -17,20 +33,181 @@ var (
 	VERSION = "devel"
 )
 
+// checks contains the name of the checks that can be selected in a profile
+var checks = []string{"connectivity", "ports", "tls", "starttls", "ntp", "sendmail", "roundtrip", "mailauth"}
+
+// defaultRoundTripTimeout is the minimum time to wait for the mail in the round trip check
+const defaultRoundTripTimeout = 2 * time.Minute
+
+// explicitFlags returns the name of the flags provided in the command line
+func explicitFlags(fs *flag.FlagSet) map[string]bool {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
+// smtpFlagsSet returns whether any of the SMTP server settings was provided in the
+// command line. Options such as the encryption or the authentication mechanism
+// override the application settings instead.
+func smtpFlagsSet(fs *flag.FlagSet) bool {
+	set := explicitFlags(fs)
+	return set["smtp_host"] || set["smtp_port"] || set["smtp_user"] || set["smtp_password"]
+}
+
+// overrideSMTPSettings replaces the SMTP settings with the ones provided in the profile
+// and in the command line, in that order
+func overrideSMTPSettings(smtp *apps.SMTPSettings, target profile.SMTPTarget, flags *apps.SMTPSettings, set map[string]bool) {
+	if target.Host != "" {
+		smtp.Host = target.Host
+	}
+	if target.Port != 0 {
+		smtp.Port = target.Port
+	}
+	if target.User != "" {
+		smtp.User = target.User
+	}
+	if target.Password != "" {
+		smtp.Pass = target.Password
+	}
+	if target.Encryption != "" {
+		smtp.Encryption = target.Encryption
+	}
+	if target.Auth != "" {
+		smtp.Auth = target.Auth
+	}
+	if target.From != "" {
+		smtp.From = target.From
+	}
+	if target.FromName != "" {
+		smtp.FromName = target.FromName
+	}
+	if set["smtp_host"] {
+		smtp.Host = flags.Host
+	}
+	if set["smtp_port"] {
+		smtp.Port = flags.Port
+	}
+	if set["smtp_user"] {
+		smtp.User = flags.User
+	}
+	if set["smtp_password"] {
+		smtp.Pass = flags.Pass
+	}
+	if set["smtp_encryption"] {
+		smtp.Encryption = flags.Encryption
+	}
+	if set["smtp_auth"] {
+		smtp.Auth = flags.Auth
+	}
+	if set["mail_from"] {
+		smtp.From = flags.From
+	}
+	if set["mail_from_name"] {
+		smtp.FromName = flags.FromName
+	}
+}
+
+// printCredentialSources reports where the SMTP user and password were read from,
+// never their values
+func printCredentialSources(credentials []apps.Credential, smtp *apps.SMTPSettings, target profile.SMTPTarget, app string) {
+	fmt.Println("SMTP credentials:")
+	for _, c := range []struct {
+		name, value, profile string
+	}{{"user", smtp.User, target.User}, {"password", smtp.Pass, target.Password}} {
+		source, found := apps.Credential{Name: c.name, Source: "not set"}, false
+		for _, f := range credentials {
+			if f.Name == c.name {
+				source, found = f, true
+			}
+		}
+		switch {
+		case found || c.value == "":
+		case c.profile != "":
+			source.Source = "check profile"
+		case app != "":
+			source.Source, source.Location = "application configuration", app
+		}
+		fmt.Printf("  - %s\n", source)
+	}
+}
+
+// writeBundle writes the support bundle, reporting where it was stored
+func writeBundle(output, installDir, app string, env map[string]string, smtp *apps.SMTPSettings, recipients []string, results []bundle.Result) {
+	if err := WriteBundle(output, installDir, app, env, smtp, recipients, results); err != nil {
+		log.Printf("Found errors when writing the support bundle: %v", err)
+		return
+	}
+	fmt.Printf("Support bundle written to %q. Attach it to your support ticket.\n", output)
+}
+
 func main() {
 	var (
-		installDir   string
-		app          string
-		recipient    string
-		getVersion   bool
-		secureOutput bool
+		installDir     string
+		app            string
+		recipient      string
+		configFile     string
+		maxClockOffset time.Duration
+		maxNTPRTT      time.Duration
+		ntpServers     string
+		ntpLocal       bool
+		globalTimeout  time.Duration
+		bundleOutput   string
+		getVersion     bool
+		secureOutput   bool
+		showSecrets    bool
+		tokenFile      string
+		mailboxURL     string
+		mailboxPass    string
+		dnsResolver    string
+		dkimSelectors  string
+		traceSMTP      bool
+		mailHTML       string
+		mailAttachment string
+		mailHeaders    message.Headers
+		containerEnv   bool
+		containerFile  string
+		descriptorsDir string
 	)
-	flag.StringVar(&installDir, "install_dir", "/opt/bitnami", "Installation Directory")
-	flag.StringVar(&app, "application", "", "Application")
+	// serve mode runs a local SMTP server instead of the checks
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		runServe(os.Args[2:])
+		return
+	}
+	// bundle mode runs the checks and writes a support bundle with the results
+	bundleMode := len(os.Args) > 1 && os.Args[1] == "bundle"
+	if bundleMode {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+	flag.StringVar(&installDir, "install_dir", discovery.DefaultInstallDir, "Installation Directory")
+	flag.StringVar(&app, "application", "", "Application (auto-detected from the installation directory by default)")
 	flag.StringVar(&recipient, "mail_recipient", defaultRecipient, fmt.Sprintf("Mail Recipient (%s by default)", defaultRecipient))
+	flag.StringVar(&configFile, "config", "", "YAML check profile")
+	flag.DurationVar(&maxClockOffset, "max_clock_offset", defaultMaxClockOffset, "Maximum time offset allowed respect the NTP servers")
+	flag.DurationVar(&maxNTPRTT, "max_ntp_rtt", defaultMaxNTPRTT, "Maximum round trip time of the NTP replies taken into account (0 for no limit)")
+	flag.StringVar(&ntpServers, "ntp_servers", strings.Join(timesync.DefaultServers, ","), "Comma-separated NTP servers (host or host:port) queried in parallel by the time offset check")
+	flag.BoolVar(&ntpLocal, "ntp_local", false, "Inspect only the local time synchronization daemons (chronyd, ntpd or systemd-timesyncd), without querying NTP servers")
+	flag.DurationVar(&globalTimeout, "timeout", defaultTimeout, "Maximum duration of each check")
+	checkTimeouts := timeout.Overrides{}
+	flag.Var(checkTimeouts, "check_timeout", "Maximum duration of specific checks, overriding -timeout (e.g. sendmail=30s,ntp=5s)")
+	flag.StringVar(&bundleOutput, "bundle_output", defaultBundleOutput, "Support bundle file (bundle mode only)")
 	flag.BoolVar(&getVersion, "version", false, "Show current version")
-	flag.BoolVar(&secureOutput, "secure_output", false, "Hide SMTP password in output")
-	smtp := apps.NewSMTPSettingsFromFlags(flag.CommandLine)
+	flag.BoolVar(&secureOutput, "secure_output", false, "Deprecated, secrets are hidden in the output by default")
+	flag.BoolVar(&showSecrets, "show_secrets", false, "Show passwords and other secrets in clear in the output")
+	flag.StringVar(&tokenFile, "smtp_oauth2_token_file", "", "File containing the OAuth2 access token used with the xoauth2 authentication mechanism")
+	flag.StringVar(&mailboxURL, "mailbox", "", "IMAP or POP3 mailbox of the recipient for the round trip check (e.g. imaps://user@imap.example.com)")
+	flag.StringVar(&mailboxPass, "mailbox_password", "", "Password of the mailbox")
+	flag.StringVar(&dnsResolver, "dns_resolver", "", "DNS server (host:port) used by the mail authentication check (the system resolver by default)")
+	flag.StringVar(&dkimSelectors, "dkim_selectors", strings.Join(mailauth.DefaultDKIMSelectors, ","), "Comma-separated DKIM selectors looked up for the sender domain")
+	flag.BoolVar(&traceSMTP, "trace", false, "Record the SMTP dialogue when sending mails, printed when sending fails and included in the support bundle")
+	flag.StringVar(&mailHTML, "mail_html", "", "HTML file sent as alternative body of the testing mail")
+	flag.StringVar(&mailAttachment, "mail_attachment", "", "File attached to the testing mail")
+	flag.Var(&mailHeaders, "mail_header", "Custom header of the testing mail, with the format 'Name: value' (can be repeated)")
+	flag.BoolVar(&containerEnv, "container_env", false, "Read the SMTP settings of the application from the environment variables of its Bitnami container (e.g. WORDPRESS_SMTP_HOST)")
+	flag.StringVar(&containerFile, "container_env_file", "", "Env file with the environment variables of the Bitnami container of the application")
+	flag.StringVar(&descriptorsDir, "descriptors_dir", "", "Directory with YAML descriptors of additional applications, or replacing the supported ones")
+	flagSMTP := apps.NewSMTPSettingsFromFlags(flag.CommandLine)
 	flag.Parse()
 
 	if getVersion {
@@ -38,39 +215,266 @@ func main() {
 		os.Exit(0)
 	}
 
+	redact.ShowSecrets(showSecrets && !secureOutput)
+	log.SetOutput(redact.NewWriter(os.Stderr))
+	set := explicitFlags(flag.CommandLine)
+	credentials, err := flagSMTP.LoadCredentials(set)
+	if err != nil {
+		log.Fatalf("Found errors when reading the SMTP credentials: %v", err)
+	}
+	redact.Register(flagSMTP.Pass, mailboxPass)
+
+	p := &profile.Profile{}
+	if configFile != "" {
+		p, err = profile.Load(configFile)
+		if err != nil {
+			log.Fatalf("Found errors when loading the check profile: %v", err)
+		}
+		target := p.Targets.SMTP
+		redact.Register(target.Password, target.MailboxPassword)
+		if !set["install_dir"] && target.InstallDir != "" {
+			installDir = target.InstallDir
+		}
+		if !set["application"] && target.Application != "" {
+			app = target.Application
+		}
+		if !set["descriptors_dir"] && target.DescriptorsDir != "" {
+			descriptorsDir = target.DescriptorsDir
+		}
+		if !set["container_env"] && target.ContainerEnv {
+			containerEnv = true
+		}
+		if !set["container_env_file"] && target.ContainerEnvFile != "" {
+			containerFile = target.ContainerEnvFile
+		}
+		if !set["mailbox"] && target.Mailbox != "" {
+			mailboxURL = target.Mailbox
+		}
+		if !set["mailbox_password"] && target.MailboxPassword != "" {
+			mailboxPass = target.MailboxPassword
+		}
+		if !set["dns_resolver"] && target.DNSResolver != "" {
+			dnsResolver = target.DNSResolver
+		}
+		if !set["dkim_selectors"] && len(target.DKIMSelectors) > 0 {
+			dkimSelectors = strings.Join(target.DKIMSelectors, ",")
+		}
+		if !set["ntp_servers"] && len(target.NTPServers) > 0 {
+			ntpServers = strings.Join(target.NTPServers, ",")
+		}
+		if !set["ntp_local"] && target.NTPLocal {
+			ntpLocal = true
+		}
+		if !set["max_clock_offset"] && p.Thresholds.MaxClockOffset != 0 {
+			maxClockOffset = time.Duration(p.Thresholds.MaxClockOffset)
+		}
+		if !set["max_ntp_rtt"] && p.Thresholds.MaxNTPRTT != 0 {
+			maxNTPRTT = time.Duration(p.Thresholds.MaxNTPRTT)
+		}
+		if !set["timeout"] && p.Thresholds.Timeout != 0 {
+			globalTimeout = time.Duration(p.Thresholds.Timeout)
+		}
+		for name, d := range p.Checks.SMTP.Timeouts {
+			if _, ok := checkTimeouts[name]; !ok {
+				checkTimeouts[name] = time.Duration(d)
+			}
+		}
+	}
+	enabled, err := p.Checks.SMTP.Enabled("checks.smtp", checks)
+	if err != nil {
+		log.Fatalf("Found errors when selecting the checks: %v", err)
+	}
+	if err := checkTimeouts.Validate(checks); err != nil {
+		log.Fatalf("Found errors when setting the check timeouts: %v", err)
+	}
+	if _, ok := checkTimeouts["roundtrip"]; !ok && globalTimeout < defaultRoundTripTimeout {
+		checkTimeouts["roundtrip"] = defaultRoundTripTimeout
+	}
+
+	ctx, cancel := timeout.WithInterrupt(context.Background())
+	defer cancel()
+	var results []bundle.Result
+	// runCheck runs a check with its own deadline
+	runCheck := func(name string, check func(context.Context) error) error {
+		checkCtx, cancel := timeout.WithTimeout(ctx, checkTimeouts.For(name, globalTimeout))
+		defer cancel()
+		start := time.Now()
+		err := check(checkCtx)
+		results = append(results, bundle.NewResult(name, start, err))
+		return err
+	}
+	// runTracedCheck runs a check recording the SMTP dialogue when -trace is set.
+	// The transcript is printed if the check fails.
+	runTracedCheck := func(name string, check func(context.Context, *transcript) error) error {
+		var tr *transcript
+		if traceSMTP {
+			tr = newTranscript()
+		}
+		err := runCheck(name, func(ctx context.Context) error {
+			return check(ctx, tr)
+		})
+		if tr != nil {
+			results[len(results)-1].Transcript = tr.Lines()
+			if err != nil {
+				tr.Print(os.Stdout)
+			}
+		}
+		return err
+	}
+
+	recipients := []string{recipient}
+	if !set["mail_recipient"] && len(p.Targets.SMTP.Recipients) > 0 {
+		recipients = p.Targets.SMTP.Recipients
+	}
+
+	var mb *mailbox.Mailbox
+	if mailboxURL != "" {
+		mb, err = mailbox.Parse(mailboxURL)
+		if err != nil {
+			log.Fatalf("Found errors when parsing the mailbox: %v", err)
+		}
+		redact.Register(mb.Pass)
+		if mailboxPass != "" {
+			mb.Pass = mailboxPass
+		}
+		if mb.User == "" {
+			mb.User = recipients[0]
+		}
+	}
+
+	if err := LoadDescriptors(descriptorsDir); err != nil {
+		log.Fatalf("Found errors when loading the application descriptors: %v", err)
+	}
+
+	// env contains the environment variables of the application container, if used
+	var env map[string]string
+	configSource := fmt.Sprintf("Installation Directory: %q", installDir)
+	switch {
+	case containerFile != "":
+		env, err = apps.ReadEnvFile(containerFile)
+		if err != nil {
+			log.Fatalf("Found errors when reading the container environment: %v", err)
+		}
+		configSource = fmt.Sprintf("Container env file: %q", containerFile)
+	case containerEnv:
+		env = container.Environ(os.Environ())
+		configSource = "Container environment variables"
+	}
+
+	if app == "" && !smtpFlagsSet(flag.CommandLine) && p.Targets.SMTP.Host == "" {
+		var detected string
+		if env != nil {
+			detected, err = container.Detect(env)
+		} else {
+			detected, err = DetectApplication(installDir)
+		}
+		if err != nil {
+			log.Fatalf("Unable to detect the application: %v\nIndicate your application using '-application' flag or set the smtp credentials using 'smtp-host', 'smtp-port', '-smtp-user' and '-smtp-password' flags", err)
+		}
+		if env != nil {
+			fmt.Printf("Detected application %q in the container environment\n\n", detected)
+		} else {
+			fmt.Printf("Detected application %q in %q\n\n", detected, installDir)
+		}
+		app = detected
+	}
+
+	smtp := flagSMTP
+	// fatalf stops the execution, writing first the support bundle in bundle mode
+	fatalf := func(format string, v ...interface{}) {
+		if bundleMode {
+			results = append(results, bundle.Result{Check: "configuration", Status: bundle.Failed, Error: fmt.Sprintf(format, v...)})
+			writeBundle(bundleOutput, installDir, app, env, smtp, recipients, results)
+		}
+		log.Fatalf(format, v...)
+	}
 	if app != "" {
 		fmt.Printf(`======================================
 SMTP CONFIGURATION
 ======================================
 Obtaining SMTP configuration for app: %q
-  - Installation Directory: %q
+  - %s
 
-`, app, installDir)
+`, app, configSource)
 
-		appConfig, err := ObtainConfigData(installDir, app)
+		var appConfig apps.ApplicationConfig
+		if env != nil {
+			appConfig, err = ObtainContainerConfigData(app, env)
+		} else {
+			configCtx, cancelConfig := timeout.WithTimeout(ctx, globalTimeout)
+			appConfig, err = ObtainConfigData(configCtx, installDir, app)
+			cancelConfig()
+		}
 		if err != nil {
-			log.Fatalf("Found errors when obtaining the SMTP configuration: %q", err)
+			fatalf("Found errors when obtaining the SMTP configuration: %v", err)
 		}
 		err = appConfig.ValidateSMTPSettings()
 		if err != nil {
-			log.Fatalf("Found errors when validating the SMTP settings: %q", err)
+			fatalf("Found errors when validating the SMTP settings: %v", err)
 		}
 		smtp = appConfig.GetSMTPSettings()
 		fmt.Println("SMTP configuration successfully retrieved!!")
 	}
+	overrideSMTPSettings(smtp, p.Targets.SMTP, flagSMTP, set)
+	printCredentialSources(credentials, smtp, p.Targets.SMTP, app)
 
-	if smtp.Host == "" || smtp.Port == 0 || smtp.User == "" || smtp.Pass == "" {
-		log.Fatalf("Indicate your application using '-application' flag or set the smtp credentials using 'smtp-host', 'smtp-port', '-smtp-user' and '-smtp-password' flags")
+	if tokenFile != "" {
+		token, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			fatalf("Found errors when reading the OAuth2 token: %q", err)
+		}
+		smtp.OAuth2Token = strings.TrimSpace(string(token))
+		redact.Register(smtp.OAuth2Token)
 	}
 
-	recipientText := recipient
-	if recipient == defaultRecipient {
-		recipientText = fmt.Sprintf("%s (invalid mail account, use -mail_recipient lag to indicate a valid one)", defaultRecipient)
+	tmpl := &message.Message{Headers: mailHeaders}
+	if mailHTML != "" {
+		html, err := ioutil.ReadFile(mailHTML)
+		if err != nil {
+			fatalf("Found errors when reading the HTML body: %q", err)
+		}
+		tmpl.HTML = string(html)
+	}
+	if mailAttachment != "" {
+		attachment, err := message.NewAttachment(mailAttachment)
+		if err != nil {
+			fatalf("Found errors when reading the attachment: %q", err)
+		}
+		tmpl.Attachments = append(tmpl.Attachments, attachment)
+	}
+
+	if smtp.Host == "" || smtp.Port == 0 || smtp.User == "" && smtp.RequiresUser() || smtp.Pass == "" && smtp.RequiresPassword() {
+		fatalf("Indicate your application using '-application' flag or set the smtp credentials using 'smtp-host', 'smtp-port', '-smtp-user' and '-smtp-password' flags")
+	}
+	if err := smtp.ValidateEncryption(); err != nil {
+		fatalf("Found errors when validating the SMTP settings: %v", err)
+	}
+	if err := smtp.ValidateAuth(); err != nil {
+		fatalf("Found errors when validating the SMTP settings: %v", err)
+	}
+	if err := smtp.ValidateSender(); err != nil {
+		fatalf("Found errors when validating the SMTP settings: %v", err)
+	}
+	if app == "" {
+		// The settings of the applications are validated by ValidateSMTPSettings
+		if err := smtp.ValidateProvider(); err != nil {
+			fatalf("Found errors when validating the SMTP settings: %v", err)
+		}
+	}
+	senderText := (&mail.Address{Name: smtp.FromName, Address: smtp.Sender()}).String()
+	encryptionText := smtp.Encryption
+	if encryptionText == apps.EncryptionAuto {
+		encryptionText = "auto"
+	}
+	authText := smtp.Auth
+	if authText == apps.AuthNegotiate {
+		authText = "negotiated"
 	}
 
-	passwordOutput := "xxxxxx"
-	if !secureOutput {
-		passwordOutput = smtp.Pass
+	defaultRecipientOnly := len(recipients) == 1 && recipients[0] == defaultRecipient
+	recipientText := strings.Join(recipients, ", ")
+	if defaultRecipientOnly {
+		recipientText = fmt.Sprintf("%s (invalid mail account, use -mail_recipient lag to indicate a valid one)", defaultRecipient)
 	}
 
 	fmt.Printf(`
@@ -82,39 +486,99 @@ Using SMTP credentials:
   - SMTP Port: %d
   - SMTP User: %q
   - SMTP Password: %q
+  - SMTP Encryption: %q
+  - SMTP Authentication: %q
+  - Mail Sender: %q
   - Mail Recipient: %q
 
-`, smtp.Host, smtp.Port, smtp.User, passwordOutput, recipientText)
+`, smtp.Host, smtp.Port, smtp.User, redact.Secret(smtp.Pass), encryptionText, authText, senderText, recipientText)
+	if suggestion := providers.Suggest(smtp.Host); suggestion != "" {
+		fmt.Printf("Warning: %q is not a known SMTP server, did you mean %q?\n\n", smtp.Host, suggestion)
+	}
 
 	var errors error
 
-	fmt.Println("-- Check: Connectivity with SMTP server --")
-	err := RunConnectivityChecks(smtp.Host, smtp.Port)
-	if err != nil {
-		errors = multierror.Append(errors, err)
+	if enabled["connectivity"] {
+		fmt.Println("-- Check: Connectivity with SMTP server --")
+		err := runCheck("connectivity", func(ctx context.Context) error {
+			return RunConnectivityChecks(ctx, smtp.Host, smtp.Port)
+		})
+		if err != nil {
+			errors = multierror.Append(errors, err)
+		}
+	}
+
+	if enabled["ports"] {
+		fmt.Println("-- Check: Outbound SMTP ports --")
+		err = runCheck("ports", func(ctx context.Context) error {
+			return RunPortChecks(ctx, smtp.Host, smtp.Port)
+		})
+		if err != nil {
+			errors = multierror.Append(errors, err)
+		}
 	}
 
-	if smtp.Port == 465 {
+	if enabled["tls"] && smtp.ImplicitTLS() {
 		fmt.Println("-- Check: Connectivity with SMTP server via TLS --")
-		err = RunTLSConnectivityChecks(smtp.Host, smtp.Port)
+		err = runCheck("tls", func(ctx context.Context) error {
+			return RunTLSConnectivityChecks(ctx, smtp.Host, smtp.Port)
+		})
 		if err != nil {
 			errors = multierror.Append(errors, err)
 		}
 	}
 
-	fmt.Println("-- Check: server time offset --")
-	err = RunNTPChecks()
-	if err != nil {
-		errors = multierror.Append(errors, err)
+	if enabled["starttls"] && !smtp.ImplicitTLS() && smtp.Encryption != apps.EncryptionNone {
+		fmt.Println("-- Check: STARTTLS negotiation with SMTP server --")
+		err = runCheck("starttls", func(ctx context.Context) error {
+			return RunSTARTTLSChecks(ctx, smtp.Host, smtp.Port)
+		})
+		if err != nil {
+			errors = multierror.Append(errors, err)
+		}
 	}
 
-	fmt.Println("-- Check: Send mail via SMTP --")
-	if recipient != defaultRecipient {
-		fmt.Printf("\nNote: Remember to check the recipient's mail inbox!\n")
+	if enabled["ntp"] {
+		fmt.Println("-- Check: server time offset --")
+		err = runCheck("ntp", func(ctx context.Context) error {
+			return RunNTPChecks(ctx, strings.Split(ntpServers, ","), maxClockOffset, maxNTPRTT, ntpLocal)
+		})
+		if err != nil {
+			errors = multierror.Append(errors, err)
+		}
 	}
-	err = RunSendMailChecks(smtp, recipient)
-	if err != nil {
-		errors = multierror.Append(errors, err)
+
+	if enabled["sendmail"] {
+		fmt.Println("-- Check: Send mail via SMTP --")
+		if !defaultRecipientOnly {
+			fmt.Printf("\nNote: Remember to check the recipient's mail inbox!\n")
+		}
+		err = runTracedCheck("sendmail", func(ctx context.Context, tr *transcript) error {
+			return RunSendMailChecks(ctx, smtp, tmpl, tr, recipients...)
+		})
+		if err != nil {
+			errors = multierror.Append(errors, err)
+		}
+	}
+
+	if enabled["roundtrip"] && mb != nil {
+		fmt.Println("-- Check: Mail delivery to the recipient's mailbox --")
+		err = runTracedCheck("roundtrip", func(ctx context.Context, tr *transcript) error {
+			return RunRoundTripChecks(ctx, smtp, mb, tmpl, tr, recipients...)
+		})
+		if err != nil {
+			errors = multierror.Append(errors, err)
+		}
+	}
+
+	if enabled["mailauth"] {
+		fmt.Println("-- Check: SPF, DKIM and DMARC records of the sender domain --")
+		err = runCheck("mailauth", func(ctx context.Context) error {
+			return RunMailAuthChecks(ctx, smtp, dnsResolver, strings.Split(dkimSelectors, ","))
+		})
+		if err != nil {
+			errors = multierror.Append(errors, err)
+		}
 	}
 
 	fmt.Printf(`
@@ -123,6 +587,9 @@ SMTP CHECKS FINISHED
 ======================================
 
 `)
+	if bundleMode {
+		writeBundle(bundleOutput, installDir, app, env, smtp, recipients, results)
+	}
 	if errors != nil {
 		log.Fatalf("Found errors when checking the SMTP configuration:\n%v", errors)
 	}
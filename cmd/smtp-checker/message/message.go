@@ -0,0 +1,246 @@
+// Package message provides functions for building MIME mail messages (RFC 5322
+// and RFC 2045) like the ones sent by the applications
+package message
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Header is a custom header of the message
+type Header struct {
+	Name  string
+	Value string
+}
+
+// Attachment is a file attached to the message
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Message is a mail message. Date and MessageID are generated when empty.
+type Message struct {
+	From        mail.Address
+	To          []string
+	Subject     string
+	Date        time.Time
+	MessageID   string
+	Text        string
+	HTML        string
+	Attachments []Attachment
+	Headers     []Header
+}
+
+// generatedHeaders are the headers set by the builder, which cannot be customized
+var generatedHeaders = []string{"From", "To", "Subject", "Date", "Message-Id", "Mime-Version", "Content-Type", "Content-Transfer-Encoding"}
+
+// ParseHeader parses a custom header with the format "Name: value"
+func ParseHeader(s string) (Header, error) {
+	kv := strings.SplitN(s, ":", 2)
+	if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+		return Header{}, fmt.Errorf("%q does not follow the format <name>: <value>", s)
+	}
+	h := Header{Name: textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(kv[0])), Value: strings.TrimSpace(kv[1])}
+	if strings.ContainsAny(h.Name, " \t\r\n") || strings.ContainsAny(h.Value, "\r\n") {
+		return Header{}, fmt.Errorf("invalid header %q", s)
+	}
+	for _, name := range generatedHeaders {
+		if h.Name == name {
+			return Header{}, fmt.Errorf("the %s header cannot be customized", h.Name)
+		}
+	}
+	return h, nil
+}
+
+// Headers contains custom headers. It can be used as a repeatable command line flag.
+type Headers []Header
+
+func (h *Headers) String() string {
+	if h == nil {
+		return ""
+	}
+	var res []string
+	for _, header := range *h {
+		res = append(res, header.Name+": "+header.Value)
+	}
+	return strings.Join(res, ", ")
+}
+
+// Set parses and adds a header with the format "Name: value"
+func (h *Headers) Set(value string) error {
+	header, err := ParseHeader(value)
+	if err != nil {
+		return err
+	}
+	*h = append(*h, header)
+	return nil
+}
+
+// NewAttachment reads a file to attach, guessing its content type from the extension
+func NewAttachment(path string) (Attachment, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Attachment{}, err
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return Attachment{Name: filepath.Base(path), ContentType: contentType, Data: data}, nil
+}
+
+// NewMessageID returns a unique Message-ID for the domain
+func NewMessageID(domain string) (string, error) {
+	random := make([]byte, 12)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	if domain == "" {
+		domain = "localhost"
+	}
+	return fmt.Sprintf("<%d.%x@%s>", time.Now().UnixNano(), random, domain), nil
+}
+
+// domain returns the domain of the sender, used in the Message-ID
+func (m *Message) domain() string {
+	if i := strings.LastIndex(m.From.Address, "@"); i >= 0 {
+		return m.From.Address[i+1:]
+	}
+	if h, err := os.Hostname(); err == nil {
+		return h
+	}
+	return ""
+}
+
+// Bytes builds the message, with CRLF line endings
+func (m *Message) Bytes() ([]byte, error) {
+	if m.Date.IsZero() {
+		m.Date = time.Now()
+	}
+	if m.MessageID == "" {
+		id, err := NewMessageID(m.domain())
+		if err != nil {
+			return nil, err
+		}
+		m.MessageID = id
+	}
+	var buf bytes.Buffer
+	writeHeader(&buf, "From", m.From.String())
+	writeHeader(&buf, "To", strings.Join(m.To, ", "))
+	writeHeader(&buf, "Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	writeHeader(&buf, "Date", m.Date.Format(time.RFC1123Z))
+	writeHeader(&buf, "Message-ID", m.MessageID)
+	writeHeader(&buf, "MIME-Version", "1.0")
+	for _, h := range m.Headers {
+		writeHeader(&buf, h.Name, mime.QEncoding.Encode("utf-8", h.Value))
+	}
+
+	bodyHeader, body, err := m.body()
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Attachments) == 0 {
+		for _, name := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+			if v := bodyHeader.Get(name); v != "" {
+				writeHeader(&buf, name, v)
+			}
+		}
+		buf.WriteString("\r\n")
+		buf.Write(body)
+		return buf.Bytes(), nil
+	}
+	mw := multipart.NewWriter(&buf)
+	writeHeader(&buf, "Content-Type", mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": mw.Boundary()}))
+	buf.WriteString("\r\n")
+	part, err := mw.CreatePart(bodyHeader)
+	if err != nil {
+		return nil, err
+	}
+	part.Write(body)
+	for _, a := range m.Attachments {
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Type", mime.FormatMediaType(a.ContentType, map[string]string{"name": a.Name}))
+		h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Name}))
+		h.Set("Content-Transfer-Encoding", "base64")
+		part, err := mw.CreatePart(h)
+		if err != nil {
+			return nil, err
+		}
+		writeBase64(part, a.Data)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// body returns the headers and the content of the text part, or of the
+// alternative text and HTML parts
+func (m *Message) body() (textproto.MIMEHeader, []byte, error) {
+	h := textproto.MIMEHeader{}
+	var buf bytes.Buffer
+	if m.HTML == "" {
+		h.Set("Content-Type", "text/plain; charset=UTF-8")
+		h.Set("Content-Transfer-Encoding", "quoted-printable")
+		if err := writeQuotedPrintable(&buf, m.Text); err != nil {
+			return nil, nil, err
+		}
+		return h, buf.Bytes(), nil
+	}
+	mw := multipart.NewWriter(&buf)
+	h.Set("Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": mw.Boundary()}))
+	for _, part := range []struct{ contentType, content string }{{"text/plain", m.Text}, {"text/html", m.HTML}} {
+		ph := textproto.MIMEHeader{}
+		ph.Set("Content-Type", part.contentType+"; charset=UTF-8")
+		ph.Set("Content-Transfer-Encoding", "quoted-printable")
+		pw, err := mw.CreatePart(ph)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := writeQuotedPrintable(pw, part.content); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, nil, err
+	}
+	return h, buf.Bytes(), nil
+}
+
+func writeHeader(w io.Writer, name, value string) {
+	fmt.Fprintf(w, "%s: %s\r\n", name, value)
+}
+
+func writeQuotedPrintable(w io.Writer, s string) error {
+	qp := quotedprintable.NewWriter(w)
+	s = strings.Replace(strings.Replace(s, "\r\n", "\n", -1), "\n", "\r\n", -1)
+	if _, err := io.WriteString(qp, s); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// writeBase64 writes data in base64 with lines of 76 characters
+func writeBase64(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		io.WriteString(w, encoded[:76]+"\r\n")
+		encoded = encoded[76:]
+	}
+	io.WriteString(w, encoded+"\r\n")
+}
@@ -0,0 +1,133 @@
+package message
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestBytes(t *testing.T) {
+	t.Run("Check RFC 5322 headers", func(t *testing.T) {
+		m := &Message{
+			From:    mail.Address{Name: "Blog", Address: "wordpress@example.com"},
+			To:      []string{"test@example.com"},
+			Subject: "Correo de préstamo",
+			Text:    "Línea 1\nLínea 2",
+			Headers: []Header{{"X-Mailer", "PHPMailer"}},
+		}
+		raw, err := m.Bytes()
+		if err != nil {
+			t.Fatalf("Error building message: %v", err)
+		}
+		msg, err := mail.ReadMessage(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatalf("Error parsing message: %v", err)
+		}
+		if _, err := msg.Header.Date(); err != nil {
+			t.Errorf("Incorrect Date header: %v", err)
+		}
+		if id := msg.Header.Get("Message-ID"); !strings.HasPrefix(id, "<") || !strings.HasSuffix(id, "@example.com>") {
+			t.Errorf("Incorrect Message-ID, got: %s", id)
+		}
+		subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+		if subject != m.Subject || !strings.HasPrefix(msg.Header.Get("Subject"), "=?utf-8?q?") {
+			t.Errorf("Incorrect Subject, expected: %s, got: %s (%s)", m.Subject, subject, msg.Header.Get("Subject"))
+		}
+		if msg.Header.Get("X-Mailer") != "PHPMailer" {
+			t.Errorf("Incorrect custom header, expected: PHPMailer, got: %s", msg.Header.Get("X-Mailer"))
+		}
+		body, _ := ioutil.ReadAll(quotedprintable.NewReader(msg.Body))
+		if string(body) != "Línea 1\r\nLínea 2" {
+			t.Errorf("Incorrect body, got: %q", body)
+		}
+		if !bytes.Contains(raw, []byte("\r\n\r\n")) || bytes.Contains(bytes.Replace(raw, []byte("\r\n"), nil, -1), []byte("\n")) {
+			t.Errorf("Incorrect line endings in: %q", raw)
+		}
+		other, _ := (&Message{From: m.From}).Bytes()
+		if bytes.Contains(other, []byte(m.MessageID)) {
+			t.Errorf("Message-ID is not unique: %s", m.MessageID)
+		}
+	})
+	t.Run("Check HTML alternative and attachment", func(t *testing.T) {
+		m := &Message{
+			From:        mail.Address{Address: "wordpress@example.com"},
+			To:          []string{"test@example.com"},
+			Subject:     "Test",
+			Text:        "Text",
+			HTML:        "<p>HTML</p>",
+			Attachments: []Attachment{{Name: "report.pdf", ContentType: "application/pdf", Data: []byte("%PDF-1.4")}},
+		}
+		raw, err := m.Bytes()
+		if err != nil {
+			t.Fatalf("Error building message: %v", err)
+		}
+		msg, err := mail.ReadMessage(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatalf("Error parsing message: %v", err)
+		}
+		mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+		if err != nil || mediaType != "multipart/mixed" {
+			t.Fatalf("Incorrect Content-Type, expected: multipart/mixed, got: %s", msg.Header.Get("Content-Type"))
+		}
+		r := multipart.NewReader(msg.Body, params["boundary"])
+		var types []string
+		for {
+			p, err := r.NextPart()
+			if err != nil {
+				break
+			}
+			mediaType, params, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+			types = append(types, mediaType)
+			if mediaType == "multipart/alternative" {
+				ar := multipart.NewReader(p, params["boundary"])
+				for {
+					ap, err := ar.NextPart()
+					if err != nil {
+						break
+					}
+					mediaType, _, _ := mime.ParseMediaType(ap.Header.Get("Content-Type"))
+					types = append(types, mediaType)
+				}
+			}
+			if p.FileName() != "" && p.FileName() != "report.pdf" {
+				t.Errorf("Incorrect attachment name, expected: report.pdf, got: %s", p.FileName())
+			}
+		}
+		expected := "multipart/alternative,text/plain,text/html,application/pdf"
+		if strings.Join(types, ",") != expected {
+			t.Errorf("Incorrect parts, expected: %s, got: %s", expected, strings.Join(types, ","))
+		}
+	})
+}
+
+func TestParseHeader(t *testing.T) {
+	t.Run("Check custom headers are parsed", func(t *testing.T) {
+		h, err := ParseHeader("x-mailer:  WordPress ")
+		if err != nil || h.Name != "X-Mailer" || h.Value != "WordPress" {
+			t.Errorf("Incorrect header, got: %+v (%v)", h, err)
+		}
+	})
+	t.Run("Check repeated headers flag", func(t *testing.T) {
+		var h Headers
+		for _, s := range []string{"X-Mailer: WordPress", "List-Unsubscribe: <mailto:unsubscribe@example.com>"} {
+			if err := h.Set(s); err != nil {
+				t.Fatalf("Error setting header %q: %v", s, err)
+			}
+		}
+		if expected := "X-Mailer: WordPress, List-Unsubscribe: <mailto:unsubscribe@example.com>"; h.String() != expected {
+			t.Errorf("Incorrect headers, expected: %s, got: %s", expected, h.String())
+		}
+	})
+	t.Run("Check invalid headers are rejected", func(t *testing.T) {
+		for _, s := range []string{"X-Mailer", "Subject: other", "Bad Name: value"} {
+			if _, err := ParseHeader(s); err == nil {
+				t.Errorf("Invalid header %q accepted", s)
+			}
+		}
+	})
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bitnami-labs/healthcheck-tools/pkg/timeout"
+	"github.com/juju/errors"
+)
+
+// smtpPorts are the ports usually offered by SMTP relays: 25 (relay between
+// servers), 465 (implicit TLS), 587 (submission) and 2525 (alternative submission
+// port offered by providers such as SendGrid or Mailgun)
+var smtpPorts = []int{25, 465, 587, 2525}
+
+// Outcome of connecting to a port
+const (
+	portOpen        = "open"
+	portRefused     = "refused"
+	portTimeout     = "timeout"
+	portReset       = "reset"
+	portUnreachable = "unreachable"
+	portError       = "error"
+)
+
+// greetingTimeout is the maximum time to wait for the greeting of an open port
+const greetingTimeout = 3 * time.Second
+
+// portResult is the outcome of connecting to a port
+type portResult struct {
+	Port   int
+	Status string
+	Err    error
+}
+
+// classifyNetError returns the outcome matching a connection error
+func classifyNetError(err error) string {
+	if err == io.EOF {
+		return portReset
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return portTimeout
+	}
+	if oe, ok := err.(*net.OpError); ok {
+		err = oe.Err
+	}
+	if se, ok := err.(*os.SyscallError); ok {
+		err = se.Err
+	}
+	switch err {
+	case syscall.ECONNREFUSED:
+		return portRefused
+	case syscall.ECONNRESET, syscall.EPIPE:
+		return portReset
+	case syscall.EHOSTUNREACH, syscall.ENETUNREACH:
+		return portUnreachable
+	}
+	return portError
+}
+
+// probePort connects to the port and waits for the greeting, so connections
+// reset by a firewall right after being accepted are detected
+func probePort(ctx context.Context, hostname string, port int) portResult {
+	res := portResult{Port: port, Status: portOpen}
+	conn, err := timeout.Dial(ctx, "tcp", net.JoinHostPort(hostname, fmt.Sprint(port)))
+	if err != nil {
+		res.Status, res.Err = classifyNetError(err), err
+		if ctx.Err() != nil {
+			res.Status = portTimeout
+		}
+		return res
+	}
+	defer conn.Close()
+	// Servers with implicit TLS wait for the client, so a greeting timeout is not an error
+	conn.SetReadDeadline(time.Now().Add(greetingTimeout))
+	if _, err := bufio.NewReader(conn).ReadString('\n'); err != nil {
+		if status := classifyNetError(err); status == portReset {
+			res.Status, res.Err = status, err
+		}
+	}
+	return res
+}
+
+// encryptionHint returns the encryption to use with a port
+func encryptionHint(port int) string {
+	if port == 465 {
+		return "-smtp_encryption tls"
+	}
+	return "-smtp_encryption starttls"
+}
+
+// portsDiagnosis explains the outcome of the connections, returning an error if the
+// configured port is not reachable
+func portsDiagnosis(hostname string, configured int, results []portResult) error {
+	var open, timedOut []int
+	var configuredResult portResult
+	for _, r := range results {
+		switch r.Status {
+		case portOpen:
+			open = append(open, r.Port)
+		case portTimeout:
+			timedOut = append(timedOut, r.Port)
+		}
+		if r.Port == configured {
+			configuredResult = r
+		}
+	}
+	if configuredResult.Status == portOpen {
+		return nil
+	}
+	var msg string
+	switch configuredResult.Status {
+	case portRefused:
+		msg = fmt.Sprintf("%s refuses connections on port %d, the server does not accept SMTP on that port", hostname, configured)
+	case portReset:
+		msg = fmt.Sprintf("connections to %s on port %d are reset, a firewall or antivirus may be intercepting SMTP traffic", hostname, configured)
+	case portTimeout:
+		msg = fmt.Sprintf("connections to %s on port %d time out", hostname, configured)
+	case portUnreachable:
+		msg = fmt.Sprintf("%s is unreachable from this host, check the network routes", hostname)
+	default:
+		msg = fmt.Sprintf("cannot connect to %s on port %d: %v", hostname, configured, configuredResult.Err)
+	}
+	switch {
+	case len(open) == 1 && len(timedOut) == len(results)-1:
+		msg += fmt.Sprintf(". All the ports but %d time out, so the hosting provider is likely blocking outbound SMTP traffic (e.g. AWS, Google Cloud, Azure and DigitalOcean block port 25). Use port %d instead (-smtp_port %d %s) or ask the provider to remove the block", open[0], open[0], open[0], encryptionHint(open[0]))
+	case len(open) == 0 && len(timedOut) == len(results):
+		msg += ". All the ports time out, a firewall in this host or in the hosting provider is likely dropping outbound SMTP traffic"
+	case len(open) > 0:
+		var alternatives []string
+		for _, p := range open {
+			alternatives = append(alternatives, fmt.Sprint(p))
+		}
+		msg += fmt.Sprintf(". The server is reachable on port(s) %s, consider using one of them", strings.Join(alternatives, ", "))
+	}
+	return errors.New(msg)
+}
+
+// RunPortChecks tries the usual SMTP ports and the configured one in parallel,
+// reporting whether each one is open, refused, reset or times out
+func RunPortChecks(ctx context.Context, hostname string, configured int) error {
+	ports := []int{configured}
+	for _, p := range smtpPorts {
+		if p != configured {
+			ports = append(ports, p)
+		}
+	}
+	sort.Ints(ports)
+	results := make([]portResult, len(ports))
+	done := make(chan struct{})
+	for i, p := range ports {
+		go func(i, p int) {
+			results[i] = probePort(ctx, hostname, p)
+			done <- struct{}{}
+		}(i, p)
+	}
+	for range ports {
+		<-done
+	}
+	fmt.Printf("Outbound connections to %s:\n", hostname)
+	for _, r := range results {
+		suffix := ""
+		if r.Port == configured {
+			suffix = " (configured)"
+		}
+		fmt.Printf("  - Port %d%s: %s\n", r.Port, suffix, r.Status)
+	}
+	if err := portsDiagnosis(hostname, configured, results); err != nil {
+		return err
+	}
+	fmt.Printf("Port %d reachable!\n", configured)
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassifyNetError(t *testing.T) {
+	testData := []struct {
+		err    error
+		status string
+	}{
+		{&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, portRefused},
+		{&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, portReset},
+		{&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.EHOSTUNREACH)}, portUnreachable},
+		{&net.OpError{Op: "dial", Err: timeoutError{}}, portTimeout},
+		{errors.New("unexpected"), portError},
+	}
+	t.Run("Check connection errors are classified", func(t *testing.T) {
+		for _, tt := range testData {
+			if status := classifyNetError(tt.err); status != tt.status {
+				t.Errorf("Incorrect status for %v, expected: %s, got: %s", tt.err, tt.status, status)
+			}
+		}
+	})
+}
+
+func TestPortsDiagnosis(t *testing.T) {
+	t.Run("Check a provider block is reported", func(t *testing.T) {
+		err := portsDiagnosis("smtp.example.com", 25, []portResult{
+			{25, portTimeout, nil}, {465, portTimeout, nil}, {587, portOpen, nil}, {2525, portTimeout, nil},
+		})
+		if err == nil || !strings.Contains(err.Error(), "hosting provider is likely blocking") || !strings.Contains(err.Error(), "-smtp_port 587 -smtp_encryption starttls") {
+			t.Errorf("Incorrect diagnosis, got: %v", err)
+		}
+	})
+	t.Run("Check a refused port is reported", func(t *testing.T) {
+		err := portsDiagnosis("smtp.example.com", 2525, []portResult{
+			{25, portOpen, nil}, {465, portOpen, nil}, {587, portOpen, nil}, {2525, portRefused, nil},
+		})
+		if err == nil || !strings.Contains(err.Error(), "refuses connections on port 2525") || !strings.Contains(err.Error(), "port(s) 25, 465, 587") {
+			t.Errorf("Incorrect diagnosis, got: %v", err)
+		}
+	})
+	t.Run("Check an open configured port passes", func(t *testing.T) {
+		err := portsDiagnosis("smtp.example.com", 587, []portResult{
+			{25, portTimeout, nil}, {465, portTimeout, nil}, {587, portOpen, nil}, {2525, portTimeout, nil},
+		})
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+}
+
+func TestProbePort(t *testing.T) {
+	open, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer open.Close()
+	go func() {
+		for {
+			conn, err := open.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("220 localhost ESMTP\r\n"))
+			conn.Close()
+		}
+	}()
+	reset, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reset.Close()
+	go func() {
+		for {
+			conn, err := reset.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*net.TCPConn).SetLinger(0)
+			conn.Close()
+		}
+	}()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	testData := []struct {
+		addr   net.Addr
+		status string
+	}{
+		{open.Addr(), portOpen},
+		{reset.Addr(), portReset},
+		{closed.Addr(), portRefused},
+	}
+	t.Run("Check ports are probed", func(t *testing.T) {
+		for _, tt := range testData {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			res := probePort(ctx, "127.0.0.1", tt.addr.(*net.TCPAddr).Port)
+			cancel()
+			if res.Status != tt.status {
+				t.Errorf("Incorrect status for %s, expected: %s, got: %s (%v)", tt.addr, tt.status, res.Status, res.Err)
+			}
+		}
+	})
+}
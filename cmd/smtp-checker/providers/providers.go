@@ -0,0 +1,276 @@
+// Package providers provides the settings required by the most common SMTP
+// providers, for validating the configuration of the applications
+package providers
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Encryption required on each port. They match the encryption modes of apps.SMTPSettings.
+const (
+	STARTTLS = "starttls"
+	TLS      = "tls"
+)
+
+// Preset contains the settings accepted by a SMTP provider
+type Preset struct {
+	// Name identifies the provider (e.g. gmail)
+	Name  string
+	Title string
+	Hosts []string
+	// HostPattern matches the hosts of providers with regional endpoints
+	HostPattern *regexp.Regexp
+	// Ports maps each port to the encryption it requires
+	Ports map[int]string
+	// Auth contains the authentication mechanisms accepted
+	Auth []string
+	// User is the user required by the provider, if fixed
+	User string
+	// Typos contains hosts commonly used by mistake
+	Typos []string
+}
+
+// Presets contains the known SMTP providers
+var Presets = []Preset{
+	{
+		Name:  "gmail",
+		Title: "Gmail",
+		Hosts: []string{"smtp.gmail.com", "smtp.googlemail.com"},
+		Ports: map[int]string{25: STARTTLS, 465: TLS, 587: STARTTLS},
+		Auth:  []string{"plain", "login", "xoauth2"},
+		Typos: []string{"gmail.com", "smtp.google.com", "mail.gmail.com", "smtp.gmail"},
+	},
+	{
+		Name:  "gmail",
+		Title: "Google Workspace SMTP relay",
+		Hosts: []string{"smtp-relay.gmail.com"},
+		Ports: map[int]string{25: STARTTLS, 465: TLS, 587: STARTTLS},
+		Auth:  []string{"none", "plain", "login"},
+	},
+	{
+		Name:  "office365",
+		Title: "Office 365",
+		Hosts: []string{"smtp.office365.com", "smtp-mail.outlook.com"},
+		Ports: map[int]string{25: STARTTLS, 587: STARTTLS},
+		Auth:  []string{"login", "xoauth2"},
+		Typos: []string{"smtp.outlook.com", "outlook.office365.com", "smtp.office.com", "smtp.live.com"},
+	},
+	{
+		Name:        "office365",
+		Title:       "Office 365 direct send",
+		HostPattern: regexp.MustCompile(`\.mail\.protection\.outlook\.com$`),
+		Ports:       map[int]string{25: STARTTLS},
+		Auth:        []string{"none"},
+	},
+	{
+		Name:        "ses",
+		Title:       "Amazon SES",
+		HostPattern: regexp.MustCompile(`^email-smtp(-fips)?\.[a-z]{2}(-gov)?-[a-z]+-\d\.amazonaws\.com$`),
+		Ports:       map[int]string{25: STARTTLS, 465: TLS, 587: STARTTLS, 2465: TLS, 2587: STARTTLS},
+		Auth:        []string{"plain", "login"},
+	},
+	{
+		Name:  "sendgrid",
+		Title: "SendGrid",
+		Hosts: []string{"smtp.sendgrid.net"},
+		Ports: map[int]string{25: STARTTLS, 465: TLS, 587: STARTTLS, 2525: STARTTLS},
+		Auth:  []string{"plain", "login"},
+		User:  "apikey",
+		Typos: []string{"smtp.sendgrid.com", "sendgrid.net"},
+	},
+	{
+		Name:  "mailgun",
+		Title: "Mailgun",
+		Hosts: []string{"smtp.mailgun.org", "smtp.eu.mailgun.org"},
+		Ports: map[int]string{25: STARTTLS, 465: TLS, 587: STARTTLS, 2525: STARTTLS},
+		Auth:  []string{"plain", "login", "cram-md5"},
+		Typos: []string{"smtp.mailgun.com", "mailgun.org"},
+	},
+	{
+		Name:  "mailjet",
+		Title: "Mailjet",
+		Hosts: []string{"in-v3.mailjet.com"},
+		Ports: map[int]string{25: STARTTLS, 465: TLS, 587: STARTTLS, 2525: STARTTLS},
+		Auth:  []string{"plain", "login"},
+		Typos: []string{"in.mailjet.com", "smtp.mailjet.com", "in-v2.mailjet.com"},
+	},
+	{
+		Name:  "zoho",
+		Title: "Zoho Mail",
+		Hosts: []string{
+			"smtp.zoho.com", "smtp.zoho.eu", "smtp.zoho.in", "smtp.zoho.com.au", "smtp.zoho.jp",
+			"smtppro.zoho.com", "smtppro.zoho.eu", "smtppro.zoho.in", "smtppro.zoho.com.au", "smtppro.zoho.jp",
+		},
+		Ports: map[int]string{465: TLS, 587: STARTTLS},
+		Auth:  []string{"plain", "login"},
+		Typos: []string{"smtp.zohomail.com", "mail.zoho.com"},
+	},
+}
+
+// otherHosts are hosts of other providers, close to the ones of the presets but
+// not typos
+var otherHosts = []string{
+	"smtp.mail.com", "smtp.gmx.com", "smtp.aol.com", "smtp.mail.yahoo.com", "smtp.mail.me.com",
+	"smtp.yandex.com", "smtp.fastmail.com", "smtp.postmarkapp.com", "smtp.sparkpostmail.com",
+}
+
+// sesTypoRe matches hosts that look like an Amazon SES endpoint
+var sesTypoRe = regexp.MustCompile(`email-smtp|amazonaws|amazonses`)
+
+// secondLevelSuffixes contains the second-level domains under which the country
+// code domains are registered (e.g. com.au)
+var secondLevelSuffixes = map[string]bool{"ac": true, "co": true, "com": true, "edu": true, "gov": true, "net": true, "org": true}
+
+func normalize(host string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(host), "."))
+}
+
+// Lookup returns the preset of the provider of host, or nil if unknown
+func Lookup(host string) *Preset {
+	host = normalize(host)
+	for i, p := range Presets {
+		for _, h := range p.Hosts {
+			if host == h {
+				return &Presets[i]
+			}
+		}
+		if p.HostPattern != nil && p.HostPattern.MatchString(host) {
+			return &Presets[i]
+		}
+	}
+	return nil
+}
+
+// distance returns the Levenshtein distance between two strings
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+// registrableDomain returns the domain registered by the owner of host (e.g.
+// zoho.com.au for smtp.zoho.com.au)
+func registrableDomain(host string) string {
+	labels := strings.Split(host, ".")
+	n := 2
+	if len(labels) > 2 && len(labels[len(labels)-1]) == 2 && secondLevelSuffixes[labels[len(labels)-2]] {
+		n = 3
+	}
+	if len(labels) < n {
+		return host
+	}
+	return strings.Join(labels[len(labels)-n:], ".")
+}
+
+// siblings returns whether a and b are in different domains of the same owner
+// (e.g. zoho.sa and zoho.eu), as the regional endpoints of the providers are
+func siblings(a, b string) bool {
+	da, db := registrableDomain(a), registrableDomain(b)
+	return da != db && strings.Split(da, ".")[0] == strings.Split(db, ".")[0]
+}
+
+// Suggest returns the host of a known provider that host is likely a typo of, or
+// an empty string. Hosts of other providers and regional endpoints of the known
+// ones (e.g. smtp.zoho.sa) are not reported.
+func Suggest(host string) string {
+	host = normalize(host)
+	if Lookup(host) != nil {
+		return ""
+	}
+	for _, h := range otherHosts {
+		if host == h {
+			return ""
+		}
+	}
+	for _, p := range Presets {
+		for _, typo := range p.Typos {
+			if host == typo {
+				return p.Hosts[0]
+			}
+		}
+		for _, h := range p.Hosts {
+			if !siblings(host, h) && distance(host, h) <= 2 {
+				return h
+			}
+		}
+	}
+	if sesTypoRe.MatchString(host) {
+		return "email-smtp.<region>.amazonaws.com"
+	}
+	return ""
+}
+
+// ports returns the ports accepted by the provider, sorted
+func (p *Preset) ports() string {
+	var ports []int
+	for port := range p.Ports {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+	var res []string
+	for _, port := range ports {
+		res = append(res, fmt.Sprintf("%d (%s)", port, p.Ports[port]))
+	}
+	return strings.Join(res, ", ")
+}
+
+// Validate checks the settings are accepted by the provider of host. Empty
+// encryption and auth mean they are not configured, and are not checked.
+func Validate(host string, port int, encryption, auth, user string) error {
+	p := Lookup(host)
+	if p == nil {
+		return nil
+	}
+	required, ok := p.Ports[port]
+	if !ok {
+		return fmt.Errorf("port: %s does not accept connections on port %d (valid ports: %s)", p.Title, port, p.ports())
+	}
+	switch {
+	case encryption == "none":
+		return fmt.Errorf("encryption: %s requires an encrypted connection, use %s on port %d", p.Title, required, port)
+	case encryption != "" && encryption != required:
+		return fmt.Errorf("encryption: %s requires %s on port %d, not %s", p.Title, required, port, encryption)
+	case encryption == "" && required == TLS && port != 465:
+		return fmt.Errorf("encryption: %s requires implicit TLS on port %d, set the encryption to tls", p.Title, port)
+	}
+	if auth != "" {
+		valid := false
+		for _, a := range p.Auth {
+			valid = valid || auth == a
+		}
+		if !valid {
+			return fmt.Errorf("auth: %s does not accept the %s authentication mechanism (valid mechanisms: %s)", p.Title, auth, strings.Join(p.Auth, ", "))
+		}
+	}
+	if p.User != "" && auth != "none" && user != p.User {
+		return fmt.Errorf("user: %s requires the user %q", p.Title, p.User)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package providers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	testData := []struct {
+		host       string
+		port       int
+		encryption string
+		auth       string
+		user       string
+		err        string
+	}{
+		{"smtp.gmail.com", 587, "", "", "user@gmail.com", ""},
+		{"smtp.gmail.com", 465, "tls", "plain", "user@gmail.com", ""},
+		{"smtp.gmail.com", 587, "tls", "", "user@gmail.com", "requires starttls on port 587"},
+		{"smtp.gmail.com", 587, "none", "", "user@gmail.com", "requires an encrypted connection"},
+		{"smtp.gmail.com", 2525, "", "", "user@gmail.com", "does not accept connections on port 2525"},
+		{"smtp.google.com", 587, "", "", "user@gmail.com", ""},
+		{"smtp.office365.com", 465, "", "", "user@example.com", "does not accept connections on port 465"},
+		{"smtp.office365.com", 587, "", "cram-md5", "user@example.com", "does not accept the cram-md5 authentication mechanism"},
+		{"email-smtp.eu-west-1.amazonaws.com", 2587, "starttls", "", "AKIAEXAMPLE", ""},
+		{"smtp.sendgrid.net", 2525, "", "", "user@example.com", `requires the user "apikey"`},
+		{"smtp.sendgrid.net", 2525, "", "", "apikey", ""},
+		{"in-v3.mailjet.com", 587, "", "", "key", ""},
+		{"smtp.zoho.eu", 465, "", "", "user@example.com", ""},
+		{"smtp.mail.com", 587, "", "", "user@mail.com", ""},
+		{"mail.example.com", 2525, "none", "", "user@example.com", ""},
+	}
+	t.Run("Check provider settings are validated", func(t *testing.T) {
+		for _, tt := range testData {
+			err := Validate(tt.host, tt.port, tt.encryption, tt.auth, tt.user)
+			if tt.err == "" && err != nil {
+				t.Errorf("Unexpected error for %s:%d: %v", tt.host, tt.port, err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("Incorrect error for %s:%d, expected: %s, got: %v", tt.host, tt.port, tt.err, err)
+			}
+		}
+	})
+}
+
+func TestSuggest(t *testing.T) {
+	testData := map[string]string{
+		"smpt.gmail.com":    "smtp.gmail.com",
+		"smtp.gmail.com":    "",
+		"smtp.google.com":   "smtp.gmail.com",
+		"smtp.gmial.com":    "smtp.gmail.com",
+		"smtp.sendgird.net": "smtp.sendgrid.net",
+		"smtp.zoho.com.cn":  "",
+		"smtp.zoho.sa":      "",
+		"smpt.zoho.eu":      "smtp.zoho.eu",
+		"smtp.mailgun.com":  "smtp.mailgun.org",
+		"mail.example.com":  "",
+		"email-smtp.aws.co": "email-smtp.<region>.amazonaws.com",
+	}
+	t.Run("Check typos of the hosts of the providers", func(t *testing.T) {
+		for host, expected := range testData {
+			if suggestion := Suggest(host); suggestion != expected {
+				t.Errorf("Incorrect suggestion for %s, expected: %q, got: %q", host, expected, suggestion)
+			}
+		}
+	})
+}
+
+func TestLookup(t *testing.T) {
+	t.Run("Check regional endpoints are detected", func(t *testing.T) {
+		if p := Lookup("email-smtp.us-gov-west-1.amazonaws.com"); p == nil || p.Name != "ses" {
+			t.Errorf("Incorrect preset, expected: ses, got: %v", p)
+		}
+		if p := Lookup("SMTP.Gmail.com."); p == nil || p.Name != "gmail" {
+			t.Errorf("Incorrect preset, expected: gmail, got: %v", p)
+		}
+	})
+}
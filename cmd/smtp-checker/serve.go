@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mime"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/sink"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/redact"
+)
+
+// printedHeaders are the headers printed for every message received
+var printedHeaders = []string{"From", "To", "Cc", "Reply-To", "Date", "Message-Id", "Content-Type", "Content-Transfer-Encoding"}
+
+// printMessage prints the envelope and the main headers of a message
+func printMessage(n int, m sink.Message, transcript bool) {
+	details := []string{}
+	if m.TLS {
+		details = append(details, "TLS")
+	}
+	if m.AuthUser != "" {
+		details = append(details, fmt.Sprintf("authenticated as %q", m.AuthUser))
+	}
+	fmt.Printf("-- Message #%d received from %s (%s) --\n", n, m.RemoteAddr, strings.Join(append(details, fmt.Sprintf("%d bytes of body", len(m.Body))), ", "))
+	fmt.Printf("  - Envelope From: %q\n", m.From)
+	fmt.Printf("  - Envelope To: %q\n", strings.Join(m.To, ", "))
+	if subject, ok := m.Headers["Subject"]; ok {
+		decoded, err := new(mime.WordDecoder).DecodeHeader(subject[0])
+		if err != nil {
+			decoded = subject[0]
+		}
+		fmt.Printf("  - Subject: %q\n", decoded)
+		if decoded != subject[0] {
+			fmt.Printf("  - Subject (encoded): %q\n", subject[0])
+		}
+	}
+	for _, h := range printedHeaders {
+		for _, v := range m.Headers[h] {
+			fmt.Printf("  - %s: %q\n", h, v)
+		}
+	}
+	if transcript {
+		fmt.Println("  - Transcript:")
+		for _, line := range m.Transcript {
+			fmt.Printf("      %s\n", line)
+		}
+	}
+	fmt.Println()
+}
+
+// exportMessages writes the messages received to a JSON file
+func exportMessages(path string, messages []sink.Message) error {
+	if messages == nil {
+		messages = []sink.Message{}
+	}
+	content, err := json.MarshalIndent(messages, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(redact.String(string(content))+"\n"), 0600)
+}
+
+// runServe runs the serve mode: a local SMTP server that records the messages
+// sent by the application until it is interrupted
+func runServe(args []string) {
+	var (
+		listen     string
+		hostname   string
+		certFile   string
+		keyFile    string
+		implicit   bool
+		user       string
+		pass       string
+		export     string
+		count      int
+		transcript bool
+	)
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.StringVar(&listen, "listen", "127.0.0.1:2525", "Address the SMTP server listens on")
+	fs.StringVar(&hostname, "hostname", "localhost", "Hostname announced by the SMTP server")
+	fs.StringVar(&certFile, "tls_cert", "", "TLS certificate file, enables STARTTLS")
+	fs.StringVar(&keyFile, "tls_key", "", "TLS private key file")
+	fs.BoolVar(&implicit, "implicit_tls", false, "Use implicit TLS instead of STARTTLS")
+	fs.StringVar(&user, "auth_user", "", "Require clients to authenticate with this user")
+	fs.StringVar(&pass, "auth_password", "", "Password of the user clients authenticate with")
+	fs.StringVar(&export, "export", "", "JSON file the messages received are written to when the server stops")
+	fs.IntVar(&count, "count", 0, "Stop after receiving this number of messages (0 to run until interrupted)")
+	fs.BoolVar(&transcript, "transcript", false, "Print the SMTP transcript of every message")
+	fs.Parse(args)
+	log.SetOutput(redact.NewWriter(os.Stderr))
+	redact.Register(pass)
+
+	cfg := sink.Config{Hostname: hostname, ImplicitTLS: implicit, User: user, Pass: pass}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			log.Fatalf("Found errors when loading the TLS certificate: %v", err)
+		}
+		cfg.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	s, err := sink.Listen(listen, cfg)
+	if err != nil {
+		log.Fatalf("Found errors when starting the SMTP server: %v", err)
+	}
+
+	done := make(chan struct{})
+	received := 0
+	s.OnMessage = func(m sink.Message) {
+		received++
+		printMessage(received, m, transcript)
+		if received == count {
+			close(done)
+		}
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go s.Serve()
+
+	fmt.Printf(`======================================
+SMTP SERVER
+======================================
+Listening on %s (TLS: %s, authentication: %t)
+Point your application to this server and send a mail. Press Ctrl+C to stop.
+
+`, s.Addr(), tlsMode(cfg), user != "")
+
+	select {
+	case <-done:
+		// Let the client finish the session
+		s.Close()
+		s.Wait()
+	case <-interrupt:
+		s.Close()
+	}
+	messages := s.Messages()
+	fmt.Printf("%d message(s) received\n", len(messages))
+	if export != "" {
+		if err := exportMessages(export, messages); err != nil {
+			log.Fatalf("Found errors when exporting the messages: %v", err)
+		}
+		fmt.Printf("Messages written to %q\n", export)
+	}
+}
+
+func tlsMode(cfg sink.Config) string {
+	switch {
+	case cfg.TLSConfig == nil:
+		return "disabled"
+	case cfg.ImplicitTLS:
+		return "implicit"
+	}
+	return "STARTTLS"
+}
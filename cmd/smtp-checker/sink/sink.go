@@ -0,0 +1,363 @@
+// Package sink provides a local SMTP server that records every message received,
+// for testing the mail sent by the applications
+package sink
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitnami-labs/healthcheck-tools/pkg/redact"
+)
+
+// maxMessageSize is the maximum size of the messages accepted, advertised with SIZE
+const maxMessageSize = 25 << 20
+
+// Config contains the settings of the SMTP server
+type Config struct {
+	// Hostname is announced in the greeting and the EHLO reply
+	Hostname string
+	// TLSConfig enables STARTTLS, or implicit TLS when ImplicitTLS is set
+	TLSConfig   *tls.Config
+	ImplicitTLS bool
+	// User and Pass require clients to authenticate (PLAIN or LOGIN) when set
+	User string
+	Pass string
+}
+
+// Message is a mail received by the server
+type Message struct {
+	Received   time.Time           `json:"received"`
+	RemoteAddr string              `json:"remote_addr"`
+	TLS        bool                `json:"tls"`
+	AuthUser   string              `json:"auth_user,omitempty"`
+	From       string              `json:"from"`
+	To         []string            `json:"to"`
+	Headers    map[string][]string `json:"headers"`
+	Body       string              `json:"body"`
+	Transcript []string            `json:"transcript"`
+}
+
+// Server is a SMTP server that accepts every message and records it
+type Server struct {
+	cfg Config
+	l   net.Listener
+	// OnMessage is called for every message received. Calls are serialized.
+	OnMessage func(Message)
+
+	sessions sync.WaitGroup
+	mu       sync.Mutex
+	messages []Message
+}
+
+// Listen creates a Server listening on addr
+func Listen(addr string, cfg Config) (*Server, error) {
+	if cfg.Hostname == "" {
+		cfg.Hostname = "localhost"
+	}
+	if cfg.ImplicitTLS && cfg.TLSConfig == nil {
+		return nil, fmt.Errorf("implicit TLS requires a certificate")
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{cfg: cfg, l: l}, nil
+}
+
+// Addr returns the address the server listens on
+func (s *Server) Addr() net.Addr {
+	return s.l.Addr()
+}
+
+// Serve accepts connections until the server is closed
+func (s *Server) Serve() error {
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return err
+		}
+		s.sessions.Add(1)
+		go func() {
+			defer s.sessions.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// Close stops accepting connections
+func (s *Server) Close() error {
+	return s.l.Close()
+}
+
+// Wait waits for the active connections to finish
+func (s *Server) Wait() {
+	s.sessions.Wait()
+}
+
+// Messages returns the messages received so far
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+func (s *Server) record(m Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, m)
+	if s.OnMessage != nil {
+		s.OnMessage(m)
+	}
+}
+
+// session contains the state of a SMTP connection
+type session struct {
+	s          *Server
+	conn       net.Conn
+	tp         *textproto.Conn
+	tls        bool
+	authUser   string
+	inMail     bool
+	from       string
+	to         []string
+	transcript []string
+}
+
+func (ss *session) reply(format string, args ...interface{}) {
+	line := fmt.Sprintf(format, args...)
+	ss.transcript = append(ss.transcript, "S: "+line)
+	ss.tp.PrintfLine("%s", line)
+}
+
+func (ss *session) read(mask bool) (string, error) {
+	line, err := ss.tp.ReadLine()
+	if err != nil {
+		return "", err
+	}
+	logged := line
+	if mask {
+		logged = redact.Mask
+	}
+	ss.transcript = append(ss.transcript, "C: "+logged)
+	return line, nil
+}
+
+func (s *Server) handle(conn net.Conn) {
+	ss := &session{s: s, conn: conn}
+	if s.cfg.ImplicitTLS {
+		ss.conn = tls.Server(conn, s.cfg.TLSConfig)
+		ss.tls = true
+	}
+	defer ss.conn.Close()
+	ss.tp = textproto.NewConn(ss.conn)
+	ss.reply("220 %s ESMTP smtp-checker", s.cfg.Hostname)
+	for {
+		ss.conn.SetDeadline(time.Now().Add(5 * time.Minute))
+		line, err := ss.tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg := line, ""
+		if i := strings.Index(line, " "); i >= 0 {
+			cmd, arg = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		cmd = strings.ToUpper(cmd)
+		if cmd == "AUTH" {
+			// Only the mechanism is recorded, the initial response contains the credentials
+			fields := strings.Fields(arg)
+			logged := "AUTH " + fields0(fields)
+			if len(fields) > 1 {
+				logged += " " + redact.Mask
+			}
+			ss.transcript = append(ss.transcript, "C: "+logged)
+		} else {
+			ss.transcript = append(ss.transcript, "C: "+line)
+		}
+		switch cmd {
+		case "EHLO", "HELO":
+			ss.reset()
+			if cmd == "HELO" {
+				ss.reply("250 %s", s.cfg.Hostname)
+				continue
+			}
+			exts := []string{s.cfg.Hostname, "PIPELINING", fmt.Sprintf("SIZE %d", maxMessageSize), "8BITMIME", "SMTPUTF8"}
+			if s.cfg.TLSConfig != nil && !ss.tls {
+				exts = append(exts, "STARTTLS")
+			}
+			if s.cfg.User != "" {
+				exts = append(exts, "AUTH PLAIN LOGIN")
+			}
+			for i, ext := range exts {
+				sep := "-"
+				if i == len(exts)-1 {
+					sep = " "
+				}
+				ss.reply("250%s%s", sep, ext)
+			}
+		case "STARTTLS":
+			if s.cfg.TLSConfig == nil || ss.tls {
+				ss.reply("502 5.5.1 STARTTLS not available")
+				continue
+			}
+			ss.reply("220 2.0.0 Ready to start TLS")
+			tlsConn := tls.Server(ss.conn, s.cfg.TLSConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			ss.conn, ss.tls = tlsConn, true
+			ss.tp = textproto.NewConn(tlsConn)
+			ss.reset()
+		case "AUTH":
+			ss.auth(arg)
+		case "MAIL":
+			if s.cfg.User != "" && ss.authUser == "" {
+				ss.reply("530 5.7.0 Authentication required")
+				continue
+			}
+			ss.inMail, ss.from = true, address(arg, "FROM:")
+			ss.reply("250 2.1.0 OK")
+		case "RCPT":
+			if !ss.inMail {
+				ss.reply("503 5.5.1 MAIL first")
+				continue
+			}
+			ss.to = append(ss.to, address(arg, "TO:"))
+			ss.reply("250 2.1.5 OK")
+		case "DATA":
+			if len(ss.to) == 0 {
+				ss.reply("503 5.5.1 RCPT first")
+				continue
+			}
+			ss.reply("354 End data with <CR><LF>.<CR><LF>")
+			data, err := ss.tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			ss.transcript = append(ss.transcript, fmt.Sprintf("C: <%d bytes>", len(data)))
+			ss.reply("250 2.0.0 OK: queued")
+			s.record(ss.message(data))
+			ss.reset()
+		case "RSET":
+			ss.reset()
+			ss.reply("250 2.0.0 OK")
+		case "NOOP":
+			ss.reply("250 2.0.0 OK")
+		case "QUIT":
+			ss.reply("221 2.0.0 Bye")
+			return
+		default:
+			ss.reply("502 5.5.2 Command not recognized")
+		}
+	}
+}
+
+// reset discards the current mail transaction
+func (ss *session) reset() {
+	ss.inMail, ss.from, ss.to = false, "", nil
+}
+
+// auth handles the PLAIN and LOGIN mechanisms
+func (ss *session) auth(arg string) {
+	cfg := ss.s.cfg
+	if cfg.User == "" {
+		ss.reply("503 5.5.1 Authentication not enabled")
+		return
+	}
+	fields := strings.Fields(arg)
+	var user, pass string
+	switch strings.ToUpper(fields0(fields)) {
+	case "PLAIN":
+		resp := ""
+		if len(fields) > 1 {
+			resp = fields[1]
+		} else {
+			ss.reply("334 ")
+			line, err := ss.read(true)
+			if err != nil {
+				return
+			}
+			resp = line
+		}
+		decoded, err := base64.StdEncoding.DecodeString(resp)
+		parts := strings.Split(string(decoded), "\x00")
+		if err != nil || len(parts) != 3 {
+			ss.reply("501 5.5.2 Malformed credentials")
+			return
+		}
+		user, pass = parts[1], parts[2]
+	case "LOGIN":
+		var values []string
+		for _, prompt := range []string{"Username:", "Password:"} {
+			ss.reply("334 %s", base64.StdEncoding.EncodeToString([]byte(prompt)))
+			line, err := ss.read(true)
+			if err != nil {
+				return
+			}
+			decoded, err := base64.StdEncoding.DecodeString(line)
+			if err != nil {
+				ss.reply("501 5.5.2 Malformed credentials")
+				return
+			}
+			values = append(values, string(decoded))
+		}
+		user, pass = values[0], values[1]
+	default:
+		ss.reply("504 5.5.4 Unrecognized authentication mechanism")
+		return
+	}
+	if user != cfg.User || pass != cfg.Pass {
+		ss.reply("535 5.7.8 Authentication credentials invalid")
+		return
+	}
+	ss.authUser = user
+	ss.reply("235 2.7.0 Authentication successful")
+}
+
+func (ss *session) message(data []byte) Message {
+	m := Message{
+		Received:   time.Now(),
+		RemoteAddr: ss.conn.RemoteAddr().String(),
+		TLS:        ss.tls,
+		AuthUser:   ss.authUser,
+		From:       ss.from,
+		To:         ss.to,
+		Transcript: append([]string(nil), ss.transcript...),
+	}
+	if msg, err := mail.ReadMessage(bytes.NewReader(data)); err == nil {
+		m.Headers = msg.Header
+		body, _ := ioutil.ReadAll(msg.Body)
+		m.Body = string(body)
+	} else {
+		m.Body = string(data)
+	}
+	return m
+}
+
+// address extracts the address from the MAIL FROM and RCPT TO arguments
+func address(arg, prefix string) string {
+	if len(arg) >= len(prefix) && strings.EqualFold(arg[:len(prefix)], prefix) {
+		arg = arg[len(prefix):]
+	}
+	arg = strings.TrimSpace(arg)
+	if i := strings.Index(arg, ">"); strings.HasPrefix(arg, "<") && i > 0 {
+		return arg[1:i]
+	}
+	return fields0(strings.Fields(arg))
+}
+
+// fields0 returns the first field, or an empty string if there are none
+func fields0(fields []string) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
@@ -0,0 +1,59 @@
+package sink
+
+import (
+	"net/smtp"
+	"strings"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	s, err := Listen("127.0.0.1:0", Config{User: "user", Pass: "s3cr3t"})
+	if err != nil {
+		t.Fatalf("Error starting server: %v", err)
+	}
+	defer s.Close()
+	go s.Serve()
+	addr := s.Addr().String()
+	msg := "From: Blog <blog@example.com>\r\nTo: admin@example.com\r\nSubject: =?UTF-8?B?SG9sYSwgbXVuZG8=?=\r\n\r\nHello\r\n"
+
+	t.Run("Check message is recorded", func(t *testing.T) {
+		auth := smtp.PlainAuth("", "user", "s3cr3t", "127.0.0.1")
+		if err := smtp.SendMail(addr, auth, "blog@example.com", []string{"admin@example.com"}, []byte(msg)); err != nil {
+			t.Fatalf("Error sending mail: %v", err)
+		}
+		messages := s.Messages()
+		if len(messages) != 1 {
+			t.Fatalf("Incorrect number of messages, expected: 1, got: %d", len(messages))
+		}
+		m := messages[0]
+		if m.From != "blog@example.com" || len(m.To) != 1 || m.To[0] != "admin@example.com" {
+			t.Errorf("Incorrect envelope, expected: blog@example.com -> admin@example.com, got: %s -> %v", m.From, m.To)
+		}
+		if m.AuthUser != "user" {
+			t.Errorf("Incorrect authenticated user, expected: user, got: %s", m.AuthUser)
+		}
+		if subject := m.Headers["Subject"]; len(subject) != 1 || subject[0] != "=?UTF-8?B?SG9sYSwgbXVuZG8=?=" {
+			t.Errorf("Incorrect subject, got: %v", subject)
+		}
+		if strings.TrimSpace(m.Body) != "Hello" {
+			t.Errorf("Incorrect body, expected: Hello, got: %q", m.Body)
+		}
+		transcript := strings.Join(m.Transcript, "\n")
+		if !strings.Contains(transcript, "C: AUTH PLAIN xxxxxx") || strings.Contains(transcript, "s3cr3t") {
+			t.Errorf("Credentials not masked in transcript: %s", transcript)
+		}
+	})
+	t.Run("Check invalid credentials", func(t *testing.T) {
+		auth := smtp.PlainAuth("", "user", "wrong", "127.0.0.1")
+		err := smtp.SendMail(addr, auth, "blog@example.com", []string{"admin@example.com"}, []byte(msg))
+		if err == nil || !strings.Contains(err.Error(), "535") {
+			t.Errorf("Incorrect error, expected: 535, got: %v", err)
+		}
+	})
+	t.Run("Check authentication is required", func(t *testing.T) {
+		err := smtp.SendMail(addr, nil, "blog@example.com", []string{"admin@example.com"}, []byte(msg))
+		if err == nil || !strings.Contains(err.Error(), "530") {
+			t.Errorf("Incorrect error, expected: 530, got: %v", err)
+		}
+	})
+}
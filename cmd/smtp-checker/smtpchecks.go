@@ -1,62 +1,209 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"math"
 	"net"
-	"net/smtp"
+	"net/mail"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
-	"github.com/andybalholm/crlf"
-	"github.com/beevik/ntp"
 	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps/container"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps/descriptor"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps/drupal"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps/ghost"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps/joomla"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps/magento"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps/mattermost"
 	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps/redmine"
 	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps/wordpress"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/diagnosis"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/mailbox"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/message"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/timesync"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/discovery"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/timeout"
 	"github.com/juju/errors"
 )
 
 const (
-	timeout        = 10 * time.Second
-	maxClockOffset = 1 * time.Second
+	defaultTimeout        = 10 * time.Second
+	defaultMaxClockOffset = 1 * time.Second
+	defaultMaxNTPRTT      = 1 * time.Second
 )
 
+// smtpExtensions are the EHLO extensions reported by the STARTTLS check
+var smtpExtensions = []string{"STARTTLS", "AUTH", "SIZE", "8BITMIME", "PIPELINING", "SMTPUTF8", "ENHANCEDSTATUSCODES", "CHUNKING", "DSN"}
+
+// tlsRootCAs are the certificate authorities trusted when connecting to the SMTP
+// server. The system ones are used when nil.
+var tlsRootCAs *x509.CertPool
+
+func tlsConfig(hostname string) *tls.Config {
+	return &tls.Config{ServerName: hostname, RootCAs: tlsRootCAs}
+}
+
 func absDuration(d time.Duration) time.Duration {
 	return time.Duration(math.Abs(float64(d)))
 }
 
+// appParser contains the config parser of an application and the
+// configuration files it reads, relative to the installation directory
+type appParser struct {
+	parse       func(context.Context, string) (apps.ApplicationConfig, error)
+	configFiles []string
+}
+
+// parsers contains the config parser of each supported application
+var parsers = map[string]appParser{
+	"drupal":     {drupal.QueryConfig, []string{drupal.ConfigFilePath}},
+	"ghost":      {ghost.ParseConfig, []string{ghost.ConfigFilePath}},
+	"joomla":     {joomla.ParseConfig, []string{joomla.ConfigFilePath}},
+	"magento":    {magento.QueryConfig, []string{magento.ConfigFilePath}},
+	"mattermost": {mattermost.QueryConfig, []string{mattermost.ConfigFilePath}},
+	"redmine":    {redmine.ParseConfig, []string{redmine.ConfigFilePath}},
+	"wordpress":  {wordpress.QueryConfig, []string{wordpress.ConfigFilePath}},
+}
+
+// descriptors contains the declarative descriptors of the applications, by name
+var descriptors = map[string]*descriptor.Descriptor{}
+
+// LoadDescriptors registers the built-in application descriptors and the ones
+// found in dir, if not empty, which replace the built-in ones with the same name
+func LoadDescriptors(dir string) error {
+	for _, d := range descriptor.Builtin() {
+		descriptors[d.Name] = d
+	}
+	if dir == "" {
+		return nil
+	}
+	found, err := descriptor.Load(dir)
+	if err != nil {
+		return err
+	}
+	for _, d := range found {
+		descriptors[d.Name] = d
+	}
+	return nil
+}
+
+// descriptorFor returns the descriptor used to obtain the configuration of the
+// app. The descriptors provided by the user replace the native parsers, while the
+// built-in ones are only used by the apps without native parser.
+func descriptorFor(app string) (*descriptor.Descriptor, bool) {
+	d, ok := descriptors[app]
+	if !ok {
+		return nil, false
+	}
+	if _, native := parsers[app]; native && d.Source == descriptor.BuiltinSource {
+		return nil, false
+	}
+	return d, true
+}
+
+// configFiles returns the configuration files of the app, relative to the
+// installation directory
+func configFiles(app string) []string {
+	if d, ok := descriptorFor(app); ok {
+		return []string{d.ConfigFile}
+	}
+	return parsers[app].configFiles
+}
+
+func supportedApps() []string {
+	var names []string
+	for k := range parsers {
+		names = append(names, k)
+	}
+	for k := range descriptors {
+		if _, ok := parsers[k]; !ok {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 // ObtainConfigData obtains the configuration data from
 // the app
-func ObtainConfigData(installDir string, app string) (appConfig apps.ApplicationConfig, err error) {
-	parsers := map[string]func(string) (apps.ApplicationConfig, error){
-		"redmine":   redmine.ParseConfig,
-		"wordpress": wordpress.QueryConfig,
+func ObtainConfigData(ctx context.Context, installDir string, app string) (appConfig apps.ApplicationConfig, err error) {
+	if d, ok := descriptorFor(app); ok {
+		fmt.Printf("Using descriptor: %s\n", d.Source)
+		return d.Obtain(ctx, installDir)
 	}
-	parse, ok := parsers[app]
+	parser, ok := parsers[app]
 	if !ok {
-		var names []string
-		for k := range parsers {
-			names = append(names, k)
+		return nil, errors.Errorf("bad app name %q; currently supported: %s", app, strings.Join(supportedApps(), ", "))
+	}
+	return parser.parse(ctx, installDir)
+}
+
+// ObtainContainerConfigData obtains the configuration data of the app from the
+// environment variables of its Bitnami container
+func ObtainContainerConfigData(app string, env map[string]string) (apps.ApplicationConfig, error) {
+	if _, ok := parsers[app]; !ok {
+		return nil, errors.Errorf("bad app name %q; currently supported: %s", app, strings.Join(supportedApps(), ", "))
+	}
+	return container.ParseEnv(app, env)
+}
+
+// DetectApplication inspects the installation directory and returns
+// the supported application installed on it
+func DetectApplication(installDir string) (string, error) {
+	stack, err := discovery.Inspect(installDir)
+	if err != nil {
+		return "", errors.Errorf("error inspecting installation directory: %v", err)
+	}
+	var found []string
+	for _, app := range stack.Apps {
+		if _, ok := parsers[app.Name]; ok && app.ConfigFile != "" {
+			found = append(found, app.Name)
+		}
+	}
+	// The apps without htdocs folder (e.g. mattermost) are detected by their config file
+	for name, parser := range parsers {
+		if _, ok := stack.App(name); ok {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(installDir, parser.configFiles[0])); err == nil {
+			found = append(found, name)
 		}
-		return nil, errors.Errorf("bad app name %q; currently supported: %s", app, strings.Join(names, ", "))
 	}
-	return parse(installDir)
+	// The apps without native parser are detected by the config file of their descriptor
+	for name, d := range descriptors {
+		if _, ok := parsers[name]; ok {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(installDir, d.ConfigFile)); err == nil {
+			found = append(found, name)
+		}
+	}
+	sort.Strings(found)
+	switch len(found) {
+	case 0:
+		return "", errors.Errorf("no supported application found in %q; currently supported: %s", installDir, strings.Join(supportedApps(), ", "))
+	case 1:
+		return found[0], nil
+	default:
+		return "", errors.Errorf("found several supported applications in %q (%s); use '-application' flag to choose one", installDir, strings.Join(found, ", "))
+	}
 }
 
 // RunConnectiviyChecks performs checks on the connectivity
 // with SMTP server
-func RunConnectivityChecks(hostname string, port int) error {
+func RunConnectivityChecks(ctx context.Context, hostname string, port int) error {
 	smtpServer := fmt.Sprintf("%s:%d", hostname, port)
-	tcpAddr, err := net.ResolveTCPAddr("tcp", smtpServer)
+	conn, err := timeout.Dial(ctx, "tcp", smtpServer)
 	if err != nil {
-		return err
-	}
-	conn, err := net.DialTCP("tcp", nil, tcpAddr)
-	if err != nil {
-		return err
+		return timeout.Wrap(ctx, fmt.Sprintf("connecting to %s", smtpServer), err)
 	}
 	conn.Close()
 	fmt.Println("Succesful connectivity!")
@@ -64,53 +211,308 @@ func RunConnectivityChecks(hostname string, port int) error {
 }
 
 // RunTLSConnectiviyChecks performs checks on the connectivity with SMTP server
-func RunTLSConnectivityChecks(hostname string, port int) error {
+func RunTLSConnectivityChecks(ctx context.Context, hostname string, port int) error {
 	smtpServer := fmt.Sprintf("%s:%d", hostname, port)
-	conn, err := tls.Dial("tcp", smtpServer, nil)
+	conn, err := timeout.DialTLS(ctx, "tcp", smtpServer, tlsConfig(hostname))
 	if err != nil {
-		return err
+		return timeout.Wrap(ctx, fmt.Sprintf("establishing a TLS connection with %s", smtpServer), err)
 	}
 	conn.Close()
 	fmt.Println("Succesful TLS connectivity!")
 	return nil
 }
 
-// RunNTPChecks performs checks on the Time offset respect a NTP pool
-func RunNTPChecks() error {
-	rp, err := ntp.QueryWithOptions("pool.ntp.org", ntp.QueryOptions{Timeout: timeout})
-	if err != nil {
-		return err
-	}
-	if absDuration(rp.ClockOffset) > maxClockOffset {
-		return errors.Errorf("incorrect time offset (>%s, synchronize your server clock via ntp", maxClockOffset)
-	}
+// RunNTPChecks performs checks on the time synchronization of the host. The
+// local synchronization daemons are reported and, unless localOnly is set, the NTP
+// servers are queried in parallel and the median offset respect them is checked.
+// Servers replying with a RTT above maxRTT (unlimited if 0) are ignored.
+func RunNTPChecks(ctx context.Context, servers []string, maxClockOffset, maxRTT time.Duration, localOnly bool) error {
 	h, err := os.Hostname()
 	if err != nil {
 		h = "localhost"
 	}
+	statuses := timesync.Local("/", timesync.DefaultMaxStateAge)
+	fmt.Println("Time synchronization daemons:")
+	if len(statuses) == 0 {
+		fmt.Println("  - none found (chronyd, ntpd or systemd-timesyncd)")
+	}
+	synchronized := false
+	for _, s := range statuses {
+		fmt.Printf("  - %s\n", s)
+		synchronized = synchronized || s.Synchronized
+	}
+	if localOnly {
+		if !synchronized {
+			return errors.Errorf("the clock of %s is not being synchronized, enable chronyd, ntpd or systemd-timesyncd", h)
+		}
+		fmt.Printf("Time synchronisation of host %s enabled!\n", h)
+		return nil
+	}
+
+	samples := timesync.QueryAll(ctx, servers)
+	fmt.Println("NTP servers:")
+	for _, s := range samples {
+		if s.Err != nil {
+			fmt.Printf("  - %s: %v\n", s.Server, s.Err)
+			continue
+		}
+		ignored := ""
+		if maxRTT > 0 && s.RTT > maxRTT {
+			ignored = fmt.Sprintf(" (ignored, RTT above %s)", maxRTT)
+		}
+		fmt.Printf("  - %s: offset %s, stratum %d, RTT %s%s\n", s.Server, s.Offset.Round(time.Microsecond), s.Stratum, s.RTT.Round(time.Microsecond), ignored)
+	}
+	offset, n := timesync.MedianOffset(samples, maxRTT)
+	if n == 0 {
+		if len(samples) == 1 && samples[0].Err != nil {
+			return samples[0].Err
+		}
+		return errors.Errorf("no valid reply from the NTP servers %s", strings.Join(servers, ", "))
+	}
+	fmt.Printf("Median offset: %s (%d of %d servers)\n", offset.Round(time.Microsecond), n, len(samples))
+	if absDuration(offset) > maxClockOffset {
+		return errors.Errorf("incorrect time offset (%s > %s), synchronize your server clock via ntp", offset.Round(time.Millisecond), maxClockOffset)
+	}
+	if !synchronized {
+		fmt.Printf("Warning: the clock of %s is not being synchronized and will drift over time, enable chronyd, ntpd or systemd-timesyncd\n", h)
+	}
 	fmt.Printf("Time synchronisation of host %s within reasonable bounds!\n", h)
 	return nil
 }
 
-// RunSendMailChecks performs checks on sending mails via SMTP
-func RunSendMailChecks(settings *apps.SMTPSettings, recipient string) error {
-	auth := smtp.PlainAuth(
-		"",
-		settings.User,
-		settings.Pass,
-		settings.Host,
-	)
-	sender := settings.User
-	smtpServer := fmt.Sprintf("%s:%d", settings.Host, settings.Port)
-	var msg bytes.Buffer
-	w := crlf.NewWriter(&msg)
-	fmt.Fprintf(w, "To: %s\n", recipient)
-	fmt.Fprintf(w, `Subject: Testing Mail
-
-This is a testing email body.`)
-	if err := smtp.SendMail(smtpServer, auth, sender, []string{recipient}, msg.Bytes()); err != nil {
+// stageError reports the stage of the SMTP session in which err happened
+func stageError(ctx context.Context, stage string, err error) error {
+	err = timeout.Wrap(ctx, stage, err)
+	if _, ok := err.(*timeout.Error); ok || err == nil {
 		return err
 	}
+	return errors.Annotate(err, stage)
+}
+
+// Transports used to send the test mail
+const (
+	transportTLS      = "implicit TLS"
+	transportSTARTTLS = "STARTTLS"
+	transportPlain    = "plain text"
+)
+
+// dialSMTP connects to the SMTP server, using TLS from the start when implicitTLS
+// is set, and sends EHLO once the greeting is received. The dialogue is recorded
+// in tr, if not nil.
+func dialSMTP(ctx context.Context, addr string, implicitTLS bool, tr *transcript) (*smtpClient, error) {
+	host, _, _ := net.SplitHostPort(addr)
+	var conn net.Conn
+	if implicitTLS {
+		tlsConn, err := timeout.DialTLS(ctx, "tcp", addr, tlsConfig(host))
+		if err != nil {
+			tr.note("TLS connection with %s failed: %v", addr, err)
+			return nil, stageError(ctx, fmt.Sprintf("establishing a TLS connection with %s", addr), err)
+		}
+		tr.note("connected to %s (%s)", addr, tlsVersionName(tlsConn.ConnectionState().Version))
+		conn = tlsConn
+	} else {
+		plainConn, err := timeout.Dial(ctx, "tcp", addr)
+		if err != nil {
+			tr.note("connection to %s failed: %v", addr, err)
+			return nil, stageError(ctx, fmt.Sprintf("connecting to %s", addr), err)
+		}
+		tr.note("connected to %s", addr)
+		conn = plainConn
+	}
+	c, err := newSMTPClient(conn, host, tr)
+	if err != nil {
+		conn.Close()
+		return nil, stageError(ctx, "waiting for the server greeting", err)
+	}
+	if err := c.Hello("localhost"); err != nil {
+		c.Close()
+		return nil, stageError(ctx, "sending EHLO", err)
+	}
+	return c, nil
+}
+
+// printExtensions prints the known extensions advertised by the server
+func printExtensions(c *smtpClient) {
+	for _, ext := range smtpExtensions {
+		if ok, param := c.Extension(ext); ok {
+			fmt.Printf("  - %s\n", strings.TrimSpace(ext+" "+param))
+		}
+	}
+}
+
+// RunSTARTTLSChecks connects to the SMTP server, reports the extensions advertised
+// in the EHLO reply and upgrades the connection via STARTTLS
+func RunSTARTTLSChecks(ctx context.Context, hostname string, port int) error {
+	smtpServer := fmt.Sprintf("%s:%d", hostname, port)
+	c, err := dialSMTP(ctx, smtpServer, false, nil)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	fmt.Printf("Extensions advertised by %s:\n", smtpServer)
+	printExtensions(c)
+	if ok, _ := c.Extension("STARTTLS"); !ok {
+		return errors.Errorf("%s does not offer STARTTLS", smtpServer)
+	}
+	if err := c.StartTLS(tlsConfig(hostname)); err != nil {
+		return stageError(ctx, "negotiating STARTTLS", err)
+	}
+	state, _ := c.TLSConnectionState()
+	fmt.Printf("Extensions advertised after STARTTLS (%s):\n", tlsVersionName(state.Version))
+	printExtensions(c)
+	fmt.Println("Succesful STARTTLS negotiation!")
+	return timeout.Wrap(ctx, "sending QUIT", c.Quit())
+}
+
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case 0x0304: // tls.VersionTLS13, not available before Go 1.12
+		return "TLS 1.3"
+	}
+	return fmt.Sprintf("TLS 0x%04x", version)
+}
+
+// sendMail connects to the SMTP server and sends the message, following the same
+// steps as smtp.SendMail but honoring the context deadline in every phase. The
+// transport is chosen according to the port and the encryption mode, and it is
+// returned even when sending the message fails. The dialogue is recorded in tr, if
+// not nil.
+func sendMail(ctx context.Context, settings *apps.SMTPSettings, from string, to []string, msg []byte, tr *transcript) (string, error) {
+	addr := fmt.Sprintf("%s:%d", settings.Host, settings.Port)
+	transport := transportPlain
+	if settings.ImplicitTLS() {
+		transport = transportTLS
+	}
+	c, err := dialSMTP(ctx, addr, transport == transportTLS, tr)
+	if err != nil {
+		return transport, err
+	}
+	defer c.Close()
+	if transport == transportPlain && settings.Encryption != apps.EncryptionNone {
+		ok, _ := c.Extension("STARTTLS")
+		if !ok && settings.Encryption == apps.EncryptionSTARTTLS {
+			return transport, errors.Errorf("%s does not offer STARTTLS", addr)
+		}
+		if ok {
+			transport = transportSTARTTLS
+			if err := c.StartTLS(tlsConfig(settings.Host)); err != nil {
+				return transport, stageError(ctx, "negotiating STARTTLS", err)
+			}
+		}
+	}
+	if settings.Auth != apps.AuthNone {
+		ok, mechanisms := c.Extension("AUTH")
+		if !ok {
+			return transport, errors.New("smtp: server doesn't support AUTH")
+		}
+		mechanism, err := chooseAuth(settings, mechanisms)
+		if err != nil {
+			return transport, err
+		}
+		if err := c.Auth(newAuth(settings, mechanism)); err != nil {
+			return transport, stageError(ctx, "authenticating", err)
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return transport, stageError(ctx, "sending MAIL FROM", err)
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return transport, stageError(ctx, "sending RCPT TO", err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return transport, stageError(ctx, "sending DATA", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return transport, stageError(ctx, "sending the message", err)
+	}
+	if err := w.Close(); err != nil {
+		return transport, stageError(ctx, "sending the message", err)
+	}
+	return transport, stageError(ctx, "sending QUIT", c.Quit())
+}
+
+// testMessage builds the testing mail from tmpl, which provides the HTML
+// alternative, the attachments and the custom headers, if not nil
+func testMessage(settings *apps.SMTPSettings, tmpl *message.Message, subject string, recipients []string) ([]byte, error) {
+	m := message.Message{}
+	if tmpl != nil {
+		m = *tmpl
+	}
+	m.From = mail.Address{Name: settings.FromName, Address: settings.Sender()}
+	m.To = recipients
+	m.Subject = subject
+	if m.Text == "" {
+		m.Text = "This is a testing email body."
+	}
+	return m.Bytes()
+}
+
+// RunSendMailChecks performs checks on sending mails via SMTP, built from tmpl if
+// not nil, recording the dialogue with the server in tr, if not nil
+func RunSendMailChecks(ctx context.Context, settings *apps.SMTPSettings, tmpl *message.Message, tr *transcript, recipients ...string) error {
+	msg, err := testMessage(settings, tmpl, "Testing Mail", recipients)
+	if err != nil {
+		return errors.Annotate(err, "building the testing mail")
+	}
+	transport, err := sendMail(ctx, settings, settings.Sender(), recipients, msg, tr)
+	fmt.Printf("Transport: %s\n", transport)
+	if err != nil {
+		return diagnosis.Diagnose(err, settings.Host)
+	}
 	fmt.Println("Mail successfully sent via SMTP!")
 	return nil
 }
+
+// roundTripPollInterval is the time between searches in the mailbox
+var roundTripPollInterval = 5 * time.Second
+
+// RunRoundTripChecks sends a mail with a unique token and waits until it is
+// delivered to the mailbox, reporting the delivery latency. The dialogue with the
+// SMTP server is recorded in tr, if not nil.
+func RunRoundTripChecks(ctx context.Context, settings *apps.SMTPSettings, mb *mailbox.Mailbox, tmpl *message.Message, tr *transcript, recipients ...string) error {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return err
+	}
+	token := fmt.Sprintf("smtp-checker-%x", random)
+	msg, err := testMessage(settings, tmpl, "Testing Mail "+token, recipients)
+	if err != nil {
+		return errors.Annotate(err, "building the testing mail")
+	}
+	start := time.Now()
+	if _, err := sendMail(ctx, settings, settings.Sender(), recipients, msg, tr); err != nil {
+		return diagnosis.Diagnose(err, settings.Host)
+	}
+	fmt.Printf("Mail with token %q sent, waiting for it in %s\n", token, mb)
+	for {
+		folder, spam, err := mb.Find(ctx, token)
+		if err != nil {
+			if _, ok := err.(*timeout.Error); ok {
+				return errors.Errorf("mail not delivered to %s after %s", mb, time.Since(start).Round(time.Second))
+			}
+			return errors.Annotatef(err, "searching the mail in %s", mb)
+		}
+		latency := time.Since(start).Round(time.Millisecond)
+		if spam {
+			return errors.Errorf("mail delivered to the spam folder %q after %s", folder, latency)
+		}
+		if folder != "" {
+			fmt.Printf("Mail delivered to %q after %s!\n", folder, latency)
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Errorf("mail not delivered to %s after %s", mb, time.Since(start).Round(time.Second))
+		case <-time.After(roundTripPollInterval):
+		}
+	}
+}
@@ -1,15 +1,34 @@
 package main
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
 	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps"
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/timesync"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/timeout"
+	"math/big"
+	"net"
+	"net/textproto"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestRunTLSConnectivityChecks(t *testing.T) {
 	t.Run("Check connectivity with SMTP server via TLS", func(t *testing.T) {
-		err := RunTLSConnectivityChecks("smtp.gmail.com", 465)
+		err := RunTLSConnectivityChecks(context.Background(), "smtp.gmail.com", 465)
 		if err != nil {
 			t.Errorf("error connecting to smtp server via tls: %v", err)
 		}
@@ -18,7 +37,7 @@ func TestRunTLSConnectivityChecks(t *testing.T) {
 
 func TestRunNTPChecks(t *testing.T) {
 	t.Run("Check time offset via NTP", func(t *testing.T) {
-		err := RunNTPChecks()
+		err := RunNTPChecks(context.Background(), timesync.DefaultServers, defaultMaxClockOffset, defaultMaxNTPRTT, false)
 		if err != nil {
 			t.Errorf("error checking time offset via NTP: %v", err)
 		}
@@ -34,9 +53,349 @@ func TestRunSendMailChecks(t *testing.T) {
 			User: os.Getenv("SMTP_USER"),
 			Pass: os.Getenv("SMTP_PASS"),
 		}
-		err := RunSendMailChecks(&smtp, "test@example.com")
+		err := RunSendMailChecks(context.Background(), &smtp, nil, nil, "test@example.com")
 		if err != nil {
 			t.Errorf("error checking mail delivery via SMTP: %v", err)
 		}
 	})
 }
+
+func TestRunSendMailChecksTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error creating listener: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(time.Second)
+		}
+	}()
+	t.Run("Check timeout waiting for the SMTP greeting", func(t *testing.T) {
+		addr := l.Addr().(*net.TCPAddr)
+		smtp := apps.SMTPSettings{Host: "127.0.0.1", Port: addr.Port, User: "user", Pass: "pass"}
+		ctx, cancel := timeout.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		err := RunSendMailChecks(ctx, &smtp, nil, nil, "test@example.com")
+		if err == nil || err.Error() != "timed out after 100ms while waiting for the server greeting" {
+			t.Errorf("unexpected error sending mail to a silent server: %v", err)
+		}
+	})
+}
+
+// testCertificate creates a self-signed certificate for 127.0.0.1
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("error parsing certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+// fakeServer is a minimal SMTP server for testing the checks without network access
+type fakeServer struct {
+	l          net.Listener
+	extensions []string
+	// tlsConfig enables STARTTLS when not nil, or implicit TLS when implicitTLS is set
+	tlsConfig   *tls.Config
+	implicitTLS bool
+	mu          sync.Mutex
+	commands    []string
+}
+
+func newFakeServer(t *testing.T, tlsConfig *tls.Config, implicitTLS bool, extensions ...string) *fakeServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error creating listener: %v", err)
+	}
+	s := &fakeServer{l: l, extensions: extensions, tlsConfig: tlsConfig, implicitTLS: implicitTLS}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) port() int {
+	return s.l.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeServer) Close() {
+	s.l.Close()
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	secure := false
+	if s.implicitTLS {
+		conn = tls.Server(conn, s.tlsConfig)
+		secure = true
+	}
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, line)
+		s.mu.Unlock()
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO":
+			exts := append([]string{"fake"}, s.extensions...)
+			if s.tlsConfig != nil && !secure {
+				exts = append(exts, "STARTTLS")
+			}
+			for i, ext := range exts {
+				sep := "-"
+				if i == len(exts)-1 {
+					sep = " "
+				}
+				tp.PrintfLine("250%s%s", sep, ext)
+			}
+		case "STARTTLS":
+			tp.PrintfLine("220 2.0.0 Ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			tp = textproto.NewConn(conn)
+			secure = true
+		case "AUTH":
+			s.authenticate(tp, line)
+		case "DATA":
+			tp.PrintfLine("354 Go ahead")
+			if _, err := tp.ReadDotBytes(); err != nil {
+				return
+			}
+			tp.PrintfLine("250 2.0.0 OK")
+		case "QUIT":
+			tp.PrintfLine("221 2.0.0 Bye")
+			return
+		default:
+			tp.PrintfLine("250 2.0.0 OK")
+		}
+	}
+}
+
+// authenticate accepts the credentials "user" and "pass", or the token "token"
+func (s *fakeServer) authenticate(tp *textproto.Conn, line string) {
+	fields := strings.Fields(line)
+	ok := false
+	switch strings.ToUpper(fields[1]) {
+	case "PLAIN":
+		resp, _ := base64.StdEncoding.DecodeString(fields[2])
+		ok = string(resp) == "\x00user\x00pass"
+	case "LOGIN":
+		tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte("Username:")))
+		user, _ := tp.ReadLine()
+		tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte("Password:")))
+		pass, _ := tp.ReadLine()
+		ok = user == base64.StdEncoding.EncodeToString([]byte("user")) && pass == base64.StdEncoding.EncodeToString([]byte("pass"))
+	case "CRAM-MD5":
+		challenge := "<1.1@fake>"
+		tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(challenge)))
+		line, _ := tp.ReadLine()
+		resp, _ := base64.StdEncoding.DecodeString(line)
+		d := hmac.New(md5.New, []byte("pass"))
+		d.Write([]byte(challenge))
+		ok = string(resp) == fmt.Sprintf("user %x", d.Sum(nil))
+	case "XOAUTH2":
+		resp, _ := base64.StdEncoding.DecodeString(fields[2])
+		ok = string(resp) == "user=user\x01auth=Bearer token\x01\x01"
+		if !ok {
+			tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(`{"status":"401"}`)))
+			tp.ReadLine()
+		}
+	}
+	if ok {
+		tp.PrintfLine("235 2.7.0 Authentication successful")
+	} else {
+		tp.PrintfLine("535 5.7.8 Authentication credentials invalid")
+	}
+}
+
+func TestRunSTARTTLSChecks(t *testing.T) {
+	cert, pool := testCertificate(t)
+	tlsRootCAs = pool
+	defer func() { tlsRootCAs = nil }()
+	t.Run("Check STARTTLS negotiation", func(t *testing.T) {
+		s := newFakeServer(t, &tls.Config{Certificates: []tls.Certificate{cert}}, false, "AUTH PLAIN LOGIN", "8BITMIME")
+		defer s.Close()
+		if err := RunSTARTTLSChecks(context.Background(), "127.0.0.1", s.port()); err != nil {
+			t.Errorf("error negotiating STARTTLS: %v", err)
+		}
+	})
+	t.Run("Check server without STARTTLS", func(t *testing.T) {
+		s := newFakeServer(t, nil, false, "AUTH PLAIN LOGIN")
+		defer s.Close()
+		err := RunSTARTTLSChecks(context.Background(), "127.0.0.1", s.port())
+		if err == nil || !strings.Contains(err.Error(), "does not offer STARTTLS") {
+			t.Errorf("Incorrect error, expected: does not offer STARTTLS, got: %v", err)
+		}
+	})
+	t.Run("Check failed TLS upgrade", func(t *testing.T) {
+		tlsRootCAs = x509.NewCertPool()
+		s := newFakeServer(t, &tls.Config{Certificates: []tls.Certificate{cert}}, false)
+		defer s.Close()
+		err := RunSTARTTLSChecks(context.Background(), "127.0.0.1", s.port())
+		if err == nil || !strings.HasPrefix(err.Error(), "negotiating STARTTLS: ") {
+			t.Errorf("Incorrect error, expected: negotiating STARTTLS: ..., got: %v", err)
+		}
+	})
+}
+
+func TestSendMailTransport(t *testing.T) {
+	cert, pool := testCertificate(t)
+	tlsRootCAs = pool
+	defer func() { tlsRootCAs = nil }()
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+	testData := []struct {
+		name        string
+		tlsConfig   *tls.Config
+		implicitTLS bool
+		encryption  string
+		transport   string
+		err         string
+	}{
+		{"implicit TLS", tlsConfig, true, apps.EncryptionTLS, transportTLS, ""},
+		{"STARTTLS when offered", tlsConfig, false, apps.EncryptionAuto, transportSTARTTLS, ""},
+		{"plain text when STARTTLS is not offered", nil, false, apps.EncryptionAuto, transportPlain, ""},
+		{"plain text when encryption is disabled", tlsConfig, false, apps.EncryptionNone, transportPlain, ""},
+		{"required STARTTLS not offered", nil, false, apps.EncryptionSTARTTLS, transportPlain, "does not offer STARTTLS"},
+	}
+	for _, tt := range testData {
+		t.Run("Check "+tt.name, func(t *testing.T) {
+			s := newFakeServer(t, tt.tlsConfig, tt.implicitTLS, "AUTH PLAIN")
+			defer s.Close()
+			settings := &apps.SMTPSettings{Host: "127.0.0.1", Port: s.port(), User: "user", Pass: "pass", Encryption: tt.encryption, Auth: apps.AuthPlain}
+			transport, err := sendMail(context.Background(), settings, "user@example.com", []string{"test@example.com"}, []byte("Subject: Test\r\n\r\nTest\r\n"), nil)
+			if transport != tt.transport {
+				t.Errorf("Incorrect transport, expected: %s, got: %s", tt.transport, transport)
+			}
+			if tt.err == "" && err != nil {
+				t.Errorf("error sending mail: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("Incorrect error, expected: %s, got: %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestSendMailAuth(t *testing.T) {
+	testData := []struct {
+		auth  string
+		pass  string
+		token string
+		err   string
+	}{
+		{apps.AuthPlain, "pass", "", ""},
+		{apps.AuthLogin, "pass", "", ""},
+		{apps.AuthLogin, "wrong", "", "authenticating: 535"},
+		{apps.AuthCRAMMD5, "pass", "", ""},
+		{apps.AuthXOAUTH2, "", "token", ""},
+		{apps.AuthXOAUTH2, "", "expired", `XOAUTH2 token rejected: {"status":"401"}`},
+	}
+	s := newFakeServer(t, nil, false, "AUTH PLAIN LOGIN CRAM-MD5 XOAUTH2")
+	defer s.Close()
+	for _, tt := range testData {
+		t.Run("Check "+tt.auth+" authentication", func(t *testing.T) {
+			settings := &apps.SMTPSettings{Host: "127.0.0.1", Port: s.port(), User: "user", Pass: tt.pass, Auth: tt.auth, OAuth2Token: tt.token}
+			_, err := sendMail(context.Background(), settings, "user@example.com", []string{"test@example.com"}, []byte("Subject: Test\r\n\r\nTest\r\n"), nil)
+			if tt.err == "" && err != nil {
+				t.Errorf("error sending mail: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("Incorrect error, expected: %s, got: %v", tt.err, err)
+			}
+		})
+	}
+	t.Run("Check negotiated authentication", func(t *testing.T) {
+		s := newFakeServer(t, nil, false, "AUTH LOGIN XOAUTH2")
+		defer s.Close()
+		settings := &apps.SMTPSettings{Host: "127.0.0.1", Port: s.port(), User: "user", Pass: "pass"}
+		if _, err := sendMail(context.Background(), settings, "user@example.com", []string{"test@example.com"}, []byte("Subject: Test\r\n\r\nTest\r\n"), nil); err != nil {
+			t.Errorf("error sending mail: %v", err)
+		}
+	})
+	t.Run("Check no negotiable mechanism advertised", func(t *testing.T) {
+		s := newFakeServer(t, nil, false, "AUTH XOAUTH2")
+		defer s.Close()
+		settings := &apps.SMTPSettings{Host: "127.0.0.1", Port: s.port(), User: "user", Pass: "pass"}
+		_, err := sendMail(context.Background(), settings, "user@example.com", []string{"test@example.com"}, []byte("Subject: Test\r\n\r\nTest\r\n"), nil)
+		if err == nil || !strings.Contains(err.Error(), "does not advertise any of the PLAIN, LOGIN, CRAM-MD5 authentication mechanisms (advertised: XOAUTH2)") {
+			t.Errorf("Incorrect error, expected: does not advertise any of the PLAIN, LOGIN, CRAM-MD5 authentication mechanisms, got: %v", err)
+		}
+	})
+	t.Run("Check mechanism not advertised", func(t *testing.T) {
+		s := newFakeServer(t, nil, false, "AUTH PLAIN")
+		defer s.Close()
+		settings := &apps.SMTPSettings{Host: "127.0.0.1", Port: s.port(), User: "user", Pass: "pass", Auth: apps.AuthCRAMMD5}
+		_, err := sendMail(context.Background(), settings, "user@example.com", []string{"test@example.com"}, []byte("Subject: Test\r\n\r\nTest\r\n"), nil)
+		if err == nil || !strings.Contains(err.Error(), "does not advertise the CRAM-MD5 authentication mechanism (advertised: PLAIN)") {
+			t.Errorf("Incorrect error, expected: does not advertise the CRAM-MD5 authentication mechanism, got: %v", err)
+		}
+	})
+}
+
+func TestRunSendMailChecksSender(t *testing.T) {
+	t.Run("Check relay without authentication", func(t *testing.T) {
+		s := newFakeServer(t, nil, false)
+		defer s.Close()
+		settings := &apps.SMTPSettings{Host: "127.0.0.1", Port: s.port(), Auth: apps.AuthNone, From: "wordpress@example.com", FromName: "Blog"}
+		if err := RunSendMailChecks(context.Background(), settings, nil, nil, "test@example.com"); err != nil {
+			t.Fatalf("error sending mail: %v", err)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, cmd := range s.commands {
+			if strings.HasPrefix(cmd, "AUTH") {
+				t.Errorf("Unexpected authentication: %s", cmd)
+			}
+		}
+		if !contains(s.commands, "MAIL FROM:<wordpress@example.com>") {
+			t.Errorf("Incorrect sender, expected: MAIL FROM:<wordpress@example.com>, got: %v", s.commands)
+		}
+	})
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if strings.HasPrefix(item, s) {
+			return true
+		}
+	}
+	return false
+}
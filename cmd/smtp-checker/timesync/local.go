@@ -0,0 +1,122 @@
+package timesync
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMaxStateAge is the maximum age of the state files of a daemon that is
+// synchronizing the clock. chronyd and ntpd update their drift files every hour,
+// and systemd-timesyncd its clock file on every synchronization.
+const DefaultMaxStateAge = 2 * time.Hour
+
+// Daemon describes the files used by a time synchronization daemon
+type Daemon struct {
+	Name string
+	// Process is the process name, as found in /proc/<pid>/comm
+	Process string
+	// StateFiles are updated by the daemon while it synchronizes the clock
+	StateFiles []string
+	// SyncFile exists while the clock is synchronized, if the daemon creates it
+	SyncFile string
+}
+
+// Daemons contains the known time synchronization daemons. Paths are relative
+// to the root directory.
+var Daemons = []Daemon{
+	{
+		Name:       "chronyd",
+		Process:    "chronyd",
+		StateFiles: []string{"var/lib/chrony/drift", "var/lib/chrony/chrony.drift"},
+	},
+	{
+		Name:       "ntpd",
+		Process:    "ntpd",
+		StateFiles: []string{"var/lib/ntp/ntp.drift", "var/lib/ntp/drift", "var/lib/ntpsec/ntp.drift"},
+	},
+	{
+		Name:       "systemd-timesyncd",
+		Process:    "systemd-timesyn",
+		StateFiles: []string{"var/lib/systemd/timesync/clock", "var/lib/private/systemd/timesync/clock"},
+		SyncFile:   "run/systemd/timesync/synchronized",
+	},
+}
+
+// Status is the state of a time synchronization daemon
+type Status struct {
+	Daemon       string
+	Running      bool
+	Synchronized bool
+	// StateFile is the state file found, and Updated its modification time
+	StateFile string
+	Updated   time.Time
+}
+
+func (s Status) String() string {
+	var res []string
+	if s.Running {
+		res = append(res, "running")
+	} else {
+		res = append(res, "not running")
+	}
+	if s.Synchronized {
+		res = append(res, "synchronized")
+	} else if s.Running {
+		res = append(res, "not synchronized")
+	}
+	if s.StateFile != "" {
+		res = append(res, fmt.Sprintf("state file %s updated %s ago", s.StateFile, time.Since(s.Updated).Round(time.Second)))
+	}
+	return fmt.Sprintf("%s: %s", s.Daemon, strings.Join(res, ", "))
+}
+
+// processes returns the names of the processes running, read from <root>/proc
+func processes(root string) map[string]bool {
+	res := map[string]bool{}
+	entries, err := ioutil.ReadDir(filepath.Join(root, "proc"))
+	if err != nil {
+		return res
+	}
+	for _, e := range entries {
+		if _, err := strconv.Atoi(e.Name()); err != nil {
+			continue
+		}
+		comm, err := ioutil.ReadFile(filepath.Join(root, "proc", e.Name(), "comm"))
+		if err == nil {
+			res[strings.TrimSpace(string(comm))] = true
+		}
+	}
+	return res
+}
+
+// Local inspects the time synchronization daemons of the host whose filesystem
+// is mounted at root ("/" for the current host). Only the daemons running or with
+// state files are returned. A daemon running is synchronized if its state files
+// were updated within maxAge.
+func Local(root string, maxAge time.Duration) []Status {
+	running := processes(root)
+	var res []Status
+	for _, d := range Daemons {
+		s := Status{Daemon: d.Name, Running: running[d.Process]}
+		for _, f := range d.StateFiles {
+			if fi, err := os.Stat(filepath.Join(root, f)); err == nil {
+				s.StateFile, s.Updated = "/"+f, fi.ModTime()
+				break
+			}
+		}
+		if !s.Running && s.StateFile == "" {
+			continue
+		}
+		if s.Running {
+			_, err := os.Stat(filepath.Join(root, d.SyncFile))
+			s.Synchronized = d.SyncFile != "" && err == nil || s.StateFile != "" && time.Since(s.Updated) <= maxAge
+		}
+		res = append(res, s)
+	}
+	return res
+}
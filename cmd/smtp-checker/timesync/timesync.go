@@ -0,0 +1,91 @@
+// Package timesync provides functions for checking the time synchronization of
+// the host, querying NTP servers and inspecting the local synchronization daemons
+package timesync
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/beevik/ntp"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/timeout"
+)
+
+// DefaultServers are the NTP servers queried by default
+var DefaultServers = []string{"pool.ntp.org"}
+
+// defaultQueryTimeout is the maximum duration of each query without deadline
+const defaultQueryTimeout = 5 * time.Second
+
+// Sample is the result of querying a NTP server
+type Sample struct {
+	Server  string
+	Offset  time.Duration
+	RTT     time.Duration
+	Stratum int
+	Err     error
+}
+
+// Query queries a NTP server, with the format host or host:port
+func Query(ctx context.Context, server string) Sample {
+	s := Sample{Server: server}
+	host, opts := server, ntp.QueryOptions{Timeout: timeout.Remaining(ctx, defaultQueryTimeout)}
+	if h, p, err := net.SplitHostPort(server); err == nil {
+		port, err := strconv.Atoi(p)
+		if err != nil {
+			s.Err = err
+			return s
+		}
+		host, opts.Port = h, port
+	}
+	rp, err := ntp.QueryWithOptions(host, opts)
+	if err != nil {
+		s.Err = timeout.Wrap(ctx, "querying "+server, err)
+		return s
+	}
+	if err := rp.Validate(); err != nil {
+		s.Err = err
+		return s
+	}
+	s.Offset, s.RTT, s.Stratum = rp.ClockOffset, rp.RTT, int(rp.Stratum)
+	return s
+}
+
+// QueryAll queries the NTP servers in parallel, returning the samples in the
+// same order
+func QueryAll(ctx context.Context, servers []string) []Sample {
+	samples := make([]Sample, len(servers))
+	done := make(chan struct{})
+	for i, server := range servers {
+		go func(i int, server string) {
+			samples[i] = Query(ctx, server)
+			done <- struct{}{}
+		}(i, server)
+	}
+	for range servers {
+		<-done
+	}
+	return samples
+}
+
+// MedianOffset returns the median offset of the samples without errors and with
+// a RTT up to maxRTT (unlimited if 0), and the number of samples used
+func MedianOffset(samples []Sample, maxRTT time.Duration) (time.Duration, int) {
+	var offsets []time.Duration
+	for _, s := range samples {
+		if s.Err == nil && (maxRTT == 0 || s.RTT <= maxRTT) {
+			offsets = append(offsets, s.Offset)
+		}
+	}
+	if len(offsets) == 0 {
+		return 0, 0
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	n := len(offsets)
+	if n%2 == 1 {
+		return offsets[n/2], n
+	}
+	return (offsets[n/2-1] + offsets[n/2]) / 2, n
+}
@@ -0,0 +1,155 @@
+package timesync
+
+import (
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ntpTime encodes t as a NTP timestamp
+func ntpTime(t time.Time) uint64 {
+	secs := uint64(t.Unix() + 2208988800)
+	frac := uint64(t.Nanosecond()) << 32 / 1e9
+	return secs<<32 | frac
+}
+
+// fakeNTP runs a NTP server whose clock is offset respect the local one
+func fakeNTP(t *testing.T, offset time.Duration, stratum byte) (addr string, stop func()) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error creating listener: %v", err)
+	}
+	go func() {
+		req := make([]byte, 48)
+		for {
+			n, raddr, err := conn.ReadFrom(req)
+			if err != nil {
+				return
+			}
+			if n < 48 {
+				continue
+			}
+			now := time.Now().Add(offset)
+			resp := make([]byte, 48)
+			resp[0] = 0x24 // no leap warning, version 4, server mode
+			resp[1] = stratum
+			resp[3] = 0xec // precision
+			copy(resp[12:16], "GPS\x00")
+			binary.BigEndian.PutUint64(resp[16:], ntpTime(now.Add(-time.Minute)))
+			copy(resp[24:32], req[40:48])
+			binary.BigEndian.PutUint64(resp[32:], ntpTime(now))
+			binary.BigEndian.PutUint64(resp[40:], ntpTime(now))
+			conn.WriteTo(resp, raddr)
+		}
+	}()
+	return conn.LocalAddr().String(), func() { conn.Close() }
+}
+
+func TestQueryAll(t *testing.T) {
+	ahead, stopAhead := fakeNTP(t, 3*time.Second, 2)
+	defer stopAhead()
+	behind, stopBehind := fakeNTP(t, -time.Second, 1)
+	defer stopBehind()
+	synced, stopSynced := fakeNTP(t, 0, 2)
+	defer stopSynced()
+	invalid, stopInvalid := fakeNTP(t, 0, 16)
+	defer stopInvalid()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	samples := QueryAll(ctx, []string{ahead, behind, synced, invalid})
+	t.Run("Check samples of each server", func(t *testing.T) {
+		for i, expected := range []time.Duration{3 * time.Second, -time.Second, 0} {
+			s := samples[i]
+			if s.Err != nil {
+				t.Fatalf("Error querying %s: %v", s.Server, s.Err)
+			}
+			if d := s.Offset - expected; d > 100*time.Millisecond || d < -100*time.Millisecond {
+				t.Errorf("Incorrect offset of %s, expected: %s, got: %s", s.Server, expected, s.Offset)
+			}
+		}
+		if samples[1].Stratum != 1 {
+			t.Errorf("Incorrect stratum, expected: 1, got: %d", samples[1].Stratum)
+		}
+		if samples[3].Err == nil || !strings.Contains(samples[3].Err.Error(), "invalid stratum") {
+			t.Errorf("Incorrect error, expected: invalid stratum, got: %v", samples[3].Err)
+		}
+	})
+	t.Run("Check median offset", func(t *testing.T) {
+		offset, n := MedianOffset(samples, 0)
+		if n != 3 {
+			t.Errorf("Incorrect number of samples, expected: 3, got: %d", n)
+		}
+		if offset > 100*time.Millisecond || offset < -100*time.Millisecond {
+			t.Errorf("Incorrect median offset, expected: 0s, got: %s", offset)
+		}
+		if _, n := MedianOffset(samples, time.Nanosecond); n != 0 {
+			t.Errorf("Incorrect number of samples below the RTT threshold, expected: 0, got: %d", n)
+		}
+	})
+	t.Run("Check unreachable servers", func(t *testing.T) {
+		s := Query(ctx, "127.0.0.1:notaport")
+		if s.Err == nil {
+			t.Errorf("Invalid server %s queried", s.Server)
+		}
+	})
+}
+
+func TestLocal(t *testing.T) {
+	root, err := ioutil.TempDir("", "timesync")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+	write := func(path, content string, mtime time.Time) {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("error creating directory: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("error writing file: %v", err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("error setting times: %v", err)
+		}
+	}
+	now := time.Now()
+	write("proc/1/comm", "systemd\n", now)
+	write("proc/210/comm", "chronyd\n", now)
+	write("proc/self/comm", "smtp-checker\n", now)
+	write("var/lib/chrony/drift", "-12.3 0.4\n", now.Add(-10*time.Minute))
+	write("var/lib/ntp/ntp.drift", "1.2\n", now.Add(-72*time.Hour))
+
+	t.Run("Check daemons running and synchronized", func(t *testing.T) {
+		statuses := Local(root, DefaultMaxStateAge)
+		if len(statuses) != 2 {
+			t.Fatalf("Incorrect daemons, expected: chronyd and ntpd, got: %v", statuses)
+		}
+		if s := statuses[0]; s.Daemon != "chronyd" || !s.Running || !s.Synchronized || s.StateFile != "/var/lib/chrony/drift" {
+			t.Errorf("Incorrect status, expected: chronyd running and synchronized, got: %v", s)
+		}
+		if s := statuses[1]; s.Daemon != "ntpd" || s.Running || s.Synchronized {
+			t.Errorf("Incorrect status, expected: ntpd not running, got: %v", s)
+		}
+	})
+	t.Run("Check stale state files", func(t *testing.T) {
+		statuses := Local(root, time.Minute)
+		if s := statuses[0]; !s.Running || s.Synchronized {
+			t.Errorf("Incorrect status, expected: chronyd running but not synchronized, got: %v", s)
+		}
+	})
+	t.Run("Check systemd-timesyncd synchronized file", func(t *testing.T) {
+		write("proc/300/comm", "systemd-timesyn\n", now)
+		write("run/systemd/timesync/synchronized", "", now.Add(-24*time.Hour))
+		statuses := Local(root, time.Minute)
+		if s := statuses[len(statuses)-1]; s.Daemon != "systemd-timesyncd" || !s.Synchronized {
+			t.Errorf("Incorrect status, expected: systemd-timesyncd synchronized, got: %v", s)
+		}
+	})
+}
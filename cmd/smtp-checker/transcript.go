@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitnami-labs/healthcheck-tools/pkg/redact"
+)
+
+// transcript records the dialogue with the SMTP server. The lines sent by the
+// client start with "C:", the replies of the server with "S:" and the events of
+// the connection (e.g. the TLS handshake) with "*". A nil transcript records nothing.
+type transcript struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func newTranscript() *transcript {
+	return &transcript{}
+}
+
+func (t *transcript) add(prefix, line string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lines = append(t.lines, fmt.Sprintf("%s %s %s", time.Now().Format("15:04:05.000"), prefix, line))
+}
+
+func (t *transcript) client(line string) {
+	t.add("C:", line)
+}
+
+// server records a reply, which may span several lines
+func (t *transcript) server(code int, msg string) {
+	lines := strings.Split(msg, "\n")
+	for i, line := range lines {
+		sep := "-"
+		if i == len(lines)-1 {
+			sep = " "
+		}
+		t.add("S:", fmt.Sprintf("%03d%s%s", code, sep, line))
+	}
+}
+
+func (t *transcript) note(format string, args ...interface{}) {
+	t.add("*", fmt.Sprintf(format, args...))
+}
+
+// Lines returns the recorded lines
+func (t *transcript) Lines() []string {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.lines...)
+}
+
+// Print writes the recorded lines, hiding the registered secrets
+func (t *transcript) Print(w io.Writer) {
+	fmt.Fprintln(w, "SMTP transcript:")
+	for _, line := range t.Lines() {
+		fmt.Fprintf(w, "  %s\n", redact.String(line))
+	}
+}
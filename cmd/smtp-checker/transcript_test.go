@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/bitnami-labs/healthcheck-tools/cmd/smtp-checker/apps"
+)
+
+func TestSendMailTranscript(t *testing.T) {
+	cert, pool := testCertificate(t)
+	tlsRootCAs = pool
+	defer func() { tlsRootCAs = nil }()
+	s := newFakeServer(t, &tls.Config{Certificates: []tls.Certificate{cert}}, false, "AUTH PLAIN LOGIN")
+	defer s.Close()
+
+	testData := []struct {
+		name  string
+		pass  string
+		lines []string
+	}{
+		{"successful delivery", "pass", []string{
+			"S: 220 fake ESMTP", "C: EHLO localhost", "S: 250 STARTTLS", "C: STARTTLS", "S: 220 2.0.0 Ready",
+			"* TLS", "C: EHLO localhost", "C: AUTH LOGIN", "C: xxxxxx", "S: 235", "C: MAIL FROM:<user@example.com>",
+			"C: RCPT TO:<test@example.com>", "C: DATA", "S: 354", "C: [message of", "C: .", "S: 250 2.0.0 OK", "C: QUIT",
+		}},
+		{"rejected credentials", "wrong", []string{"C: AUTH LOGIN", "S: 535 5.7.8 Authentication credentials invalid"}},
+	}
+	for _, tt := range testData {
+		t.Run("Check transcript of "+tt.name, func(t *testing.T) {
+			tr := newTranscript()
+			settings := &apps.SMTPSettings{Host: "127.0.0.1", Port: s.port(), User: "user", Pass: tt.pass, Auth: apps.AuthLogin}
+			sendMail(context.Background(), settings, "user@example.com", []string{"test@example.com"}, []byte("Subject: Test\r\n\r\nTest\r\n"), tr)
+			lines := tr.Lines()
+			next := 0
+			for _, line := range lines {
+				if strings.Contains(line, base64.StdEncoding.EncodeToString([]byte(tt.pass))) {
+					t.Errorf("Password not masked in transcript: %s", line)
+				}
+				if next < len(tt.lines) && strings.Contains(line, " "+tt.lines[next]) {
+					next++
+				}
+			}
+			if next < len(tt.lines) {
+				t.Errorf("Incorrect transcript, expected: %q, got: %s", tt.lines[next], strings.Join(lines, "\n"))
+			}
+		})
+	}
+}
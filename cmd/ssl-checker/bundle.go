@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bitnami-labs/healthcheck-tools/pkg/apache"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/bundle"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/discovery"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/redact"
+)
+
+const defaultBundleOutput = "ssl-checker-bundle.tar.gz"
+
+// CertificateMetadata contains the public information of a certificate in use.
+// The private key is never read, only whether it matches the certificate.
+type CertificateMetadata struct {
+	ApacheFile      string    `json:"apache_file"`
+	CertificateFile string    `json:"certificate_file"`
+	KeyFile         string    `json:"key_file"`
+	KeyMatch        bool      `json:"key_match"`
+	Subject         string    `json:"subject,omitempty"`
+	Issuer          string    `json:"issuer,omitempty"`
+	DNSNames        []string  `json:"dns_names,omitempty"`
+	SerialNumber    string    `json:"serial_number,omitempty"`
+	NotBefore       time.Time `json:"not_before"`
+	NotAfter        time.Time `json:"not_after"`
+	SHA256          string    `json:"sha256_fingerprint,omitempty"`
+	ChainLength     int       `json:"chain_length"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// metadata returns the metadata of the first certificate in the certificate file
+func (cpi CertificatePairInfo) metadata() CertificateMetadata {
+	res := CertificateMetadata{
+		ApacheFile:      cpi.apacheConfPath,
+		CertificateFile: cpi.certPath,
+		KeyFile:         cpi.keyPath,
+		KeyMatch:        cpi.certKeyMatch(),
+	}
+	encodedCert, err := cpi.getEncodedCertificate()
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(encodedCert); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			res.Error = err.Error()
+			return res
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		res.Error = "no PEM encoded certificate found"
+		return res
+	}
+	cert := certs[0]
+	res.Subject = cert.Subject.String()
+	res.Issuer = cert.Issuer.String()
+	res.DNSNames = cert.DNSNames
+	res.SerialNumber = cert.SerialNumber.String()
+	res.NotBefore = cert.NotBefore
+	res.NotAfter = cert.NotAfter
+	res.SHA256 = fmt.Sprintf("%X", sha256.Sum256(cert.Raw))
+	res.ChainLength = len(certs)
+	return res
+}
+
+// bundleSettings is a structure that contains the settings used
+// for the checks, as stored in the support bundle
+type bundleSettings struct {
+	InstallDir string `json:"install_dir"`
+	ApacheRoot string `json:"apache_root"`
+	ApacheConf string `json:"apache_conf"`
+	Hostname   string `json:"hostname"`
+	Port       int    `json:"port"`
+}
+
+// WriteBundle writes a support bundle with the results of the checks, the Apache
+// configuration tree and the metadata of the active certificates. Secrets are redacted.
+func WriteBundle(output string, settings bundleSettings, results []bundle.Result) error {
+	b, err := bundle.Create(output, redact.Default)
+	if err != nil {
+		return err
+	}
+	err = writeBundleFiles(b, settings, results)
+	if cerr := b.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func writeBundleFiles(b *bundle.Bundle, settings bundleSettings, results []bundle.Result) error {
+	if err := b.AddJSON("versions.json", bundle.NewVersions("ssl-checker", VERSION)); err != nil {
+		return err
+	}
+	if err := b.AddJSON("results.json", results); err != nil {
+		return err
+	}
+	if err := b.AddJSON("settings.json", settings); err != nil {
+		return err
+	}
+	if stack, err := discovery.Inspect(settings.InstallDir); err == nil {
+		if err := b.AddJSON("stack.json", stack); err != nil {
+			return err
+		}
+	}
+	apacheConf, err := apache.OpenAllApacheConfigurationFiles(settings.ApacheConf, settings.ApacheRoot)
+	if err != nil {
+		return fmt.Errorf("reading the Apache configuration: %v", err)
+	}
+	for file, content := range apacheConf {
+		name := strings.TrimPrefix(filepath.ToSlash(file), "/")
+		if err := b.AddFile(path.Join("apache", name), []byte(content)); err != nil {
+			return err
+		}
+	}
+	certificates := []CertificateMetadata{}
+	for _, cpi := range getActiveCertificatePairsInAllFiles(apacheConf, settings.ApacheRoot) {
+		certificates = append(certificates, cpi.metadata())
+	}
+	return b.AddJSON("certificates.json", certificates)
+}
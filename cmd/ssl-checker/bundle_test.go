@@ -0,0 +1,73 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteBundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	apacheConf := filepath.Join(dir, "httpd.conf")
+	ioutil.WriteFile(certFile, []byte(testCertificate), 0644)
+	ioutil.WriteFile(keyFile, []byte(testKey), 0600)
+	ioutil.WriteFile(apacheConf, []byte(fmt.Sprintf(`
+SSLCertificateFile "%s"
+SSLCertificateKeyFile "%s"
+`, certFile, keyFile)), 0644)
+	output := filepath.Join(dir, "bundle.tar.gz")
+
+	t.Run("Check support bundle content", func(t *testing.T) {
+		settings := bundleSettings{dir, dir, apacheConf, "localhost", 443}
+		if err := WriteBundle(output, settings, nil); err != nil {
+			t.Fatalf("Error writing bundle: %v", err)
+		}
+		f, err := os.Open(output)
+		if err != nil {
+			t.Fatalf("Error opening bundle: %v", err)
+		}
+		defer f.Close()
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("Error decompressing bundle: %v", err)
+		}
+		tr := tar.NewReader(gz)
+		files := map[string]string{}
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				break
+			}
+			content, _ := ioutil.ReadAll(tr)
+			files[hdr.Name] = string(content)
+			if strings.Contains(string(content), "PRIVATE KEY") {
+				t.Errorf("Private key found in bundle file %s", hdr.Name)
+			}
+		}
+		apacheFile := "bundle/apache/" + strings.TrimPrefix(filepath.ToSlash(apacheConf), "/")
+		if _, ok := files[apacheFile]; !ok {
+			t.Errorf("Apache configuration file %s not found in bundle", apacheFile)
+		}
+		certificates := files["bundle/certificates.json"]
+		if !strings.Contains(certificates, "CN=example.com") || !strings.Contains(certificates, `"key_match": true`) {
+			t.Errorf("Incorrect certificate metadata in bundle: %s", certificates)
+		}
+	})
+	t.Run("Check errors reading the Apache configuration are reported", func(t *testing.T) {
+		settings := bundleSettings{dir, dir, filepath.Join(dir, "missing.conf"), "localhost", 443}
+		if err := WriteBundle(output, settings, nil); err == nil || !strings.Contains(err.Error(), "Apache configuration") {
+			t.Errorf("Expected error reading the Apache configuration, got: %v", err)
+		}
+	})
+}
@@ -1,10 +1,18 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"time"
+
+	"github.com/bitnami-labs/healthcheck-tools/pkg/bundle"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/discovery"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/profile"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/redact"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/timeout"
 )
 
 var (
@@ -12,25 +20,110 @@ var (
 	VERSION = "devel"
 )
 
+const defaultTimeout = 10 * time.Second
+
+// checks contains the name of the checks that can be selected in a profile
+var checks = []string{"certificates", "https"}
+
+// explicitFlags returns the name of the flags provided in the command line
+func explicitFlags(fs *flag.FlagSet) map[string]bool {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
 func main() {
 	var apacheRoot string
 	var apacheConf string
 	var hostname string
 	var port int
+	var installDir string
+	var configFile string
+	var globalTimeout time.Duration
+	var bundleOutput string
 	var getVersion bool
+	// bundle mode runs the checks and writes a support bundle with the results
+	bundleMode := len(os.Args) > 1 && os.Args[1] == "bundle"
+	if bundleMode {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+	flag.StringVar(&installDir, "install-dir", discovery.DefaultInstallDir,
+		"Installation directory used to detect the Apache paths when they are not provided")
 	flag.StringVar(&apacheRoot, "apache-root", "/opt/bitnami/apache2/", "Root of Apache installation")
 	flag.StringVar(&apacheConf, "apache-conf", "/opt/bitnami/apache2/conf/httpd.conf",
 		"Path to the root Apache configuration file")
-	flag.StringVar(&hostname, "hostname", "", "Web application hostname")
+	flag.StringVar(&hostname, "hostname", "", "Web application hostname (localhost by default)")
 	flag.IntVar(&port, "port", 443, "Web application port")
+	flag.StringVar(&configFile, "config", "", "YAML check profile")
+	flag.DurationVar(&globalTimeout, "timeout", defaultTimeout, "Maximum duration of each check")
+	checkTimeouts := timeout.Overrides{}
+	flag.Var(checkTimeouts, "check-timeout", "Maximum duration of specific checks, overriding -timeout (e.g. https=30s)")
+	flag.StringVar(&bundleOutput, "bundle-output", defaultBundleOutput, "Support bundle file (bundle mode only)")
 	flag.BoolVar(&getVersion, "version", false, "Show current version")
 	flag.Parse()
 	if getVersion {
 		fmt.Println(VERSION)
 		os.Exit(0)
 	}
+	stderr := redact.NewWriter(os.Stderr)
+	log.SetOutput(stderr)
+
+	set := explicitFlags(flag.CommandLine)
+	p := &profile.Profile{}
+	if configFile != "" {
+		var err error
+		p, err = profile.Load(configFile)
+		if err != nil {
+			log.Fatalf("Found errors when loading the check profile: %v", err)
+		}
+		target := p.Targets.SSL
+		if target.WebServer == "nginx" || target.NginxConf != "" || target.NginxRoot != "" {
+			log.Fatalf("Only Apache is currently supported as web server")
+		}
+		for name, value := range map[string]string{
+			"install-dir": target.InstallDir,
+			"apache-root": target.ApacheRoot,
+			"apache-conf": target.ApacheConf,
+			"hostname":    target.Hostname,
+		} {
+			if !set[name] && value != "" {
+				flag.Set(name, value)
+				set[name] = true
+			}
+		}
+		if !set["port"] && target.Port != 0 {
+			port = target.Port
+		}
+		if !set["timeout"] && p.Thresholds.Timeout != 0 {
+			globalTimeout = time.Duration(p.Thresholds.Timeout)
+		}
+		for name, d := range p.Checks.SSL.Timeouts {
+			if _, ok := checkTimeouts[name]; !ok {
+				checkTimeouts[name] = time.Duration(d)
+			}
+		}
+	}
+	enabled, err := p.Checks.SSL.Enabled("checks.ssl", checks)
+	if err != nil {
+		log.Fatalf("Found errors when selecting the checks: %v", err)
+	}
+	if err := checkTimeouts.Validate(checks); err != nil {
+		log.Fatalf("Found errors when setting the check timeouts: %v", err)
+	}
+	ctx, cancel := timeout.WithInterrupt(context.Background())
+	defer cancel()
+	if !set["apache-root"] && !set["apache-conf"] {
+		root, conf, err := DetectApache(installDir)
+		if err != nil {
+			fmt.Fprintf(stderr, "Unable to detect Apache in %q, using default paths: %v\n", installDir, err)
+		} else {
+			apacheRoot, apacheConf = root, conf
+		}
+	}
 	if hostname == "" {
-		log.Fatal("-hostname flag must be set")
+		hostname = "localhost"
 	}
 	fmt.Printf(`======================================
 SSL CHECKS
@@ -43,23 +136,42 @@ Starting checks with these parameters:
 ======================================
 `, apacheRoot, apacheConf, hostname, port)
 
-	fmt.Println("-- Check: Active SSL Certificates in Apache Configuration --")
-	err := RunActiveCertificatesChecks(apacheConf, apacheRoot)
+	var results []bundle.Result
 	foundErrors := false
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Active Certificate check failed: %q\n", err)
-		foundErrors = true
+	if enabled["certificates"] {
+		fmt.Println("-- Check: Active SSL Certificates in Apache Configuration --")
+		start := time.Now()
+		err := RunActiveCertificatesChecks(apacheConf, apacheRoot)
+		results = append(results, bundle.NewResult("certificates", start, err))
+		if err != nil {
+			fmt.Fprintf(stderr, "Active Certificate check failed: %q\n", err)
+			foundErrors = true
+		}
+		fmt.Printf("-- End of check --\n\n")
 	}
-	fmt.Printf("-- End of check --\n\n")
 
-	fmt.Println("-- Check: HTTPS Connection to web server --")
-	err = RunHTTPSConnectionChecks(hostname, port)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "HTTPS Connection failed: %q\n", err)
-		foundErrors = true
+	if enabled["https"] {
+		fmt.Println("-- Check: HTTPS Connection to web server --")
+		checkCtx, cancelCheck := timeout.WithTimeout(ctx, checkTimeouts.For("https", globalTimeout))
+		start := time.Now()
+		err := RunHTTPSConnectionChecks(checkCtx, hostname, port)
+		cancelCheck()
+		results = append(results, bundle.NewResult("https", start, err))
+		if err != nil {
+			fmt.Fprintf(stderr, "HTTPS Connection failed: %q\n", err)
+			foundErrors = true
+		}
+		fmt.Printf("-- End of check --\n\n")
 	}
-	fmt.Printf("-- End of check --\n\n")
 	fmt.Println("SSL Checks finished")
+	if bundleMode {
+		settings := bundleSettings{installDir, apacheRoot, apacheConf, hostname, port}
+		if err := WriteBundle(bundleOutput, settings, results); err != nil {
+			fmt.Fprintf(stderr, "Found errors when writing the support bundle: %q\n", err)
+		} else {
+			fmt.Printf("Support bundle written to %q. Attach it to your support ticket.\n", bundleOutput)
+		}
+	}
 	if foundErrors {
 		log.Fatalf("Found errors when checking the SSL configuration")
 	} else {
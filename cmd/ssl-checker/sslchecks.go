@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
@@ -10,6 +11,8 @@ import (
 	"regexp"
 
 	"github.com/bitnami-labs/healthcheck-tools/pkg/apache"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/discovery"
+	"github.com/bitnami-labs/healthcheck-tools/pkg/timeout"
 )
 
 // CertificatePairInfo contains paths of an active certificate-key path
@@ -124,25 +127,24 @@ func (cpi CertificatePairInfo) printCertKeyMatchInfo() {
 }
 
 // getServerCertificateDomain attempts a HTTPS connection to the server and returns the returned certificate domain name
-func (httpsConnInfo HTTPSConnectionInfo) getServerCertificateDomain() (string, error) {
+func (httpsConnInfo HTTPSConnectionInfo) getServerCertificateDomain(ctx context.Context) (string, error) {
 	conf := &tls.Config{
 		InsecureSkipVerify: true,
 	}
 	connectionString := fmt.Sprintf("%s:%d", httpsConnInfo.hostname, httpsConnInfo.port)
-	conn, err := tls.Dial("tcp", connectionString, conf)
+	conn, err := timeout.DialTLS(ctx, "tcp", connectionString, conf)
 	if err != nil {
-		return "", err
+		return "", timeout.Wrap(ctx, fmt.Sprintf("establishing a HTTPS connection with %s", connectionString), err)
 	}
-	conn.Handshake()
 	res := conn.ConnectionState().PeerCertificates[0].Subject.CommonName
 	conn.Close()
 	return res, err
 }
 
 // printHTTPSConnectionInfo prints the results of the HTTPS connection attempt to the server
-func (httpsConnInfo HTTPSConnectionInfo) printHTTPSConnectionInfo() error {
+func (httpsConnInfo HTTPSConnectionInfo) printHTTPSConnectionInfo(ctx context.Context) error {
 	fmt.Printf("%s\n", httpsConnInfo)
-	domain, err := httpsConnInfo.getServerCertificateDomain()
+	domain, err := httpsConnInfo.getServerCertificateDomain(ctx)
 	if err == nil {
 		fmt.Printf("Server certificate domain: %q\n", domain)
 	}
@@ -172,8 +174,23 @@ func RunActiveCertificatesChecks(confFile, apacheRoot string) error {
 }
 
 // RunHTTPSConnectionChecks performs checks on the HTTPS connection to web server
-func RunHTTPSConnectionChecks(hostname string, port int) error {
+func RunHTTPSConnectionChecks(ctx context.Context, hostname string, port int) error {
 	httpsConnection := HTTPSConnectionInfo{hostname, port}
-	err := httpsConnection.printHTTPSConnectionInfo()
+	err := httpsConnection.printHTTPSConnectionInfo(ctx)
 	return err
 }
+
+// DetectApache inspects the installation directory and returns the Apache root and configuration file
+func DetectApache(installDir string) (string, string, error) {
+	stack, err := discovery.Inspect(installDir)
+	if err != nil {
+		return "", "", err
+	}
+	if apache, ok := stack.WebServer("apache"); ok {
+		return apache.Root, apache.ConfigFile, nil
+	}
+	if _, ok := stack.WebServer("nginx"); ok {
+		return "", "", fmt.Errorf("nginx detected, only Apache is currently supported")
+	}
+	return "", "", fmt.Errorf("no web server found")
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"io/ioutil"
 	"log"
 	"os"
@@ -219,7 +220,7 @@ func TestCertKeyMatch(t *testing.T) {
 func TestGetServerCertificateDomain(t *testing.T) {
 	httpsConnection := HTTPSConnectionInfo{"bitnami.com", 443}
     t.Run("Check HTTPS Connection", func(t *testing.T) {
-		checkResult, err := httpsConnection.getServerCertificateDomain()
+		checkResult, err := httpsConnection.getServerCertificateDomain(context.Background())
 		if err != nil {
 			t.Errorf("Error creating HTTPS request: %s", err)
 		}
@@ -0,0 +1,140 @@
+// Package bundle provides functions for writing support bundles with the results of the checks
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/bitnami-labs/healthcheck-tools/pkg/redact"
+)
+
+// Result is a structure that contains the outcome of a check
+type Result struct {
+	Check      string   `json:"check"`
+	Status     string   `json:"status"`
+	Error      string   `json:"error,omitempty"`
+	Duration   string   `json:"duration"`
+	Transcript []string `json:"transcript,omitempty"`
+}
+
+// Status of the checks
+const (
+	Passed = "passed"
+	Failed = "failed"
+)
+
+// NewResult creates a Result from the error returned by a check
+func NewResult(check string, start time.Time, err error) Result {
+	res := Result{Check: check, Status: Passed, Duration: time.Since(start).String()}
+	if err != nil {
+		res.Status = Failed
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// Versions is a structure that contains the versions of the tool and the system
+type Versions struct {
+	Tool         string `json:"tool"`
+	ToolVersion  string `json:"tool_version"`
+	GoVersion    string `json:"go_version"`
+	OS           string `json:"os"`
+	Arch         string `json:"arch"`
+	Distribution string `json:"distribution,omitempty"`
+	Kernel       string `json:"kernel,omitempty"`
+}
+
+// NewVersions collects the versions of the tool and the system it runs on
+func NewVersions(tool, version string) Versions {
+	v := Versions{
+		Tool:        tool,
+		ToolVersion: version,
+		GoVersion:   runtime.Version(),
+		OS:          runtime.GOOS,
+		Arch:        runtime.GOARCH,
+	}
+	if osRelease, err := ioutil.ReadFile("/etc/os-release"); err == nil {
+		for _, line := range strings.Split(string(osRelease), "\n") {
+			if strings.HasPrefix(line, "PRETTY_NAME=") {
+				v.Distribution = strings.Trim(strings.TrimPrefix(line, "PRETTY_NAME="), `"`)
+			}
+		}
+	}
+	if kernel, err := ioutil.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		v.Kernel = strings.TrimSpace(string(kernel))
+	}
+	return v
+}
+
+// Bundle is a gzipped tarball where every file is redacted before being written
+type Bundle struct {
+	file     *os.File
+	gz       *gzip.Writer
+	tw       *tar.Writer
+	dir      string
+	redactor *redact.Redactor
+}
+
+// Create creates a bundle in path. The files are stored in a folder named
+// after the bundle, and redacted with r.
+func Create(path string, r *redact.Redactor) (*Bundle, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(f)
+	dir := filepath.Base(path)
+	for _, ext := range []string{".tgz", ".gz", ".tar"} {
+		dir = strings.TrimSuffix(dir, ext)
+	}
+	return &Bundle{file: f, gz: gz, tw: tar.NewWriter(gz), dir: dir, redactor: r}, nil
+}
+
+func (b *Bundle) write(name string, content []byte) error {
+	hdr := &tar.Header{
+		Name:    path.Join(b.dir, name),
+		Mode:    0600,
+		Size:    int64(len(content)),
+		ModTime: time.Now(),
+	}
+	if err := b.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := b.tw.Write(content)
+	return err
+}
+
+// AddFile adds the content of a configuration file, hiding any secret found in it
+func (b *Bundle) AddFile(name string, content []byte) error {
+	return b.write(name, []byte(b.redactor.Config(string(content))))
+}
+
+// AddJSON adds v encoded as JSON, hiding the registered secrets
+func (b *Bundle) AddJSON(name string, v interface{}) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return b.write(name, []byte(b.redactor.String(string(content))+"\n"))
+}
+
+// Close flushes the bundle to disk
+func (b *Bundle) Close() error {
+	if err := b.tw.Close(); err != nil {
+		b.file.Close()
+		return err
+	}
+	if err := b.gz.Close(); err != nil {
+		b.file.Close()
+		return err
+	}
+	return b.file.Close()
+}
@@ -0,0 +1,77 @@
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitnami-labs/healthcheck-tools/pkg/redact"
+)
+
+func readBundle(t *testing.T, path string) map[string]string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Error opening bundle: %v", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Error decompressing bundle: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	res := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		content, _ := ioutil.ReadAll(tr)
+		res[hdr.Name] = string(content)
+	}
+	return res
+}
+
+func TestBundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "support.tar.gz")
+
+	t.Run("Check bundle content is redacted", func(t *testing.T) {
+		b, err := Create(path, redact.New("smtp-pass"))
+		if err != nil {
+			t.Fatalf("Error creating bundle: %v", err)
+		}
+		if err := b.AddFile("config/wp-config.php", []byte(`define('DB_PASSWORD', 'db-pass');`)); err != nil {
+			t.Fatalf("Error adding file: %v", err)
+		}
+		results := []Result{NewResult("sendmail", time.Now(), errors.New("535 authentication failed for smtp-pass"))}
+		if err := b.AddJSON("results.json", results); err != nil {
+			t.Fatalf("Error adding results: %v", err)
+		}
+		if err := b.Close(); err != nil {
+			t.Fatalf("Error closing bundle: %v", err)
+		}
+
+		files := readBundle(t, path)
+		config, ok := files["support/config/wp-config.php"]
+		if !ok {
+			t.Fatalf("Configuration file not found in bundle, got: %v", files)
+		}
+		if strings.Contains(config, "db-pass") {
+			t.Errorf("Database password not redacted: %s", config)
+		}
+		res := files["support/results.json"]
+		if strings.Contains(res, "smtp-pass") || !strings.Contains(res, `"status": "failed"`) {
+			t.Errorf("Incorrect results in bundle: %s", res)
+		}
+	})
+}
@@ -0,0 +1,185 @@
+// Package discovery provides functions for detecting the components installed in a Bitnami stack
+package discovery
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultInstallDir is the default installation directory of Bitnami stacks
+const DefaultInstallDir = "/opt/bitnami"
+
+// Component is a structure that contains the info about
+// an installed component and its configuration file
+type Component struct {
+	Name       string
+	Root       string
+	ConfigFile string
+}
+
+func (c Component) String() string {
+	if c.ConfigFile == "" {
+		return fmt.Sprintf("%s (%s)", c.Name, c.Root)
+	}
+	return fmt.Sprintf("%s (%s, configuration: %s)", c.Name, c.Root, c.ConfigFile)
+}
+
+// Stack is a structure that contains the components
+// detected in a Bitnami installation directory
+type Stack struct {
+	InstallDir string
+	WebServers []Component
+	Apps       []Component
+	Databases  []Component
+}
+
+// layout describes where a component lives, relative to the installation directory.
+// The first candidate whose configuration file exists is used.
+type layout struct {
+	name       string
+	candidates [][2]string
+}
+
+var webServerLayouts = []layout{
+	{"apache", [][2]string{{"apache2", "apache2/conf/httpd.conf"}, {"apache", "apache/conf/httpd.conf"}}},
+	{"nginx", [][2]string{{"nginx", "nginx/conf/nginx.conf"}}},
+}
+
+var databaseLayouts = []layout{
+	{"mysql", [][2]string{{"mysql", "mysql/my.cnf"}, {"mysql", "mysql/conf/my.cnf"}}},
+	{"mariadb", [][2]string{{"mariadb", "mariadb/conf/my.cnf"}}},
+	{"postgresql", [][2]string{{"postgresql", "postgresql/data/postgresql.conf"}, {"postgresql", "postgresql/conf/postgresql.conf"}}},
+	{"mongodb", [][2]string{{"mongodb", "mongodb/conf/mongodb.conf"}, {"mongodb", "mongodb/mongodb.conf"}}},
+}
+
+// appConfigFiles contains the main configuration file of the known applications,
+// relative to the application directory
+var appConfigFiles = map[string]string{
+	"drupal":    "htdocs/sites/default/settings.php",
+	"ghost":     "htdocs/config.production.json",
+	"joomla":    "htdocs/configuration.php",
+	"magento":   "htdocs/app/etc/env.php",
+	"wordpress": "htdocs/wp-config.php",
+	"redmine":   "htdocs/config/configuration.yml",
+}
+
+const appsDir = "apps"
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func detect(installDir string, layouts []layout) []Component {
+	res := []Component{}
+	for _, l := range layouts {
+		for _, c := range l.candidates {
+			configFile := filepath.Join(installDir, c[1])
+			if exists(configFile) {
+				res = append(res, Component{l.name, filepath.Join(installDir, c[0]), configFile})
+				break
+			}
+		}
+	}
+	return res
+}
+
+// detectApps looks for applications in the apps folder. Every folder with an
+// htdocs subfolder is considered an application.
+func detectApps(installDir string) ([]Component, error) {
+	res := []Component{}
+	entries, err := ioutil.ReadDir(filepath.Join(installDir, appsDir))
+	if os.IsNotExist(err) {
+		return res, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		root := filepath.Join(installDir, appsDir, e.Name())
+		if !exists(filepath.Join(root, "htdocs")) {
+			continue
+		}
+		app := Component{Name: e.Name(), Root: root}
+		if configFile, ok := appConfigFiles[e.Name()]; ok && exists(filepath.Join(root, configFile)) {
+			app.ConfigFile = filepath.Join(root, configFile)
+		}
+		res = append(res, app)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+// Inspect detects the web servers, applications and databases installed in installDir
+func Inspect(installDir string) (*Stack, error) {
+	if fi, err := os.Stat(installDir); err != nil {
+		return nil, err
+	} else if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", installDir)
+	}
+	apps, err := detectApps(installDir)
+	if err != nil {
+		return nil, fmt.Errorf("error detecting applications: %v", err)
+	}
+	return &Stack{
+		InstallDir: installDir,
+		WebServers: detect(installDir, webServerLayouts),
+		Apps:       apps,
+		Databases:  detect(installDir, databaseLayouts),
+	}, nil
+}
+
+// WebServer returns the detected web server with the given name
+func (s *Stack) WebServer(name string) (Component, bool) {
+	return find(s.WebServers, name)
+}
+
+// App returns the detected application with the given name
+func (s *Stack) App(name string) (Component, bool) {
+	return find(s.Apps, name)
+}
+
+// Database returns the detected database with the given name
+func (s *Stack) Database(name string) (Component, bool) {
+	return find(s.Databases, name)
+}
+
+func find(components []Component, name string) (Component, bool) {
+	for _, c := range components {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Component{}, false
+}
+
+func (s *Stack) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Installation Directory: %q\n", s.InstallDir)
+	for _, group := range []struct {
+		title      string
+		components []Component
+	}{
+		{"Web servers", s.WebServers},
+		{"Applications", s.Apps},
+		{"Databases", s.Databases},
+	} {
+		fmt.Fprintf(&b, "  - %s:", group.title)
+		if len(group.components) == 0 {
+			fmt.Fprintf(&b, " none\n")
+			continue
+		}
+		fmt.Fprintln(&b)
+		for _, c := range group.components {
+			fmt.Fprintf(&b, "    - %s\n", c)
+		}
+	}
+	return b.String()
+}
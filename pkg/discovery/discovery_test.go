@@ -0,0 +1,78 @@
+package discovery
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func createInstallDir(files []string) string {
+	installDir, err := ioutil.TempDir("", "bitnami")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, f := range files {
+		path := filepath.Join(installDir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			log.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte{}, 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+	return installDir
+}
+
+func TestInspect(t *testing.T) {
+	installDir := createInstallDir([]string{
+		"apache2/conf/httpd.conf",
+		"mysql/my.cnf",
+		"apps/wordpress/htdocs/wp-config.php",
+		"apps/redmine/htdocs/config/configuration.yml",
+		"apps/phpmyadmin/htdocs/config.inc.php",
+		"apps/bitnami/banner/conf/banner.conf",
+	})
+	defer os.RemoveAll(installDir)
+
+	t.Run("Check detected components", func(t *testing.T) {
+		stack, err := Inspect(installDir)
+		if err != nil {
+			t.Fatalf("Error inspecting installation directory: %v", err)
+		}
+		apache, ok := stack.WebServer("apache")
+		if !ok {
+			t.Fatalf("Apache not detected")
+		}
+		if apache.ConfigFile != filepath.Join(installDir, "apache2/conf/httpd.conf") {
+			t.Errorf("Incorrect Apache configuration file detected, got: %s", apache.ConfigFile)
+		}
+		if _, ok := stack.WebServer("nginx"); ok {
+			t.Errorf("Incorrect web server detected: nginx")
+		}
+		if _, ok := stack.Database("mysql"); !ok {
+			t.Errorf("MySQL not detected")
+		}
+		if len(stack.Apps) != 3 {
+			t.Fatalf("Incorrect number of applications detected, expected: 3, got: %d", len(stack.Apps))
+		}
+		wp, ok := stack.App("wordpress")
+		if !ok {
+			t.Fatalf("WordPress not detected")
+		}
+		if wp.ConfigFile != filepath.Join(installDir, "apps/wordpress/htdocs/wp-config.php") {
+			t.Errorf("Incorrect WordPress configuration file detected, got: %s", wp.ConfigFile)
+		}
+		pma, _ := stack.App("phpmyadmin")
+		if pma.ConfigFile != "" {
+			t.Errorf("Unexpected configuration file for unknown application, got: %s", pma.ConfigFile)
+		}
+	})
+
+	t.Run("Check missing installation directory", func(t *testing.T) {
+		if _, err := Inspect(filepath.Join(installDir, "missing")); err == nil {
+			t.Errorf("Expected error inspecting a missing directory")
+		}
+	})
+}
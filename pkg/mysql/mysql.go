@@ -2,8 +2,11 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"time"
+
 	// mysql implementation of go's database/sql/driver interface.
 	_ "github.com/go-sql-driver/mysql"
 )
@@ -26,23 +29,80 @@ type Query struct {
 	Value  string
 }
 
-// MySQLQuery returns the result of a MySQL query
-func (d Database) MySQLQuery(q Query) (result string, err error) {
+// dsn returns the data source name of the database. The driver timeouts are
+// set to the time left before the context expires.
+func (d Database) dsn(ctx context.Context) string {
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", d.User, d.Pass, d.Host, d.Port, d.Name)
-	db, err := sql.Open("mysql", dsn)
+	if deadline, ok := ctx.Deadline(); ok {
+		left := time.Until(deadline)
+		if left < time.Millisecond {
+			left = time.Millisecond
+		}
+		dsn += fmt.Sprintf("?timeout=%s&readTimeout=%s&writeTimeout=%s", left, left, left)
+	}
+	return dsn
+}
+
+// open connects to the database, quoting the identifiers with double quotes
+// (ANSI_QUOTES)
+func (d Database) open(ctx context.Context) (*sql.DB, error) {
+	db, err := sql.Open("mysql", d.dsn(ctx))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer db.Close()
-	if _, err := db.Exec("SET sql_mode='ANSI_QUOTES'"); err != nil {
+	if _, err := db.ExecContext(ctx, "SET sql_mode='ANSI_QUOTES'"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// MySQLQuery returns the result of a MySQL query
+func (d Database) MySQLQuery(ctx context.Context, q Query) (result string, err error) {
+	db, err := d.open(ctx)
+	if err != nil {
 		return "", err
 	}
+	defer db.Close()
 	query := fmt.Sprintf("SELECT %q FROM %q WHERE %q=?", q.Column, q.Table, q.Key)
-	rows, err := db.Query(query, q.Value)
-	rows.Next()
-	err = rows.Scan(&result)
-	if err != nil {
+	if err := db.QueryRowContext(ctx, query, q.Value).Scan(&result); err != nil {
 		return "", err
 	}
 	return result, nil
 }
+
+// MySQLRows returns the rows of a MySQL query, with the NULL values as empty
+// strings. The identifiers of the query must be quoted with double quotes.
+func (d Database) MySQLRows(ctx context.Context, query string, args ...interface{}) ([][]string, error) {
+	db, err := d.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var res [][]string
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := make([]string, len(columns))
+		for i, v := range values {
+			row[i] = v.String
+		}
+		res = append(res, row)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,292 @@
+// Package profile provides functions for loading declarative YAML check profiles
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/mmikulicic/multierror"
+)
+
+// Profile is a structure that matches the schema of a check profile.
+// It describes the targets of the checks, which checks to run and the
+// thresholds to apply.
+type Profile struct {
+	Targets    Targets    `json:"targets"`
+	Checks     Checks     `json:"checks"`
+	Thresholds Thresholds `json:"thresholds"`
+}
+
+// Targets contains the targets of each tool
+type Targets struct {
+	SSL  SSLTarget  `json:"ssl"`
+	SMTP SMTPTarget `json:"smtp"`
+}
+
+// SSLTarget contains the web server to check with ssl-checker
+type SSLTarget struct {
+	InstallDir string `json:"install_dir"`
+	WebServer  string `json:"web_server"`
+	ApacheRoot string `json:"apache_root"`
+	ApacheConf string `json:"apache_conf"`
+	NginxRoot  string `json:"nginx_root"`
+	NginxConf  string `json:"nginx_conf"`
+	Hostname   string `json:"hostname"`
+	Port       int    `json:"port"`
+}
+
+// SMTPTarget contains the application and SMTP server to check with smtp-checker
+type SMTPTarget struct {
+	InstallDir       string   `json:"install_dir"`
+	Application      string   `json:"application"`
+	ContainerEnv     bool     `json:"container_env"`
+	ContainerEnvFile string   `json:"container_env_file"`
+	DescriptorsDir   string   `json:"descriptors_dir"`
+	Host             string   `json:"host"`
+	Port             int      `json:"port"`
+	User             string   `json:"user"`
+	Password         string   `json:"password"`
+	Encryption       string   `json:"encryption"`
+	Auth             string   `json:"auth"`
+	From             string   `json:"from"`
+	FromName         string   `json:"from_name"`
+	Recipients       []string `json:"recipients"`
+	Mailbox          string   `json:"mailbox"`
+	MailboxPassword  string   `json:"mailbox_password"`
+	DNSResolver      string   `json:"dns_resolver"`
+	DKIMSelectors    []string `json:"dkim_selectors"`
+	NTPServers       []string `json:"ntp_servers"`
+	NTPLocal         bool     `json:"ntp_local"`
+}
+
+// Checks contains the checks selection of each tool
+type Checks struct {
+	SSL  Selection `json:"ssl"`
+	SMTP Selection `json:"smtp"`
+}
+
+// Selection lists the checks to run or to skip, and the timeout of specific checks.
+// An empty Run list means all the checks.
+type Selection struct {
+	Run      []string            `json:"run"`
+	Skip     []string            `json:"skip"`
+	Timeouts map[string]Duration `json:"timeouts"`
+}
+
+// Thresholds contains the limits used by the checks
+type Thresholds struct {
+	MaxClockOffset Duration `json:"max_clock_offset"`
+	MaxNTPRTT      Duration `json:"max_ntp_rtt"`
+	Timeout        Duration `json:"timeout"`
+}
+
+// Duration is a time.Duration that is written as a string (e.g "10s") in the profile
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("must be a duration string such as \"10s\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", s)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+var validWebServers = []string{"apache", "nginx"}
+
+var validEncryptions = []string{"none", "starttls", "tls"}
+
+var validAuthMechanisms = []string{"none", "plain", "login", "cram-md5", "xoauth2"}
+
+// Load reads a profile file and validates it against the profile schema
+func Load(path string) (*Profile, error) {
+	source, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading profile: %v", err)
+	}
+	return Parse(source)
+}
+
+// Parse parses and validates a YAML profile
+func Parse(source []byte) (*Profile, error) {
+	j, err := yaml.YAMLToJSON(source)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing profile: %v", err)
+	}
+	var raw interface{}
+	if err := json.Unmarshal(j, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing profile: %v", err)
+	}
+	if raw == nil {
+		return &Profile{}, nil
+	}
+	if err := checkFields("", raw, reflect.TypeOf(Profile{})); err != nil {
+		return nil, fmt.Errorf("invalid profile: %v", err)
+	}
+	p := Profile{}
+	if err := json.Unmarshal(j, &p); err != nil {
+		if te, ok := err.(*json.UnmarshalTypeError); ok {
+			return nil, fmt.Errorf("invalid profile: %s: expected %s, got %s", te.Field, te.Type, te.Value)
+		}
+		return nil, fmt.Errorf("invalid profile: %v", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid profile: %v", err)
+	}
+	return &p, nil
+}
+
+// checkFields walks the raw profile and reports the keys that are not part of the schema
+func checkFields(path string, raw interface{}, t reflect.Type) error {
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	m, ok := raw.(map[string]interface{})
+	if !ok {
+		if raw == nil {
+			return nil
+		}
+		return fmt.Errorf("%s: expected a mapping", strings.TrimPrefix(path, "."))
+	}
+	fields := map[string]reflect.Type{}
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		fields[name] = t.Field(i).Type
+		names = append(names, name)
+	}
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var errs error
+	for _, k := range keys {
+		fieldPath := strings.TrimPrefix(path+"."+k, ".")
+		ft, ok := fields[k]
+		if !ok {
+			errs = multierror.Append(errs, fmt.Errorf("%s: unknown field (valid fields: %s)", fieldPath, strings.Join(names, ", ")))
+			continue
+		}
+		if err := checkFields(fieldPath, m[k], ft); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	return errs
+}
+
+func validPort(port int) bool {
+	return port >= 0 && port <= 65535
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the values of the profile are correct
+func (p *Profile) Validate() error {
+	var errs error
+	ssl := p.Targets.SSL
+	if ssl.WebServer != "" && !contains(validWebServers, ssl.WebServer) {
+		errs = multierror.Append(errs, fmt.Errorf("targets.ssl.web_server: %q is not valid (valid values: %s)", ssl.WebServer, strings.Join(validWebServers, ", ")))
+	}
+	if (ssl.ApacheRoot != "" || ssl.ApacheConf != "") && (ssl.NginxRoot != "" || ssl.NginxConf != "") {
+		errs = multierror.Append(errs, fmt.Errorf("targets.ssl: apache and nginx paths cannot be set at the same time"))
+	}
+	if !validPort(ssl.Port) {
+		errs = multierror.Append(errs, fmt.Errorf("targets.ssl.port: %d is not a valid port", ssl.Port))
+	}
+	if !validPort(p.Targets.SMTP.Port) {
+		errs = multierror.Append(errs, fmt.Errorf("targets.smtp.port: %d is not a valid port", p.Targets.SMTP.Port))
+	}
+	if e := p.Targets.SMTP.Encryption; e != "" && !contains(validEncryptions, e) {
+		errs = multierror.Append(errs, fmt.Errorf("targets.smtp.encryption: %q is not valid (valid values: %s)", e, strings.Join(validEncryptions, ", ")))
+	}
+	if a := p.Targets.SMTP.Auth; a != "" && !contains(validAuthMechanisms, a) {
+		errs = multierror.Append(errs, fmt.Errorf("targets.smtp.auth: %q is not valid (valid values: %s)", a, strings.Join(validAuthMechanisms, ", ")))
+	}
+	if f := p.Targets.SMTP.From; f != "" && !strings.Contains(f, "@") {
+		errs = multierror.Append(errs, fmt.Errorf("targets.smtp.from: %q is not a mail address", f))
+	}
+	for i, r := range p.Targets.SMTP.Recipients {
+		if !strings.Contains(r, "@") {
+			errs = multierror.Append(errs, fmt.Errorf("targets.smtp.recipients[%d]: %q is not a mail address", i, r))
+		}
+	}
+	if p.Thresholds.MaxClockOffset < 0 {
+		errs = multierror.Append(errs, fmt.Errorf("thresholds.max_clock_offset: must be positive"))
+	}
+	if p.Thresholds.MaxNTPRTT < 0 {
+		errs = multierror.Append(errs, fmt.Errorf("thresholds.max_ntp_rtt: must be positive"))
+	}
+	if p.Thresholds.Timeout < 0 {
+		errs = multierror.Append(errs, fmt.Errorf("thresholds.timeout: must be positive"))
+	}
+	for _, check := range []struct {
+		tool      string
+		selection Selection
+	}{{"ssl", p.Checks.SSL}, {"smtp", p.Checks.SMTP}} {
+		for _, name := range check.selection.timeoutNames() {
+			if check.selection.Timeouts[name] <= 0 {
+				errs = multierror.Append(errs, fmt.Errorf("checks.%s.timeouts.%s: must be positive", check.tool, name))
+			}
+		}
+	}
+	return errs
+}
+
+// timeoutNames returns the names of the checks with a timeout, sorted
+func (s Selection) timeoutNames() []string {
+	var names []string
+	for name := range s.Timeouts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Enabled returns which of the available checks are selected. It fails if the
+// selection refers to checks that are not available. The path of the selection
+// in the profile (e.g. checks.smtp) prefixes the errors.
+func (s Selection) Enabled(path string, available []string) (map[string]bool, error) {
+	var errs error
+	for _, list := range []struct {
+		name  string
+		names []string
+	}{{"run", s.Run}, {"skip", s.Skip}, {"timeouts", s.timeoutNames()}} {
+		for _, name := range list.names {
+			if !contains(available, name) {
+				errs = multierror.Append(errs, fmt.Errorf("%s.%s: unknown check %q (valid checks: %s)", path, list.name, name, strings.Join(available, ", ")))
+			}
+		}
+	}
+	if errs != nil {
+		return nil, errs
+	}
+	enabled := map[string]bool{}
+	for _, name := range available {
+		enabled[name] = (len(s.Run) == 0 || contains(s.Run, name)) && !contains(s.Skip, name)
+	}
+	return enabled, nil
+}
@@ -0,0 +1,128 @@
+package profile
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testProfile = `
+targets:
+  ssl:
+    hostname: www.example.com
+    port: 8443
+    apache_conf: /opt/bitnami/apache2/conf/httpd.conf
+  smtp:
+    application: wordpress
+    recipients:
+      - admin@example.com
+    ntp_servers: [ntp.example.com, 10.0.0.1:123]
+checks:
+  smtp:
+    skip: [ntp]
+    timeouts:
+      sendmail: 1m
+thresholds:
+  max_clock_offset: 2s
+  max_ntp_rtt: 500ms
+  timeout: 30s
+`
+
+func TestParse(t *testing.T) {
+	t.Run("Check parsed profile", func(t *testing.T) {
+		p, err := Parse([]byte(testProfile))
+		if err != nil {
+			t.Fatalf("Error parsing profile: %v", err)
+		}
+		if p.Targets.SSL.Hostname != "www.example.com" {
+			t.Errorf("Incorrect hostname, expected: www.example.com, got: %s", p.Targets.SSL.Hostname)
+		}
+		if p.Targets.SSL.Port != 8443 {
+			t.Errorf("Incorrect port, expected: 8443, got: %d", p.Targets.SSL.Port)
+		}
+		if len(p.Targets.SMTP.Recipients) != 1 || p.Targets.SMTP.Recipients[0] != "admin@example.com" {
+			t.Errorf("Incorrect recipients, got: %v", p.Targets.SMTP.Recipients)
+		}
+		if len(p.Targets.SMTP.NTPServers) != 2 || p.Targets.SMTP.NTPServers[1] != "10.0.0.1:123" {
+			t.Errorf("Incorrect NTP servers, got: %v", p.Targets.SMTP.NTPServers)
+		}
+		if time.Duration(p.Thresholds.MaxNTPRTT) != 500*time.Millisecond {
+			t.Errorf("Incorrect max NTP RTT, expected: 500ms, got: %s", time.Duration(p.Thresholds.MaxNTPRTT))
+		}
+		if time.Duration(p.Thresholds.MaxClockOffset) != 2*time.Second {
+			t.Errorf("Incorrect max clock offset, expected: 2s, got: %s", time.Duration(p.Thresholds.MaxClockOffset))
+		}
+		if time.Duration(p.Checks.SMTP.Timeouts["sendmail"]) != time.Minute {
+			t.Errorf("Incorrect sendmail timeout, expected: 1m0s, got: %s", time.Duration(p.Checks.SMTP.Timeouts["sendmail"]))
+		}
+	})
+
+	t.Run("Check schema errors", func(t *testing.T) {
+		testData := []struct {
+			in  string
+			err string
+		}{
+			{"targets:\n  ssl:\n    hostnme: example.com\n", "targets.ssl.hostnme: unknown field"},
+			{"targets:\n  smtp:\n    port: smtp\n", "expected int"},
+			{"targets:\n  smtp:\n    port: 70000\n", "targets.smtp.port: 70000 is not a valid port"},
+			{"targets:\n  ssl:\n    web_server: lighttpd\n", "targets.ssl.web_server: \"lighttpd\" is not valid"},
+			{"targets:\n  smtp:\n    encryption: ssl\n", "targets.smtp.encryption: \"ssl\" is not valid"},
+			{"thresholds:\n  max_clock_offset: soon\n", "invalid duration \"soon\""},
+			{"checks: [ntp]\n", "checks: expected a mapping"},
+			{"checks:\n  smtp:\n    timeouts:\n      ntp: 0s\n", "checks.smtp.timeouts.ntp: must be positive"},
+		}
+		for _, tt := range testData {
+			_, err := Parse([]byte(tt.in))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Incorrect error for profile:\n%s\n expected: %q, got: %v", tt.in, tt.err, err)
+			}
+		}
+	})
+
+	t.Run("Check errors are sorted", func(t *testing.T) {
+		in := "checks:\n  smtp:\n    timeouts:\n      sendmail: 0s\n      ntp: 0s\n      connectivity: 0s\n  ssl:\n    timeouts:\n      certificate: 0s\n"
+		_, err := Parse([]byte(in))
+		if err == nil {
+			t.Fatalf("Expected errors for profile:\n%s", in)
+		}
+		var positions []int
+		for _, name := range []string{"checks.ssl.timeouts.certificate", "checks.smtp.timeouts.connectivity", "checks.smtp.timeouts.ntp", "checks.smtp.timeouts.sendmail"} {
+			positions = append(positions, strings.Index(err.Error(), name))
+		}
+		if !sort.IntsAreSorted(positions) || positions[0] < 0 {
+			t.Errorf("Incorrect order of errors, got: %v", err)
+		}
+	})
+}
+
+func TestSelectionEnabled(t *testing.T) {
+	available := []string{"connectivity", "ntp", "sendmail"}
+	t.Run("Check selected checks", func(t *testing.T) {
+		enabled, err := Selection{Skip: []string{"ntp"}}.Enabled("checks.smtp", available)
+		if err != nil {
+			t.Fatalf("Error selecting checks: %v", err)
+		}
+		if !enabled["connectivity"] || enabled["ntp"] || !enabled["sendmail"] {
+			t.Errorf("Incorrect checks selected: %v", enabled)
+		}
+		enabled, err = Selection{Run: []string{"ntp"}}.Enabled("checks.smtp", available)
+		if err != nil {
+			t.Fatalf("Error selecting checks: %v", err)
+		}
+		if enabled["connectivity"] || !enabled["ntp"] || enabled["sendmail"] {
+			t.Errorf("Incorrect checks selected: %v", enabled)
+		}
+	})
+
+	t.Run("Check unknown checks", func(t *testing.T) {
+		_, err := Selection{Skip: []string{"dns"}}.Enabled("checks.smtp", available)
+		if err == nil || !strings.Contains(err.Error(), `checks.smtp.skip: unknown check "dns"`) {
+			t.Errorf("Incorrect error for unknown check, got: %v", err)
+		}
+		_, err = Selection{Timeouts: map[string]Duration{"dns": Duration(time.Second)}}.Enabled("checks.smtp", available)
+		if err == nil || !strings.Contains(err.Error(), `checks.smtp.timeouts: unknown check "dns"`) {
+			t.Errorf("Incorrect error for unknown check timeout, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,195 @@
+// Package timeout provides functions for running network checks with deadlines and cancellation
+package timeout
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type timeoutKey struct{}
+
+// Error is returned when a check is interrupted before finishing
+type Error struct {
+	After    time.Duration
+	Phase    string
+	Canceled bool
+}
+
+func (e *Error) Error() string {
+	if e.Canceled {
+		return fmt.Sprintf("canceled while %s", e.Phase)
+	}
+	return fmt.Sprintf("timed out after %s while %s", e.After, e.Phase)
+}
+
+// WithTimeout returns a context that expires after d. The duration is kept in the
+// context so it can be reported when a check times out.
+func WithTimeout(parent context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithValue(parent, timeoutKey{}, d), d)
+}
+
+// WithInterrupt returns a context that is canceled when the process receives an interrupt signal
+func WithInterrupt(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		select {
+		case <-c:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(c)
+	}()
+	return ctx, cancel
+}
+
+// Wrap converts err into an Error when it was caused by the context expiring or
+// by a network timeout. Any other error is returned as is.
+func Wrap(ctx context.Context, phase string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+	d, _ := ctx.Value(timeoutKey{}).(time.Duration)
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return &Error{After: d, Phase: phase}
+	case context.Canceled:
+		return &Error{After: d, Phase: phase, Canceled: true}
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return &Error{After: d, Phase: phase}
+	}
+	return err
+}
+
+// Remaining returns the time left before the context expires, or def if it has no deadline
+func Remaining(ctx context.Context, def time.Duration) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return def
+	}
+	return time.Until(deadline)
+}
+
+// watchedConn is a connection whose I/O operations are interrupted when its
+// context is canceled, until it is closed
+type watchedConn struct {
+	net.Conn
+	stop chan struct{}
+	once sync.Once
+}
+
+// Close closes the connection and stops watching its context
+func (c *watchedConn) Close() error {
+	c.once.Do(func() { close(c.stop) })
+	return c.Conn.Close()
+}
+
+// Dial connects to the address using the context for the connection. The returned
+// connection fails any I/O operation once the context expires or is canceled.
+func Dial(ctx context.Context, network, address string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// Contexts that are never canceled do not need to be watched
+	if ctx.Done() == nil {
+		return conn, nil
+	}
+	watched := &watchedConn{Conn: conn, stop: make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-watched.stop:
+		}
+	}()
+	return watched, nil
+}
+
+// DialTLS connects to the address and performs the TLS handshake using the context
+// for the whole operation
+func DialTLS(ctx context.Context, network, address string, config *tls.Config) (*tls.Conn, error) {
+	conn, err := Dial(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// Overrides contains the timeout of specific checks. It can be used as a command line flag
+// with the format <check>=<duration>[,<check>=<duration>...]
+type Overrides map[string]time.Duration
+
+func (o Overrides) String() string {
+	var res []string
+	for name, d := range o {
+		res = append(res, fmt.Sprintf("%s=%s", name, d))
+	}
+	sort.Strings(res)
+	return strings.Join(res, ",")
+}
+
+// Set parses the timeouts provided in the command line
+func (o Overrides) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("%q does not follow the format <check>=<duration>", item)
+		}
+		d, err := time.ParseDuration(kv[1])
+		if err != nil {
+			return fmt.Errorf("invalid duration for %s: %v", kv[0], err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("timeout for %s must be positive", kv[0])
+		}
+		o[kv[0]] = d
+	}
+	return nil
+}
+
+// For returns the timeout of the check, or def if it is not overridden
+func (o Overrides) For(name string, def time.Duration) time.Duration {
+	if d, ok := o[name]; ok {
+		return d
+	}
+	return def
+}
+
+// Validate checks the overridden timeouts refer to known checks
+func (o Overrides) Validate(checks []string) error {
+	for name := range o {
+		found := false
+		for _, c := range checks {
+			if c == name {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown check %q (valid checks: %s)", name, strings.Join(checks, ", "))
+		}
+	}
+	return nil
+}
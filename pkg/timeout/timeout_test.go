@@ -0,0 +1,113 @@
+package timeout
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// silentListener accepts connections but never writes anything
+func silentListener(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error creating listener: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	return l
+}
+
+func TestDialTLS(t *testing.T) {
+	l := silentListener(t)
+	defer l.Close()
+	t.Run("Check TLS handshake timeout", func(t *testing.T) {
+		ctx, cancel := WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := DialTLS(ctx, "tcp", l.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		err = Wrap(ctx, "negotiating TLS", err)
+		if err == nil || err.Error() != "timed out after 50ms while negotiating TLS" {
+			t.Errorf("Incorrect error, expected: timed out after 50ms while negotiating TLS, got: %v", err)
+		}
+	})
+	t.Run("Check cancellation", func(t *testing.T) {
+		ctx, cancel := WithTimeout(context.Background(), time.Minute)
+		time.AfterFunc(50*time.Millisecond, cancel)
+		conn, err := Dial(ctx, "tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("Error connecting: %v", err)
+		}
+		_, err = conn.Read(make([]byte, 1))
+		err = Wrap(ctx, "reading", err)
+		if err == nil || err.Error() != "canceled while reading" {
+			t.Errorf("Incorrect error, expected: canceled while reading, got: %v", err)
+		}
+	})
+}
+
+func TestDial(t *testing.T) {
+	l := silentListener(t)
+	defer l.Close()
+	t.Run("Check contexts without cancellation are not watched", func(t *testing.T) {
+		conn, err := Dial(context.Background(), "tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("Error connecting: %v", err)
+		}
+		defer conn.Close()
+		if _, ok := conn.(*watchedConn); ok {
+			t.Errorf("Incorrect connection, expected a connection without context watcher")
+		}
+	})
+	t.Run("Check closing the connection stops watching the context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		before := runtime.NumGoroutine()
+		conn, err := Dial(ctx, "tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("Error connecting: %v", err)
+		}
+		conn.Close()
+		conn.Close()
+		for i := 0; runtime.NumGoroutine() > before && i < 100; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if n := runtime.NumGoroutine(); n > before {
+			t.Errorf("Incorrect number of goroutines after closing the connection, expected: %d, got: %d", before, n)
+		}
+	})
+}
+
+func TestOverrides(t *testing.T) {
+	t.Run("Check parsed timeouts", func(t *testing.T) {
+		o := Overrides{}
+		if err := o.Set("sendmail=30s,ntp=5s"); err != nil {
+			t.Fatalf("Error parsing timeouts: %v", err)
+		}
+		if o.For("sendmail", time.Second) != 30*time.Second {
+			t.Errorf("Incorrect timeout for sendmail, expected: 30s, got: %s", o.For("sendmail", time.Second))
+		}
+		if o.For("connectivity", time.Second) != time.Second {
+			t.Errorf("Incorrect default timeout, expected: 1s, got: %s", o.For("connectivity", time.Second))
+		}
+		if err := o.Validate([]string{"sendmail"}); err == nil || !strings.Contains(err.Error(), `unknown check "ntp"`) {
+			t.Errorf("Incorrect validation error, got: %v", err)
+		}
+	})
+	t.Run("Check invalid timeouts", func(t *testing.T) {
+		for _, in := range []string{"sendmail", "sendmail=soon", "sendmail=-1s"} {
+			if err := (Overrides{}).Set(in); err == nil {
+				t.Errorf("Expected error parsing %q", in)
+			}
+		}
+	})
+}